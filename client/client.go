@@ -0,0 +1,128 @@
+/*
+File Name:  client.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+/*
+Package client implements the abstracted functions against a running
+web API over HTTP. Multiple programs can share a single local Peernet
+daemon instead of each embedding their own node.
+*/
+package client
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+
+    Abstrations "github.com/PeernetOfficial/Abstraction"
+    "github.com/google/uuid"
+)
+
+// Errors returned by the client in addition to the ones of the abstracted functions. They can be checked via errors.Is.
+var (
+    ErrUnauthorized = errors.New("API key rejected")
+    ErrTargetFile   = errors.New("target file cannot be created by the API")
+)
+
+// Client connects to a running web API.
+type Client struct {
+    BaseURL string       // Base URL of the API, for example "http://127.0.0.1:112".
+    APIKey  uuid.UUID    // API key sent in the x-api-key header. uuid.Nil if the API key is disabled.
+    HTTP    *http.Client // HTTP client used for all requests.
+}
+
+// defaultTimeout is the timeout for regular HTTP requests. Streaming results via websocket is not affected.
+const defaultTimeout = 30 * time.Second
+
+// New creates a new client for the API at the base URL.
+func New(BaseURL string, APIKey uuid.UUID) *Client {
+    return &Client{
+        BaseURL: strings.TrimSuffix(BaseURL, "/"),
+        APIKey:  APIKey,
+        HTTP:    &http.Client{Timeout: defaultTimeout},
+    }
+}
+
+// request sends the request to the API and decodes the JSON response into result, if not nil.
+func (client *Client) request(method, path string, query url.Values, body, result interface{}) error {
+    var data []byte
+    if body != nil {
+        var err error
+        if data, err = json.Marshal(body); err != nil {
+            return err
+        }
+    }
+
+    req, err := http.NewRequest(method, client.url("http", path, query), bytes.NewReader(data))
+    if err != nil {
+        return err
+    }
+    client.setHeader(req.Header)
+    if body != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+
+    resp, err := client.HTTP.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    switch resp.StatusCode {
+    case http.StatusOK:
+    case http.StatusNoContent:
+        return nil
+    case http.StatusUnauthorized:
+        return ErrUnauthorized
+    default:
+        return fmt.Errorf("%s %s: HTTP status %d", method, path, resp.StatusCode)
+    }
+
+    if result == nil {
+        return nil
+    }
+
+    return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// get sends a GET request to the API.
+func (client *Client) get(path string, query url.Values, result interface{}) error {
+    return client.request(http.MethodGet, path, query, nil, result)
+}
+
+// post sends a POST request with the body encoded as JSON to the API.
+func (client *Client) post(path string, body, result interface{}) error {
+    return client.request(http.MethodPost, path, nil, body, result)
+}
+
+// url returns the full URL to the path. The scheme is replaced by "ws" for websockets, keeping TLS.
+func (client *Client) url(scheme, path string, query url.Values) string {
+    base := client.BaseURL
+    if scheme == "ws" {
+        base = "ws" + strings.TrimPrefix(base, "http")
+    }
+
+    if len(query) > 0 {
+        return base + path + "?" + query.Encode()
+    }
+    return base + path
+}
+
+// setHeader sets the API key header.
+func (client *Client) setHeader(header http.Header) {
+    if client.APIKey != uuid.Nil {
+        header.Set("x-api-key", client.APIKey.String())
+    }
+}
+
+// blockchainError returns ErrBlockchain with the blockchain status code. See blockchain.StatusX.
+func blockchainError(status int) error {
+    return fmt.Errorf("%w: status %d", Abstrations.ErrBlockchain, status)
+}
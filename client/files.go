@@ -0,0 +1,204 @@
+/*
+File Name:  files.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+package client
+
+import (
+    "bytes"
+    "context"
+    "net/url"
+    "path/filepath"
+    "time"
+
+    Abstrations "github.com/PeernetOfficial/Abstraction"
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/warehouse"
+    "github.com/google/uuid"
+)
+
+// downloadPollInterval is the interval to query the download status while waiting
+const downloadPollInterval = time.Millisecond * 500
+
+// Touch abstracted function that adds the file
+// to the warehouse and blockchain via the API.
+// The path must be accessible by the API, it
+// is read by the daemon and not uploaded.
+// returns blockchain version and height
+func (client *Client) Touch(filePath string) (*Abstrations.TouchReturn, error) {
+    // The daemon may run in a different working directory.
+    if absolute, err := filepath.Abs(filePath); err == nil {
+        filePath = absolute
+    }
+
+    var created webapi.WarehouseResult
+    if err := client.get("/warehouse/create/path", url.Values{"path": {filePath}}, &created); err != nil {
+        return nil, err
+    } else if created.Status != warehouse.StatusOK {
+        return nil, Abstrations.ErrNotInWarehouse
+    }
+
+    file := webapi.ApiFile{ID: uuid.New(), Hash: created.Hash, Date: time.Now()}
+    _, file.Name = filepath.Split(filePath)
+
+    // Detect the File Type and Format. In case of error the type is binary.
+    fileType, fileFormat, _ := webapi.FileDetectType(filePath)
+    file.Type = uint8(fileType)
+    file.Format = fileFormat
+
+    var status webapi.ApiBlockchainBlockStatus
+    if err := client.post("/blockchain/File/add", webapi.ApiBlockAddFiles{Files: []webapi.ApiFile{file}}, &status); err != nil {
+        return nil, err
+    } else if status.Status != blockchain.StatusOK {
+        return nil, blockchainError(status.Status)
+    }
+
+    return &Abstrations.TouchReturn{BlockchainHeight: status.Height, BlockchainVersion: status.Version}, nil
+}
+
+// Rm abstracted function that removes the file from the
+// blockchain via the API. The API deletes the file from
+// the warehouse if it is not referenced anymore.
+// returns the blockchain version and height with the deleted file
+func (client *Client) Rm(idStr string) (*Abstrations.RmReturn, error) {
+    ID, err := uuid.Parse(idStr)
+    if err != nil {
+        return nil, err
+    }
+
+    var list webapi.ApiBlockAddFiles
+    if err := client.get("/blockchain/File/list", nil, &list); err != nil {
+        return nil, err
+    } else if list.Status != blockchain.StatusOK {
+        return nil, blockchainError(list.Status)
+    }
+
+    result := &Abstrations.RmReturn{}
+    var remaining []webapi.ApiFile
+
+    for _, file := range list.Files {
+        if file.ID == ID {
+            result.DeletedFiles = append(result.DeletedFiles, file)
+        } else {
+            remaining = append(remaining, file)
+        }
+    }
+
+    if len(result.DeletedFiles) == 0 {
+        return nil, Abstrations.ErrFileNotFound
+    }
+
+    var status webapi.ApiBlockchainBlockStatus
+    if err := client.post("/blockchain/File/delete", webapi.ApiBlockAddFiles{Files: result.DeletedFiles}, &status); err != nil {
+        return nil, err
+    } else if status.Status != blockchain.StatusOK {
+        return nil, blockchainError(status.Status)
+    }
+
+    result.BlockchainHeight = status.Height
+    result.BlockchainVersion = status.Version
+
+    // The API deletes files from the warehouse that are not referenced anymore.
+    for _, file := range result.DeletedFiles {
+        if !file.IsVirtualFolder() && !isHashReferenced(remaining, file.Hash) {
+            result.CollectedHashes = append(result.CollectedHashes, file.Hash)
+        }
+    }
+
+    return result, nil
+}
+
+// ListFiles Abstracted function that lists
+// all files shared on the users blockchain
+func (client *Client) ListFiles() ([]webapi.ApiFile, error) {
+    var list webapi.ApiBlockAddFiles
+    if err := client.get("/blockchain/File/list", nil, &list); err != nil {
+        return nil, err
+    } else if list.Status != blockchain.StatusOK {
+        return nil, blockchainError(list.Status)
+    }
+
+    return list.Files, nil
+}
+
+// isHashReferenced checks if any of the files uses the hash
+func isHashReferenced(files []webapi.ApiFile, hash []byte) bool {
+    for n := range files {
+        if bytes.Equal(files[n].Hash, hash) {
+            return true
+        }
+    }
+
+    return false
+}
+
+// Download and abstracted function that starts downloading a file
+// via the API and returns the ID which can be used to track the
+// download status. The path is on the machine running the API.
+func (client *Client) Download(hashStr string, nodeIDStr string, path string) (*uuid.UUID, error) {
+    // validate hashes, must be blake3
+    _, valid1 := webapi.DecodeBlake3Hash(hashStr)
+    _, valid2 := webapi.DecodeBlake3Hash(nodeIDStr)
+    if !valid1 || !valid2 {
+        return nil, Abstrations.ErrInvalidHash
+    }
+
+    if path == "" {
+        return nil, Abstrations.ErrNoFilePath
+    }
+
+    var response webapi.ApiResponseDownloadStatus
+    if err := client.get("/download/start", url.Values{"path": {path}, "Hash": {hashStr}, "node": {nodeIDStr}}, &response); err != nil {
+        return nil, err
+    } else if response.APIStatus != webapi.DownloadResponseSuccess {
+        return nil, ErrTargetFile
+    }
+
+    return &response.ID, nil
+}
+
+// DownloadStatus Abstracted function that returns the status
+// of the download via the API
+func (client *Client) DownloadStatus(DownloadID *uuid.UUID) (*webapi.ApiResponseDownloadStatus, error) {
+    var response webapi.ApiResponseDownloadStatus
+    if err := client.get("/download/Status", url.Values{"ID": {DownloadID.String()}}, &response); err != nil {
+        return nil, err
+    } else if response.APIStatus == webapi.DownloadResponseIDNotFound {
+        return nil, Abstrations.ErrDownloadNotFound
+    }
+
+    return &response, nil
+}
+
+// DownloadWait blocks until the download is finished or canceled, or the context is cancelled.
+// The API does not provide download events, therefore the status is polled.
+// It returns nil if the download finished, ErrDownloadCanceled if it was canceled, ErrDownloadVerifyFailed if the data did not match the hash, or the context error.
+func (client *Client) DownloadWait(ctx context.Context, DownloadID *uuid.UUID) error {
+    ticker := time.NewTicker(downloadPollInterval)
+    defer ticker.Stop()
+
+    for {
+        status, err := client.DownloadStatus(DownloadID)
+        if err != nil {
+            return err
+        }
+
+        switch status.DownloadStatus {
+        case webapi.DownloadFinished:
+            return nil
+        case webapi.DownloadCanceled:
+            return Abstrations.ErrDownloadCanceled
+        case webapi.DownloadVerifyFailed:
+            return Abstrations.ErrDownloadVerifyFailed
+        }
+
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ticker.C:
+        }
+    }
+}
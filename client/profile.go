@@ -0,0 +1,78 @@
+/*
+File Name:  profile.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+package client
+
+import (
+    "net/url"
+    "strconv"
+
+    Abstrations "github.com/PeernetOfficial/Abstraction"
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/core/blockchain"
+)
+
+var _ Abstrations.Peernet = (*Client)(nil)
+
+// ProfileList Abstracted function that
+// lists all profile fields of the user
+func (client *Client) ProfileList() ([]webapi.ApiBlockRecordProfile, error) {
+    var result webapi.ApiProfileData
+    if err := client.get("/profile/list", nil, &result); err != nil {
+        return nil, err
+    } else if result.Status != blockchain.StatusOK {
+        return nil, blockchainError(result.Status)
+    }
+
+    return result.Fields, nil
+}
+
+// ProfileRead Abstracted function that reads
+// a single profile field. See blockchain.ProfileX.
+// returns ErrProfileFieldNotFound if not set
+func (client *Client) ProfileRead(field uint16) (*webapi.ApiBlockRecordProfile, error) {
+    var result webapi.ApiProfileData
+    if err := client.get("/profile/read", url.Values{"field": {strconv.Itoa(int(field))}}, &result); err != nil {
+        return nil, err
+    } else if result.Status == blockchain.StatusDataNotFound || (result.Status == blockchain.StatusOK && len(result.Fields) == 0) {
+        return nil, Abstrations.ErrProfileFieldNotFound
+    } else if result.Status != blockchain.StatusOK {
+        return nil, blockchainError(result.Status)
+    }
+
+    return &result.Fields[0], nil
+}
+
+// ProfileWrite Abstracted function that writes
+// the profile fields to the blockchain
+// returns blockchain version and height
+func (client *Client) ProfileWrite(fields []webapi.ApiBlockRecordProfile) (*Abstrations.TouchReturn, error) {
+    return client.profileUpdate("/profile/write", webapi.ApiProfileData{Fields: fields})
+}
+
+// ProfileDelete Abstracted function that deletes
+// the profile fields identified by their types
+// returns blockchain version and height
+func (client *Client) ProfileDelete(fields []uint16) (*Abstrations.TouchReturn, error) {
+    var input webapi.ApiProfileData
+    for _, field := range fields {
+        input.Fields = append(input.Fields, webapi.ApiBlockRecordProfile{Type: field})
+    }
+
+    return client.profileUpdate("/profile/delete", input)
+}
+
+// profileUpdate sends the profile data to the API function that changes the blockchain
+func (client *Client) profileUpdate(path string, input webapi.ApiProfileData) (*Abstrations.TouchReturn, error) {
+    var status webapi.ApiBlockchainBlockStatus
+    if err := client.post(path, input, &status); err != nil {
+        return nil, err
+    } else if status.Status != blockchain.StatusOK {
+        return nil, blockchainError(status.Status)
+    }
+
+    return &Abstrations.TouchReturn{BlockchainHeight: status.Height, BlockchainVersion: status.Version}, nil
+}
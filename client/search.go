@@ -0,0 +1,241 @@
+/*
+File Name:  search.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+package client
+
+import (
+    "context"
+    "net/http"
+    "net/url"
+    "strconv"
+
+    Abstrations "github.com/PeernetOfficial/Abstraction"
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/google/uuid"
+    "github.com/gorilla/websocket"
+)
+
+// Search Abstracted function
+// to query for files available
+// in the p2p network via the API.
+// It blocks until the search is
+// terminated and returns all results.
+func (client *Client) Search(term string) (*webapi.SearchResult, error) {
+    return client.SearchContext(context.Background(), term, nil)
+}
+
+// SearchContext runs a search and blocks until the search job terminates, the context is cancelled,
+// the search timeout is reached or MaxResults results were collected. The options may be nil.
+// If the context is cancelled, the results collected so far are returned together with the context error.
+func (client *Client) SearchContext(ctx context.Context, term string, opts *webapi.SearchRequest) (*webapi.SearchResult, error) {
+    stream, err := client.SearchStream(ctx, term, opts)
+    if err != nil {
+        return nil, err
+    }
+
+    var result webapi.SearchResult
+    result.Files = []webapi.ApiFile{}
+
+    for file := range stream.Results {
+        result.Files = append(result.Files, file)
+    }
+
+    result.Status = stream.Status()
+
+    return &result, stream.Err()
+}
+
+// StartSearch Abstracted function that
+// starts the search job based on specified
+// parameters and return the job ID
+// for a reference
+func (client *Client) StartSearch(input *webapi.SearchRequest) (uuid.UUID, error) {
+    if input.Timeout <= 0 {
+        input.Timeout = 20
+    }
+    if input.MaxResults <= 0 {
+        input.MaxResults = 200
+    }
+
+    var response webapi.SearchRequestResponse
+    if err := client.post("/search", input, &response); err != nil {
+        return uuid.Nil, err
+    }
+
+    return response.ID, nil
+}
+
+// SearchResult Abstracted function that returns the next
+// available results of the search job. The returned result
+// always carries the status together with any files.
+// If no files are returned, the error indicates the reason.
+// The API does not report why a search ended, therefore
+// ErrSearchTerminated is returned for any finished search.
+func (client *Client) SearchResult(jobID uuid.UUID) (*webapi.SearchResult, error) {
+    var result webapi.SearchResult
+    if err := client.get("/search/result", url.Values{"ID": {jobID.String()}, "limit": {"100"}}, &result); err != nil {
+        return nil, err
+    }
+
+    if result.Files == nil {
+        result.Files = []webapi.ApiFile{}
+    }
+
+    return &result, searchResultError(&result)
+}
+
+// searchResultError returns the error matching the status of the search result
+func searchResultError(result *webapi.SearchResult) error {
+    switch {
+    case result.Status == 2:
+        return Abstrations.ErrJobNotFound
+    case len(result.Files) > 0:
+        return nil
+    case result.Status == 3:
+        return Abstrations.ErrNoResultsYet
+    case result.Status == 1:
+        return Abstrations.ErrSearchTerminated
+    }
+
+    return nil
+}
+
+// TerminateSearch terminates the search job and removes it from the API.
+func (client *Client) TerminateSearch(jobID uuid.UUID) error {
+    return client.get("/search/terminate", url.Values{"ID": {jobID.String()}}, nil)
+}
+
+// SearchResultStream provides the results of a search job as they arrive via websocket.
+// The Results channel is closed once the search job terminates, the context
+// is cancelled, MaxResults is reached, or Close is called. Status and Err are only valid after that.
+type SearchResultStream struct {
+    JobID   uuid.UUID             // ID of the underlying search job
+    Results <-chan webapi.ApiFile // Results as they arrive
+
+    conn   *websocket.Conn    // websocket connection
+    ctx    context.Context    // context provided by the caller
+    cancel context.CancelFunc // stops feeding results
+    status int                // final status, see webapi.SearchResult
+    err    error              // final error
+}
+
+// SearchStream starts a search and returns a stream of results received via the websocket /search/result/ws.
+// The options are optional and may be nil; the term always overrides opts.Term.
+func (client *Client) SearchStream(ctx context.Context, term string, opts *webapi.SearchRequest) (*SearchResultStream, error) {
+    var input webapi.SearchRequest
+    if opts != nil {
+        input = *opts
+    } else {
+        input.FileType = -1
+        input.FileFormat = -1
+        input.SizeMin = -1
+        input.SizeMax = -1
+    }
+    input.Term = term
+
+    jobID, err := client.StartSearch(&input)
+    if err != nil {
+        return nil, err
+    }
+
+    header := http.Header{}
+    client.setHeader(header)
+
+    query := url.Values{"ID": {jobID.String()}, "limit": {strconv.Itoa(input.MaxResults)}}
+
+    conn, resp, err := websocket.DefaultDialer.DialContext(ctx, client.url("ws", "/search/result/ws", query), header)
+    if err != nil {
+        client.TerminateSearch(jobID)
+
+        if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+            return nil, ErrUnauthorized
+        } else if resp != nil && resp.StatusCode == http.StatusOK {
+            // The API responds with a regular search result if the job does not exist.
+            return nil, Abstrations.ErrJobNotFound
+        }
+        return nil, err
+    }
+
+    results := make(chan webapi.ApiFile)
+    stream := &SearchResultStream{JobID: jobID, Results: results, conn: conn, ctx: ctx}
+
+    var streamCtx context.Context
+    streamCtx, stream.cancel = context.WithCancel(ctx)
+
+    go stream.feed(streamCtx, client, input.MaxResults, results)
+
+    return stream, nil
+}
+
+// feed reads the results from the websocket and sends them to the channel until the search is finished.
+func (stream *SearchResultStream) feed(ctx context.Context, client *Client, maxResults int, results chan<- webapi.ApiFile) {
+    // The job is only used by this stream, remove it once done.
+    defer func() {
+        stream.cancel()
+        client.TerminateSearch(stream.JobID)
+        close(results)
+    }()
+
+    // Reading from the websocket is interrupted by closing the connection.
+    go func() {
+        <-ctx.Done()
+        stream.conn.Close()
+    }()
+
+    for count := 0; ; {
+        var result webapi.SearchResult
+        if err := stream.conn.ReadJSON(&result); err != nil {
+            // The API closes the connection once the limit is reached.
+            stream.status = 1
+            if count >= maxResults {
+                stream.status = 0
+            }
+            stream.err = stream.ctx.Err()
+            return
+        }
+
+        for _, file := range result.Files {
+            select {
+            case results <- file:
+                count++
+            case <-ctx.Done():
+                stream.status = 1
+                stream.err = stream.ctx.Err()
+                return
+            }
+        }
+
+        if result.Status == 1 { // No more results to expect
+            stream.status = 1
+            return
+        }
+    }
+}
+
+// Close stops the stream and terminates the search. The Results channel will be closed.
+func (stream *SearchResultStream) Close() {
+    stream.cancel()
+}
+
+// Status returns the final status of the search. See webapi.SearchResult. Only valid after the Results channel is closed.
+func (stream *SearchResultStream) Status() int {
+    return stream.status
+}
+
+// Err returns the final error of the search. Only valid after the Results channel is closed.
+func (stream *SearchResultStream) Err() error {
+    return stream.err
+}
+
+// Next returns the next result. It returns false if the stream is finished or the context is cancelled.
+func (stream *SearchResultStream) Next(ctx context.Context) (file webapi.ApiFile, ok bool) {
+    select {
+    case file, ok = <-stream.Results:
+        return file, ok
+    case <-ctx.Done():
+        return file, false
+    }
+}
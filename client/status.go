@@ -0,0 +1,44 @@
+/*
+File Name:  status.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+package client
+
+import (
+    "github.com/PeernetOfficial/Abstraction/webapi"
+)
+
+// Status returns the connectivity status
+// of the daemon to the network
+func (client *Client) Status() (*webapi.ApiResponseStatus, error) {
+    var status webapi.ApiResponseStatus
+    if err := client.get("/Status", nil, &status); err != nil {
+        return nil, err
+    }
+
+    return &status, nil
+}
+
+// AccountInfo returns the peer ID and
+// node ID of the user running the daemon
+func (client *Client) AccountInfo() (*webapi.ApiResponsePeerSelf, error) {
+    var info webapi.ApiResponsePeerSelf
+    if err := client.get("/account/info", nil, &info); err != nil {
+        return nil, err
+    }
+
+    return &info, nil
+}
+
+// Peers returns the peers currently
+// connected to the daemon
+func (client *Client) Peers() ([]webapi.ApiResponsePeerInfo, error) {
+    peers := []webapi.ApiResponsePeerInfo{}
+    if err := client.get("/Status/peers", nil, &peers); err != nil {
+        return nil, err
+    }
+
+    return peers, nil
+}
@@ -0,0 +1,505 @@
+/*
+File Name:  commands.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+package main
+
+import (
+    "context"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "os"
+    "os/signal"
+    "path"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    Abstrations "github.com/PeernetOfficial/Abstraction"
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/core/blockchain"
+)
+
+// sortOrders maps the names accepted by the -sort flag to webapi.SortX
+var sortOrders = map[string]int{
+    "none":          webapi.SortNone,
+    "relevance":     webapi.SortRelevanceDec,
+    "relevance-asc": webapi.SortRelevanceAsc,
+    "date":          webapi.SortDateDesc,
+    "date-asc":      webapi.SortDateAsc,
+    "name":          webapi.SortNameAsc,
+    "name-desc":     webapi.SortNameDesc,
+    "size":          webapi.SortSizeDesc,
+    "size-asc":      webapi.SortSizeAsc,
+    "shared":        webapi.SortSharedByCountDesc,
+    "shared-asc":    webapi.SortSharedByCountAsc,
+}
+
+// profileFields maps the names accepted by the profile command to blockchain.ProfileX
+var profileFields = map[string]uint16{
+    "name":    blockchain.ProfileName,
+    "email":   blockchain.ProfileEmail,
+    "website": blockchain.ProfileWebsite,
+    "twitter": blockchain.ProfileTwitter,
+    "youtube": blockchain.ProfileYouTube,
+    "address": blockchain.ProfileAddress,
+    "picture": blockchain.ProfilePicture,
+}
+
+// downloadPollInterval is the interval to update the progress bar
+const downloadPollInterval = 500 * time.Millisecond
+
+// interruptContext returns a context that is cancelled on Ctrl+C
+func interruptContext() (ctx context.Context, cancel context.CancelFunc) {
+    return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+func cmdSearch(c *cli, args []string) error {
+    flags := c.newFlags("search")
+    fileType := flags.Int("type", -1, "file type, see core.TypeX (-1 = any)")
+    fileFormat := flags.Int("format", -1, "file format, see core.FormatX (-1 = any)")
+    sizeMin := flags.Int("sizemin", -1, "minimum file size in bytes (-1 = not used)")
+    sizeMax := flags.Int("sizemax", -1, "maximum file size in bytes (-1 = not used)")
+    dateFrom := flags.String("from", "", "shared since, format \"2006-01-02 15:04:05\" (requires -to)")
+    dateTo := flags.String("to", "", "shared until, format \"2006-01-02 15:04:05\" (requires -from)")
+    sortName := flags.String("sort", "relevance", "sort order: none, relevance, relevance-asc, date, date-asc, name, name-desc, size, size-asc, shared, shared-asc")
+    limit := flags.Int("limit", 100, "maximum count of results")
+    timeout := flags.Int("timeout", 10, "search timeout in seconds")
+    if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+        return errUsage
+    }
+
+    sortOrder, ok := sortOrders[*sortName]
+    if !ok {
+        return fmt.Errorf("unknown sort order '%s'", *sortName)
+    }
+
+    request := &webapi.SearchRequest{Timeout: *timeout, MaxResults: *limit, DateFrom: *dateFrom, DateTo: *dateTo, Sort: sortOrder,
+        FileType: *fileType, FileFormat: *fileFormat, SizeMin: *sizeMin, SizeMax: *sizeMax}
+
+    // Ctrl+C stops the search and returns the results found so far.
+    ctx, cancel := interruptContext()
+    defer cancel()
+
+    result, err := c.client.SearchContext(ctx, strings.Join(flags.Args(), " "), request)
+    if result == nil || (err != nil && ctx.Err() == nil) {
+        return err
+    }
+
+    // Results are streamed as they arrive, therefore they are sorted once all are received.
+    var files []*webapi.ApiFile
+    for n := range result.Files {
+        files = append(files, &result.Files[n])
+    }
+    sorted := []webapi.ApiFile{}
+    for _, file := range webapi.SortFiles(files, sortOrder) {
+        sorted = append(sorted, *file)
+    }
+
+    return c.output(sorted, func(w io.Writer) {
+        fmt.Fprintf(w, "SIZE\tNAME\tHASH\tNODE ID\n")
+        for _, file := range sorted {
+            fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", formatSize(file.Size), filePath(&file), hex.EncodeToString(file.Hash), hex.EncodeToString(file.NodeID))
+        }
+    })
+}
+
+func cmdGet(c *cli, args []string) error {
+    flags := c.newFlags("get")
+    output := flags.String("o", "", "target file (default is the hash in the current directory)")
+    noProgress := flags.Bool("no-progress", false, "do not show the progress bar")
+    if err := flags.Parse(args); err != nil || flags.NArg() != 2 {
+        return errUsage
+    }
+
+    hash, nodeID := flags.Arg(0), flags.Arg(1)
+
+    target := *output
+    if target == "" {
+        target = hash
+    }
+
+    // The file is created by the daemon which may run in a different working directory.
+    target, err := filepath.Abs(target)
+    if err != nil {
+        return err
+    }
+
+    downloadID, err := c.client.Download(hash, nodeID, target)
+    if err != nil {
+        return err
+    }
+
+    // Ctrl+C stops waiting. The download continues in the daemon.
+    ctx, cancel := interruptContext()
+    defer cancel()
+
+    showProgress := !c.json && !*noProgress
+
+    ticker := time.NewTicker(downloadPollInterval)
+    defer ticker.Stop()
+
+    for {
+        status, err := c.client.DownloadStatus(downloadID)
+        if err != nil {
+            return err
+        }
+
+        if showProgress {
+            progressBar(c.stderr, status)
+        }
+
+        if webapi.IsDownloadTerminal(status.DownloadStatus) {
+            if showProgress {
+                fmt.Fprintln(c.stderr)
+            }
+
+            err := c.output(status, func(w io.Writer) {
+                if status.DownloadStatus == webapi.DownloadFinished {
+                    fmt.Fprintf(w, "Downloaded %s (%s)\n", target, formatSize(status.Progress.TotalSize))
+                }
+            })
+            if err == nil && status.DownloadStatus == webapi.DownloadCanceled {
+                err = Abstrations.ErrDownloadCanceled
+            } else if err == nil && status.DownloadStatus == webapi.DownloadVerifyFailed {
+                err = Abstrations.ErrDownloadVerifyFailed
+            }
+            return err
+        }
+
+        select {
+        case <-ctx.Done():
+            if showProgress {
+                fmt.Fprintln(c.stderr)
+            }
+            return fmt.Errorf("stopped waiting, download %s continues in the background", downloadID.String())
+        case <-ticker.C:
+        }
+    }
+}
+
+// progressBar prints the progress of the download in a single line
+func progressBar(w io.Writer, status *webapi.ApiResponseDownloadStatus) {
+    const width = 30
+
+    if status.DownloadStatus == webapi.DownloadQueued {
+        fmt.Fprintf(w, "\rQueued at position %d...", status.Queue.Position+1)
+        return
+    } else if status.DownloadStatus < webapi.DownloadWaitSwarm {
+        fmt.Fprintf(w, "\rWaiting for metadata...")
+        return
+    }
+
+    filled := int(status.Progress.Percentage / 100 * width)
+    if filled < 0 || filled > width {
+        filled = width
+    }
+
+    fmt.Fprintf(w, "\r[%s%s] %6.2f%%  %s / %s   ", strings.Repeat("#", filled), strings.Repeat(" ", width-filled), status.Progress.Percentage,
+        formatSize(status.Progress.DownloadedSize), formatSize(status.Progress.TotalSize))
+}
+
+// sharedFile is the result of sharing a single file
+type sharedFile struct {
+    Path  string `json:"path"`
+    Error string `json:"error,omitempty"` // Error sharing the file. The blockchain height and version are only valid if empty.
+    Abstrations.TouchReturn
+}
+
+// removedFile is the result of removing a single file
+type removedFile struct {
+    ID    string `json:"id"`
+    Error string `json:"error,omitempty"` // Error removing the file
+    Abstrations.RmReturn
+}
+
+// cmdShare shares all paths, even if some fail. The failures are reported after the results.
+func cmdShare(c *cli, args []string) error {
+    if len(args) == 0 {
+        return errUsage
+    }
+
+    var results []sharedFile
+    var failed []error
+
+    for _, filePath := range args {
+        shared := sharedFile{Path: filePath}
+
+        if result, err := c.client.Touch(filePath); err != nil {
+            shared.Error = err.Error()
+            failed = append(failed, fmt.Errorf("sharing '%s': %w", filePath, err))
+        } else {
+            shared.TouchReturn = *result
+        }
+
+        results = append(results, shared)
+    }
+
+    err := c.output(results, func(w io.Writer) {
+        var last *sharedFile
+        for n := range results {
+            if results[n].Error == "" {
+                fmt.Fprintf(w, "Shared %s\n", results[n].Path)
+                last = &results[n]
+            }
+        }
+        if last != nil {
+            fmt.Fprintf(w, "Blockchain height %d, version %d\n", last.BlockchainHeight, last.BlockchainVersion)
+        }
+    })
+
+    return outputFailed(c, err, failed, len(args))
+}
+
+// cmdRm removes all files, even if some fail. The failures are reported after the results.
+func cmdRm(c *cli, args []string) error {
+    if len(args) == 0 {
+        return errUsage
+    }
+
+    var results []removedFile
+    var failed []error
+
+    for _, id := range args {
+        removed := removedFile{ID: id}
+
+        if result, err := c.client.Rm(id); err != nil {
+            removed.Error = err.Error()
+            failed = append(failed, fmt.Errorf("removing '%s': %w", id, err))
+        } else {
+            removed.RmReturn = *result
+        }
+
+        results = append(results, removed)
+    }
+
+    err := c.output(results, func(w io.Writer) {
+        for _, result := range results {
+            for _, file := range result.DeletedFiles {
+                fmt.Fprintf(w, "Removed %s\t%s\n", file.ID.String(), filePath(&file))
+            }
+        }
+    })
+
+    return outputFailed(c, err, failed, len(args))
+}
+
+// outputFailed prints the errors of the failed items to stderr. It returns the output error or, if any item failed, an error with the count.
+func outputFailed(c *cli, err error, failed []error, total int) error {
+    for _, failure := range failed {
+        fmt.Fprintf(c.stderr, "Error: %v\n", failure)
+    }
+
+    if err != nil {
+        return err
+    } else if len(failed) > 0 {
+        return fmt.Errorf("%d of %d files failed", len(failed), total)
+    }
+
+    return nil
+}
+
+func cmdLs(c *cli, args []string) error {
+    flags := c.newFlags("ls")
+    folder := flags.String("folder", "", "only list files in the virtual folder (including sub-folders)")
+    if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+        return errUsage
+    }
+
+    files, err := c.client.ListFiles()
+    if err != nil {
+        return err
+    }
+
+    parent := path.Clean("/" + *folder)
+    listed := []webapi.ApiFile{}
+    for _, file := range files {
+        if fileFolder := path.Clean("/" + file.Folder); parent == "/" || fileFolder == parent || strings.HasPrefix(fileFolder, parent+"/") {
+            listed = append(listed, file)
+        }
+    }
+
+    return c.output(listed, func(w io.Writer) {
+        fmt.Fprintf(w, "ID\tSIZE\tNAME\tHASH\n")
+        for _, file := range listed {
+            size := formatSize(file.Size)
+            if file.IsVirtualFolder() {
+                size = "<dir>"
+            }
+            fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", file.ID.String(), size, filePath(&file), hex.EncodeToString(file.Hash))
+        }
+    })
+}
+
+// statusResult combines the connectivity status and account information
+type statusResult struct {
+    Status  *webapi.ApiResponseStatus   `json:"status"`
+    Account *webapi.ApiResponsePeerSelf `json:"account"`
+}
+
+func cmdStatus(c *cli, args []string) error {
+    if len(args) != 0 {
+        return errUsage
+    }
+
+    status, err := c.client.Status()
+    if err != nil {
+        return err
+    }
+    account, err := c.client.AccountInfo()
+    if err != nil {
+        return err
+    }
+
+    return c.output(statusResult{Status: status, Account: account}, func(w io.Writer) {
+        fmt.Fprintf(w, "Connected:\t%t\n", status.IsConnected)
+        fmt.Fprintf(w, "Peers:\t%d\n", status.CountPeerList)
+        fmt.Fprintf(w, "Network:\t%d\n", status.CountNetwork)
+        fmt.Fprintf(w, "Peer ID:\t%s\n", account.PeerID)
+        fmt.Fprintf(w, "Node ID:\t%s\n", account.NodeID)
+    })
+}
+
+func cmdPeers(c *cli, args []string) error {
+    if len(args) != 0 {
+        return errUsage
+    }
+
+    peers, err := c.client.Peers()
+    if err != nil {
+        return err
+    }
+    if peers == nil {
+        peers = []webapi.ApiResponsePeerInfo{}
+    }
+
+    return c.output(peers, func(w io.Writer) {
+        fmt.Fprintf(w, "NODE ID\tUSER AGENT\tROOT\tHEIGHT\tGEOIP\n")
+        for _, peer := range peers {
+            fmt.Fprintf(w, "%s\t%s\t%t\t%d\t%s\n", hex.EncodeToString(peer.NodeID), peer.UserAgent, peer.IsRoot, peer.BlockchainHeight, peer.GeoIP)
+        }
+    })
+}
+
+func cmdProfile(c *cli, args []string) error {
+    if len(args) == 0 {
+        return errUsage
+    }
+
+    switch {
+    case args[0] == "get" && len(args) == 1:
+        fields, err := c.client.ProfileList()
+        if err != nil {
+            return err
+        }
+        if fields == nil {
+            fields = []webapi.ApiBlockRecordProfile{}
+        }
+        return c.output(fields, func(w io.Writer) {
+            for _, field := range fields {
+                fmt.Fprintf(w, "%s:\t%s\n", profileFieldName(field.Type), profileFieldText(&field))
+            }
+        })
+
+    case args[0] == "get" && len(args) == 2:
+        fieldType, err := parseProfileField(args[1])
+        if err != nil {
+            return err
+        }
+        field, err := c.client.ProfileRead(fieldType)
+        if err != nil {
+            return err
+        }
+        return c.output(field, func(w io.Writer) {
+            fmt.Fprintf(w, "%s\n", profileFieldText(field))
+        })
+
+    case args[0] == "set" && len(args) == 3:
+        fieldType, err := parseProfileField(args[1])
+        if err != nil {
+            return err
+        }
+
+        field := webapi.ApiBlockRecordProfile{Type: fieldType, Text: args[2]}
+        if fieldType == blockchain.ProfilePicture {
+            // The picture is read from the file.
+            if field.Blob, err = os.ReadFile(args[2]); err != nil {
+                return err
+            }
+            field.Text = ""
+        }
+
+        result, err := c.client.ProfileWrite([]webapi.ApiBlockRecordProfile{field})
+        if err != nil {
+            return err
+        }
+        return c.output(result, func(w io.Writer) {
+            fmt.Fprintf(w, "Blockchain height %d, version %d\n", result.BlockchainHeight, result.BlockchainVersion)
+        })
+    }
+
+    return errUsage
+}
+
+// parseProfileField returns the profile field by name or number
+func parseProfileField(text string) (field uint16, err error) {
+    if field, ok := profileFields[strings.ToLower(text)]; ok {
+        return field, nil
+    }
+
+    number, err := strconv.ParseUint(text, 10, 16)
+    if err != nil {
+        return 0, fmt.Errorf("unknown profile field '%s'", text)
+    }
+
+    return uint16(number), nil
+}
+
+// profileFieldName returns the name of the profile field, or the number if unknown
+func profileFieldName(field uint16) string {
+    for name, value := range profileFields {
+        if value == field {
+            return name
+        }
+    }
+
+    return strconv.Itoa(int(field))
+}
+
+// profileFieldText returns the field value for text output. Binary data is not printed.
+func profileFieldText(field *webapi.ApiBlockRecordProfile) string {
+    if len(field.Blob) > 0 {
+        return "<" + formatSize(uint64(len(field.Blob))) + ">"
+    }
+
+    return field.Text
+}
+
+// filePath returns the virtual folder and name of the file
+func filePath(file *webapi.ApiFile) string {
+    if file.Folder == "" {
+        return file.Name
+    }
+
+    return strings.Trim(file.Folder, "/") + "/" + file.Name
+}
+
+// formatSize returns the size in human readable form
+func formatSize(size uint64) string {
+    const unit = 1024
+    if size < unit {
+        return strconv.FormatUint(size, 10) + " B"
+    }
+
+    div, exp := uint64(unit), 0
+    for n := size / unit; n >= unit; n /= unit {
+        div *= unit
+        exp++
+    }
+
+    return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
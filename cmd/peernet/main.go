@@ -0,0 +1,167 @@
+/*
+File Name:  main.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+/*
+Command peernet is a command line tool to use a running Peernet web API.
+It is intended for scripting: All commands support JSON output via the -json flag.
+
+    peernet [global flags] <command> [flags] [arguments]
+
+The API address and key can be set via the environment variables PEERNET_API and PEERNET_API_KEY.
+*/
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "text/tabwriter"
+
+    "github.com/PeernetOfficial/Abstraction/client"
+    "github.com/google/uuid"
+)
+
+// Exit codes
+const (
+    exitSuccess = 0 // Success.
+    exitError   = 1 // The command failed.
+    exitUsage   = 2 // Invalid command line.
+)
+
+// defaultAPI is the API address used if neither the flag nor the environment variable is set
+const defaultAPI = "http://127.0.0.1:112"
+
+// cli contains the global options shared by all commands
+type cli struct {
+    client *client.Client
+    json   bool      // output JSON instead of text
+    stdout io.Writer // output
+    stderr io.Writer // progress and errors
+}
+
+// command is a subcommand of the tool
+type command struct {
+    usage       string                             // arguments
+    description string                             // short description
+    run         func(c *cli, args []string) error // runs the command with the arguments after the command name
+}
+
+var commands = map[string]command{
+    "search":  {"[flags] <term>", "Search files in the network", cmdSearch},
+    "get":     {"[flags] <hash> <node id>", "Download a file", cmdGet},
+    "share":   {"<path> [path ...]", "Share files (the daemon reads the files)", cmdShare},
+    "rm":      {"<file id> [file id ...]", "Remove shared files", cmdRm},
+    "ls":      {"[flags]", "List the files shared on the own blockchain", cmdLs},
+    "status":  {"", "Show the connectivity status and account", cmdStatus},
+    "peers":   {"", "List connected peers", cmdPeers},
+    "profile": {"get [field] | set <field> <value>", "Read and write the profile", cmdProfile},
+}
+
+// errUsage indicates an invalid command line. The usage of the command is printed.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+    os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run parses the global flags and runs the command. It returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+    flags := flag.NewFlagSet("peernet", flag.ContinueOnError)
+    flags.SetOutput(stderr)
+    apiURL := flags.String("api", envDefault("PEERNET_API", defaultAPI), "URL of the web API")
+    apiKey := flags.String("key", os.Getenv("PEERNET_API_KEY"), "API key")
+    jsonOutput := flags.Bool("json", false, "output JSON")
+    flags.Usage = func() { usage(flags, stderr) }
+
+    if err := flags.Parse(args); err != nil {
+        return exitUsage
+    } else if flags.NArg() == 0 {
+        usage(flags, stderr)
+        return exitUsage
+    }
+
+    key := uuid.Nil
+    if *apiKey != "" {
+        var err error
+        if key, err = uuid.Parse(*apiKey); err != nil {
+            fmt.Fprintf(stderr, "Invalid API key: %v\n", err)
+            return exitUsage
+        }
+    }
+
+    name := flags.Arg(0)
+    cmd, ok := commands[name]
+    if !ok {
+        fmt.Fprintf(stderr, "Unknown command '%s'.\n", name)
+        usage(flags, stderr)
+        return exitUsage
+    }
+
+    c := &cli{client: client.New(*apiURL, key), json: *jsonOutput, stdout: stdout, stderr: stderr}
+
+    if err := cmd.run(c, flags.Args()[1:]); err == errUsage || err == flag.ErrHelp {
+        fmt.Fprintf(stderr, "Usage: peernet %s %s\n", name, cmd.usage)
+        return exitUsage
+    } else if err != nil {
+        fmt.Fprintf(stderr, "Error: %v\n", err)
+        return exitError
+    }
+
+    return exitSuccess
+}
+
+// usage prints the global usage
+func usage(flags *flag.FlagSet, w io.Writer) {
+    fmt.Fprintf(w, "Usage: peernet [global flags] <command> [flags] [arguments]\n\nCommands:\n")
+
+    var names []string
+    for name := range commands {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+    for _, name := range names {
+        fmt.Fprintf(table, "  %s %s\t%s\n", name, commands[name].usage, commands[name].description)
+    }
+    table.Flush()
+
+    fmt.Fprintf(w, "\nGlobal flags:\n")
+    flags.PrintDefaults()
+}
+
+// envDefault returns the environment variable or the default value if not set
+func envDefault(name, value string) string {
+    if env := os.Getenv(name); env != "" {
+        return env
+    }
+
+    return value
+}
+
+// output writes the result either as JSON or as text
+func (c *cli) output(result interface{}, text func(w io.Writer)) error {
+    if c.json {
+        encoder := json.NewEncoder(c.stdout)
+        encoder.SetIndent("", "    ")
+        return encoder.Encode(result)
+    }
+
+    table := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+    text(table)
+    return table.Flush()
+}
+
+// newFlags returns the flag set for a command
+func (c *cli) newFlags(name string) *flag.FlagSet {
+    flags := flag.NewFlagSet(name, flag.ContinueOnError)
+    flags.SetOutput(c.stderr)
+    return flags
+}
@@ -0,0 +1,37 @@
+/*
+File Name:  errors.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+package Abstrations
+
+import (
+    "errors"
+    "fmt"
+)
+
+// Errors returned by the abstracted functions. They can be checked via errors.Is.
+var (
+    ErrJobNotFound          = errors.New("search job ID not found")
+    ErrNoResultsYet         = errors.New("no results yet available, keep trying")
+    ErrSearchTerminated     = errors.New("search terminated, no more results to expect")
+    ErrSearchNotStarted     = errors.New("search not started, no more results to expect")
+    ErrNoIndex              = errors.New("no search index available")
+    ErrDownloadNotFound     = errors.New("download ID not found")
+    ErrDownloadCanceled     = errors.New("download canceled")
+    ErrDownloadVerifyFailed = errors.New("downloaded data does not match the hash")
+    ErrInvalidHash          = errors.New("hash or node ID was not valid")
+    ErrNoFilePath           = errors.New("file path not provided")
+    ErrNotInWarehouse       = errors.New("file not in warehouse")
+    ErrFileNotFound         = errors.New("file not found on the blockchain")
+    ErrTagReadOnly          = errors.New("virtual tags cannot be set")
+    ErrMerkleInfo           = errors.New("merkle information not set")
+    ErrBlockchain           = errors.New("blockchain operation failed")
+    ErrProfileFieldNotFound = errors.New("profile field not set")
+)
+
+// blockchainError returns ErrBlockchain with the blockchain status code. See blockchain.StatusX.
+func blockchainError(status int) error {
+    return fmt.Errorf("%w: status %d", ErrBlockchain, status)
+}
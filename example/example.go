@@ -1,6 +1,8 @@
 package main
 
 import (
+    "context"
+    "encoding/hex"
     "encoding/json"
     "fmt"
     Abstrations "github.com/PeernetOfficial/Abstraction"
@@ -59,26 +61,18 @@ func main() {
         downloadDir = homeDir + "\\Downloads\\"
     }
 
-    downloadID, err := Abstrations.Download(api, search.Files[0].Hash, search.Files[0].NodeID, downloadDir+search.Files[0].Name)
+    downloadID, err := Abstrations.Download(api, hex.EncodeToString(search.Files[0].Hash), hex.EncodeToString(search.Files[0].NodeID), downloadDir+search.Files[0].Name)
     if err != nil {
         fmt.Println(err)
         return
     }
 
-    fmt.Println("Waiting to download file...")
+    fmt.Println("========= Downloading file " + search.Files[0].Name + " ==============")
 
-    downloadStatus, err := Abstrations.DownloadStatus(api, downloadID)
-    if err != nil {
+    // Block until the download is finished or canceled. The context may be used to set a timeout.
+    if err = Abstrations.DownloadWait(context.Background(), api, downloadID); err != nil {
         fmt.Println(err)
-    }
-
-    fmt.Println("========= Downloading file " + downloadStatus.File.Name + " ==============")
-    for downloadStatus.DownloadStatus != 5 {
-        //fmt.Println(downloadStatus.Progress.Percentage)
-        downloadStatus, err = Abstrations.DownloadStatus(api, downloadID)
-        if err != nil {
-            fmt.Println(err)
-        }
+        return
     }
 
     fmt.Println(fmt.Println("========= Download complete =============="))
@@ -86,7 +80,7 @@ func main() {
     fmt.Println("========= Peernet Add file ===========")
 
     // ================== Add file to peernet ==================
-    touch, file, err := Abstrations.Touch(api, "example.go")
+    touch, file, err := Abstrations.TouchWithOptions(api, "example.go", &Abstrations.TouchOptions{Folder: "examples", Description: "Peernet example #golang"})
     if err != nil {
         fmt.Println(err)
         return
@@ -97,7 +91,7 @@ func main() {
     fmt.Println("========= Peernet Remove file ===========")
 
     // ================== Remove file from peernet ==================
-    err = Abstrations.Rm(api, file.ID)
+    _, err = Abstrations.RmID(api, file.ID)
     if err != nil {
         fmt.Println(err)
         return
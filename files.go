@@ -7,15 +7,17 @@ Authors: Peter Kleissner, Akilan Selvacoumar
 package Abstrations
 
 import (
-    "encoding/hex"
-    "errors"
+    "context"
+    "fmt"
     "github.com/PeernetOfficial/Abstraction/webapi"
     "github.com/PeernetOfficial/core/blockchain"
     "github.com/PeernetOfficial/core/protocol"
     "github.com/PeernetOfficial/core/warehouse"
     "github.com/google/uuid"
-    "math"
+    "path"
     "path/filepath"
+    "runtime"
+    "sync"
     "time"
 )
 
@@ -29,75 +31,264 @@ type TouchReturn struct {
     BlockchainVersion uint64
 }
 
+// TouchOptions are optional settings for sharing a file.
+// Zero values are not used.
+type TouchOptions struct {
+    Name        string                   // Name of the file. Default is the file name of the path.
+    Folder      string                   // Virtual folder. The local directory is never published.
+    Description string                   // Description. This is expected to be multiline and may contain hashtags.
+    DateCreated time.Time                // Date when the file was originally created.
+    Metadata    []webapi.ApiFileMetadata // Additional metadata tags.
+}
+
 // Touch abstracted function that creates a file
 // and adds the file to the warehouse and
 // blockchain
 // returns blockchain version and height
 func Touch(api *webapi.WebapiInstance, filePath string) (*TouchReturn, error) {
+    touchReturn, _, err := TouchWithOptions(api, filePath, nil)
+    return touchReturn, err
+}
+
+// TouchWithOptions abstracted function that creates
+// a file in the warehouse and adds it to the blockchain
+// with the provided options. The file type and format
+// are detected automatically. Only the file name is
+// published, use the virtual folder option to set a folder.
+// returns blockchain version and height and the file record
+func TouchWithOptions(api *webapi.WebapiInstance, filePath string, opts *TouchOptions) (*TouchReturn, *webapi.ApiFile, error) {
     // Creates a File in the warehouse
-    hash, _, err := api.Backend.UserWarehouse.CreateFileFromPath(filePath)
+    hash, _, err := api.Backend.UserWarehouse().CreateFileFromPath(filePath)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    files := []webapi.ApiFile{newTouchFile(filePath, hash, opts)}
+
+    touchReturn, err := publishFiles(api, files)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    return touchReturn, &files[0], nil
+}
+
+// TouchDir abstracted function that shares an entire directory
+// (including sub-directories). All files are added to the warehouse
+// and published together with matching virtual folders in one go.
+// The virtual folder is the base folder on the blockchain, if empty
+// the name of the directory is used. Files that cannot be added are
+// reported in the result and skipped. The progress callback is optional.
+func TouchDir(api *webapi.WebapiInstance, dirPath string, virtualFolder string, progress func(done, total int, path string)) (*webapi.ShareDirectoryResult, error) {
+    result, err := api.ShareDirectory(dirPath, virtualFolder, progress)
     if err != nil {
         return nil, err
+    } else if result.Status != blockchain.StatusOK {
+        return &result, blockchainError(result.Status)
     }
 
-    // Add the File to the local blockchain
-    var input webapi.ApiBlockAddFiles
-    var inputFiles []webapi.ApiFile
-    var inputFile webapi.ApiFile
+    return &result, nil
+}
 
-    // Write File information to the input File
-    inputFile.Date = time.Now()
-    // Folder and File name
-    dir, file := filepath.Split(filePath)
-    inputFile.Folder = dir
-    inputFile.Name = file
-    inputFile.ID = uuid.New()
-    inputFile.Hash = hash
+// TouchManyFile is the result of a single file shared via TouchMany
+type TouchManyFile struct {
+    Path string         // Path of the file on disk
+    File webapi.ApiFile // Published file record. Only valid if Err is nil.
+    Err  error          // Error importing or publishing the file
+}
 
-    // Get the public key of the current node
-    _, publicKey := api.Backend.ExportPrivateKey()
-    inputFile.NodeID = []byte(hex.EncodeToString(publicKey.SerializeCompressed()))
+// TouchManyReturn is the result of TouchMany
+type TouchManyReturn struct {
+    TouchReturn
+    Files []TouchManyFile // Results in the same order as the paths
+}
 
-    inputFiles = append(inputFiles, inputFile)
+// touchManyWorkers is the maximum count of files imported into the warehouse at the same time
+var touchManyWorkers = runtime.NumCPU()
+
+// TouchMany abstracted function that shares multiple
+// files in a single block. The files are imported into
+// the warehouse concurrently and then published in one
+// go. Files that cannot be imported are reported in the
+// result and skipped. If the block cannot be written the
+// imported data that is not referenced by any other file
+// is deleted from the warehouse again.
+// The options apply to all files, except the name which
+// is always the file name of the path.
+func TouchMany(api *webapi.WebapiInstance, paths []string, opts *TouchOptions) (*TouchManyReturn, error) {
+    result := &TouchManyReturn{Files: make([]TouchManyFile, len(paths))}
+    records := make([]*blockchain.BlockRecordFile, len(paths))
+
+    var options TouchOptions
+    if opts != nil {
+        options = *opts
+    }
+    options.Name = ""
+
+    // Import the files into the warehouse using a bounded worker pool.
+    jobs := make(chan int)
+    var wg sync.WaitGroup
+
+    for n := 0; n < touchManyWorkers && n < len(paths); n++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for index := range jobs {
+                result.Files[index], records[index] = touchImport(api, paths[index], &options)
+            }
+        }()
+    }
 
-    input.Files = inputFiles
+    for n := range paths {
+        jobs <- n
+    }
+    close(jobs)
+    wg.Wait()
 
     var filesAdd []blockchain.BlockRecordFile
+    for _, record := range records {
+        if record != nil {
+            filesAdd = append(filesAdd, *record)
+        }
+    }
+
+    _, result.BlockchainHeight, result.BlockchainVersion = api.Backend.UserBlockchain().Header()
+    if len(filesAdd) == 0 {
+        return result, nil
+    }
+
+    newHeight, newVersion, status := api.Backend.UserBlockchain().AddFiles(filesAdd)
+    if status == blockchain.StatusOK {
+        result.BlockchainHeight, result.BlockchainVersion = newHeight, newVersion
+        return result, nil
+    }
+
+    // Roll back the warehouse imports.
+    err := blockchainError(status)
+    var collected [][]byte
 
-    for _, File := range input.Files {
-        if len(File.Hash) != protocol.HashSize {
-            return nil, errors.New("bad request")
+    for n := range result.Files {
+        if records[n] == nil {
+            continue
+        }
+        result.Files[n].Err = err
+
+        if hash := records[n].Hash; !webapi.ContainsHash(collected, hash) {
+            if files, status := api.Backend.UserBlockchain().FileExists(hash); status == blockchain.StatusOK && len(files) == 0 {
+                api.Backend.UserWarehouse().DeleteFile(hash)
+                collected = append(collected, hash)
+            }
         }
+    }
+
+    return result, err
+}
+
+// touchImport imports the file into the warehouse and returns the block record to publish it.
+func touchImport(api *webapi.WebapiInstance, filePath string, opts *TouchOptions) (result TouchManyFile, record *blockchain.BlockRecordFile) {
+    result.Path = filePath
+
+    hash, status, err := api.Backend.UserWarehouse().CreateFileFromPath(filePath)
+    if err == nil && status != warehouse.StatusOK {
+        err = fmt.Errorf("%w: status %d", ErrNotInWarehouse, status)
+    }
+    if err != nil {
+        result.Err = err
+        return result, nil
+    }
+
+    result.File = newTouchFile(filePath, hash, opts)
+    result.File.NodeID = api.Backend.SelfNodeID()
+    if _, result.File.Size, _, err = api.Backend.UserWarehouse().FileExists(hash); err != nil {
+        result.Err = err
+        return result, nil
+    }
+
+    blockRecord := webapi.BlockRecordFileFromAPI(result.File)
+
+    // Set the merkle tree info as appropriate.
+    if !webapi.SetFileMerkleInfo(api.Backend, &blockRecord) {
+        result.Err = ErrMerkleInfo
+        return result, nil
+    }
+
+    return result, &blockRecord
+}
+
+// newTouchFile creates the file information to publish a file stored in the warehouse.
+func newTouchFile(filePath string, hash []byte, opts *TouchOptions) (file webapi.ApiFile) {
+    if opts == nil {
+        opts = &TouchOptions{}
+    }
+
+    file.ID = uuid.New()
+    file.Hash = hash
+    file.Date = time.Now()
+    file.Name = opts.Name
+    file.Folder = opts.Folder
+    file.Description = opts.Description
+    file.Metadata = append(file.Metadata, opts.Metadata...)
+
+    if file.Name == "" {
+        _, file.Name = filepath.Split(filePath)
+    }
+
+    if !opts.DateCreated.IsZero() {
+        file.Metadata = append(file.Metadata, webapi.ApiFileMetadata{Type: blockchain.TagDateCreated, Date: opts.DateCreated})
+    }
+
+    // Detect the File Type and Format. In case of error the type is binary.
+    fileType, fileFormat, _ := webapi.FileDetectType(filePath)
+    file.Type = uint8(fileType)
+    file.Format = fileFormat
+
+    return file
+}
+
+// publishFiles adds the files to the blockchain in a single call. The files must be already stored
+// in the Warehouse (virtual folders are exempt). The ID, size and node ID of the files are updated.
+func publishFiles(api *webapi.WebapiInstance, files []webapi.ApiFile) (*TouchReturn, error) {
+    var filesAdd []blockchain.BlockRecordFile
+
+    for n := range files {
+        File := &files[n]
+
         if File.ID == uuid.Nil { // if the ID is not provided by the caller, set it
             File.ID = uuid.New()
         }
 
         // Verify that the File exists in the warehouse. Folders are exempt from this check as they are only virtual.
         if !File.IsVirtualFolder() {
-            if _, err := warehouse.ValidateHash(File.Hash); err != nil {
-                return nil, errors.New("bad request when validating hash")
-            } else if _, fileInfo, status, _ := api.Backend.UserWarehouse.FileExists(File.Hash); status != warehouse.StatusOK {
-                //EncodeJSON(api.backend, w, r, apiBlockchainBlockStatus{Status: blockchain.StatusNotInWarehouse})
-                return nil, errors.New("file not in warehouse")
+            if len(File.Hash) != protocol.HashSize {
+                return nil, ErrInvalidHash
+            } else if _, err := warehouse.ValidateHash(File.Hash); err != nil {
+                return nil, ErrInvalidHash
+            } else if _, fileSize, status, _ := api.Backend.UserWarehouse().FileExists(File.Hash); status != warehouse.StatusOK {
+                return nil, ErrNotInWarehouse
             } else {
-                File.Size = fileInfo
+                File.Size = fileSize
             }
         } else {
             File.Hash = protocol.HashData(nil)
             File.Size = 0
         }
 
-        blockRecord := webapi.BlockRecordFileFromAPI(File)
+        File.NodeID = api.Backend.SelfNodeID()
+
+        blockRecord := webapi.BlockRecordFileFromAPI(*File)
 
         // Set the merkle tree info as appropriate.
         if !webapi.SetFileMerkleInfo(api.Backend, &blockRecord) {
-            return nil, errors.New("merkle information not set")
+            return nil, ErrMerkleInfo
         }
 
         filesAdd = append(filesAdd, blockRecord)
     }
 
-    newHeight, newVersion, _ := api.Backend.UserBlockchain.AddFiles(filesAdd)
+    newHeight, newVersion, status := api.Backend.UserBlockchain().AddFiles(filesAdd)
+    if status != blockchain.StatusOK {
+        return nil, blockchainError(status)
+    }
 
     // Creating object for custom return type
     var touchReturn TouchReturn
@@ -107,60 +298,222 @@ func Touch(api *webapi.WebapiInstance, filePath string) (*TouchReturn, error) {
     return &touchReturn, nil
 }
 
+// FilePatch is a partial update of a file record.
+// Nil fields are not changed, empty strings remove the value.
+type FilePatch struct {
+    Name        *string                  // New name of the file
+    Folder      *string                  // New virtual folder
+    Description *string                  // New description
+    AddTags     []webapi.ApiFileMetadata // Tags to add. Existing tags of the same type are replaced. Name, folder and description tags are set from the Text field, same as the fields above. Virtual tags are read-only and return ErrTagReadOnly.
+    RemoveTags  []uint16                 // Types of tags to remove. See blockchain.TagX.
+}
+
+// Update Abstracted function that applies the
+// patch to a file that is already published.
+// The hash and merkle information are kept intact.
+// returns blockchain version and height and the updated file record
+func Update(api *webapi.WebapiInstance, ID uuid.UUID, patch FilePatch) (*TouchReturn, *webapi.ApiFile, error) {
+    files, status := api.Backend.UserBlockchain().ListFiles()
+    if status != blockchain.StatusOK {
+        return nil, nil, blockchainError(status)
+    }
+
+    var record *blockchain.BlockRecordFile
+    for n := range files {
+        if files[n].ID == ID {
+            record = &files[n]
+            break
+        }
+    }
+    if record == nil {
+        return nil, nil, ErrFileNotFound
+    }
+
+    for _, meta := range patch.AddTags {
+        if blockchain.IsTagVirtual(meta.Type) {
+            return nil, nil, ErrTagReadOnly
+        }
+    }
+
+    for _, Type := range patch.RemoveTags {
+        removeTag(record, Type)
+    }
+
+    if patch.Name != nil {
+        setTextTag(record, blockchain.TagName, *patch.Name)
+    }
+    if patch.Folder != nil {
+        setTextTag(record, blockchain.TagFolder, *patch.Folder)
+    }
+    if patch.Description != nil {
+        setTextTag(record, blockchain.TagDescription, *patch.Description)
+    }
+
+    // Text tags mapped to fields are not converted by the API function, they are set directly.
+    var otherTags []webapi.ApiFileMetadata
+    for _, meta := range patch.AddTags {
+        switch meta.Type {
+        case blockchain.TagName, blockchain.TagFolder, blockchain.TagDescription:
+            setTextTag(record, meta.Type, meta.Text)
+        default:
+            otherTags = append(otherTags, meta)
+        }
+    }
+
+    // Reuse the API conversion for the metadata to tags mapping.
+    for _, tag := range webapi.BlockRecordFileFromAPI(webapi.ApiFile{Metadata: otherTags}).Tags {
+        removeTag(record, tag.Type)
+        record.Tags = append(record.Tags, tag)
+    }
+
+    newHeight, newVersion, status := api.Backend.UserBlockchain().ReplaceFiles([]blockchain.BlockRecordFile{*record})
+    if status != blockchain.StatusOK {
+        return nil, nil, blockchainError(status)
+    }
+
+    file := webapi.BlockRecordFileToAPI(*record)
+
+    return &TouchReturn{BlockchainHeight: newHeight, BlockchainVersion: newVersion}, &file, nil
+}
+
+// setTextTag sets the text tag. If the text is empty, the tag is removed.
+func setTextTag(record *blockchain.BlockRecordFile, Type uint16, text string) {
+    removeTag(record, Type)
+
+    if text != "" {
+        record.Tags = append(record.Tags, blockchain.TagFromText(Type, text))
+    }
+}
+
+// removeTag removes all tags of the given type
+func removeTag(record *blockchain.BlockRecordFile, Type uint16) {
+    var tags []blockchain.BlockRecordFileTag
+    for _, tag := range record.Tags {
+        if tag.Type != Type {
+            tags = append(tags, tag)
+        }
+    }
+
+    record.Tags = tags
+}
+
+// RmReturn is the result of removing files
+type RmReturn struct {
+    BlockchainHeight  uint64
+    BlockchainVersion uint64
+    DeletedFiles      []webapi.ApiFile // Records deleted from the blockchain
+    CollectedHashes   [][]byte         // Hashes of files deleted from the warehouse since there were no other references
+}
+
 // Rm Abstracted function that
 // removes file from the blockchain and warehouse
-func Rm(api *webapi.WebapiInstance, hashStr string) error {
-    ID, err := uuid.FromBytes([]byte(hashStr))
+// The ID is the textual file ID (UUID).
+func Rm(api *webapi.WebapiInstance, idStr string) (*RmReturn, error) {
+    ID, err := uuid.Parse(idStr)
     if err != nil {
-        return err
+        return nil, err
     }
+
+    return RmID(api, ID)
+}
+
+// RmID Abstracted function that removes the
+// file identified by its ID from the blockchain
+// and warehouse
+func RmID(api *webapi.WebapiInstance, ID uuid.UUID) (*RmReturn, error) {
+    return rmFiles(api, []uuid.UUID{ID})
+}
+
+// RmHash Abstracted function that removes every
+// file record that references the content hash
+// from the blockchain and the file from the warehouse
+func RmHash(api *webapi.WebapiInstance, hash []byte) (*RmReturn, error) {
+    files, status := api.Backend.UserBlockchain().FileExists(hash)
+    if status != blockchain.StatusOK {
+        return nil, blockchainError(status)
+    }
+
     var UUIDs []uuid.UUID
-    UUIDs = append(UUIDs, ID)
+    for n := range files {
+        UUIDs = append(UUIDs, files[n].ID)
+    }
 
-    _, _, deletedFiles, status := api.Backend.UserBlockchain.DeleteFiles(UUIDs)
+    return rmFiles(api, UUIDs)
+}
 
-    // If successfully deleted from the blockchain, delete from the Warehouse in case there are no other references.
-    if status == blockchain.StatusOK {
-        for n := range deletedFiles {
-            if files, status := api.Backend.UserBlockchain.FileExists(deletedFiles[n].Hash); status == blockchain.StatusOK && len(files) == 0 {
-                api.Backend.UserWarehouse.DeleteFile(deletedFiles[n].Hash)
-            }
+// RmFolder Abstracted function that removes the
+// virtual folder and everything under it from the
+// blockchain and warehouse. The folder is the full
+// path of the virtual folder, for example "docs/2022".
+func RmFolder(api *webapi.WebapiInstance, folder string) (*RmReturn, error) {
+    folder = webapi.CleanFolder(folder)
+    if folder == "" {
+        return nil, ErrFileNotFound
+    }
+
+    files, status := api.Backend.UserBlockchain().ListFiles()
+    if status != blockchain.StatusOK {
+        return nil, blockchainError(status)
+    }
+
+    var UUIDs []uuid.UUID
+    for n := range files {
+        file := webapi.BlockRecordFileToAPI(files[n])
+
+        if webapi.IsInFolder(webapi.CleanFolder(file.Folder), folder) || (file.IsVirtualFolder() && webapi.CleanFolder(path.Join(file.Folder, file.Name)) == folder) {
+            UUIDs = append(UUIDs, file.ID)
         }
     }
 
-    return nil
+    return rmFiles(api, UUIDs)
 }
 
-// Search Abstracted function
-// to query for files available
-// in the p2p network (i.e the
-// Peernet protocol)
-// Since it's default it's ran for
-// 5 seconds as the default timeout
-// (This will be changed on later
-// iterations)
-func Search(api *webapi.WebapiInstance, term string) (*webapi.SearchResult, error) {
-    var input webapi.SearchRequest
-    input.Term = term
-    input.Timeout = 5
-    jobID, err := StartSearch(api, &input)
-    if err != nil {
-        return nil, err
+// rmFiles deletes the files from the blockchain. Files in the warehouse are deleted in case there are no other references.
+func rmFiles(api *webapi.WebapiInstance, UUIDs []uuid.UUID) (*RmReturn, error) {
+    if len(UUIDs) == 0 {
+        return nil, ErrFileNotFound
     }
 
-    // Running search
+    newHeight, newVersion, deletedFiles, status := api.Backend.UserBlockchain().DeleteFiles(UUIDs)
+    if status != blockchain.StatusOK {
+        return nil, blockchainError(status)
+    } else if len(deletedFiles) == 0 {
+        return nil, ErrFileNotFound
+    }
 
-    // 6 seconds
-    time.Sleep(time.Millisecond * 6000)
+    result := &RmReturn{BlockchainHeight: newHeight, BlockchainVersion: newVersion}
 
-    result, err := SearchResult(api, jobID)
-    if err != nil {
-        return nil, err
+    // If successfully deleted from the blockchain, delete from the Warehouse in case there are no other references.
+    for n := range deletedFiles {
+        file := webapi.BlockRecordFileToAPI(*deletedFiles[n])
+        result.DeletedFiles = append(result.DeletedFiles, file)
+
+        if file.IsVirtualFolder() || webapi.ContainsHash(result.CollectedHashes, file.Hash) {
+            continue
+        }
+
+        if files, status := api.Backend.UserBlockchain().FileExists(file.Hash); status == blockchain.StatusOK && len(files) == 0 {
+            if status, _ := api.Backend.UserWarehouse().DeleteFile(file.Hash); status == warehouse.StatusOK {
+                result.CollectedHashes = append(result.CollectedHashes, file.Hash)
+            }
+        }
     }
 
     return result, nil
 }
 
+// Search Abstracted function
+// to query for files available
+// in the p2p network (i.e the
+// Peernet protocol)
+// It blocks until the search is
+// terminated and returns all results.
+// See SearchContext for cancellation
+// and search options.
+func Search(api *webapi.WebapiInstance, term string) (*webapi.SearchResult, error) {
+    return SearchContext(context.Background(), api, term, nil)
+}
+
 // StartSearch Abstracted function that
 // starts the search job based on specified
 // parameters and return the job ID
@@ -186,11 +539,16 @@ func StartSearch(api *webapi.WebapiInstance, input *webapi.SearchRequest) (uuid.
     return job.ID, nil
 }
 
+// SearchResult Abstracted function that returns the next
+// available results of the search job. The returned result
+// always carries the status together with any files.
+// If no files are returned, the error indicates the reason
+// (ErrNoResultsYet, ErrSearchTerminated, ErrNoIndex, ...).
 func SearchResult(api *webapi.WebapiInstance, jobID uuid.UUID) (*webapi.SearchResult, error) {
     // find the job ID
     job := api.JobLookup(jobID)
     if job == nil {
-        return nil, errors.New("job id not found")
+        return &webapi.SearchResult{Status: 2, Files: []webapi.ApiFile{}}, ErrJobNotFound
     }
 
     limit := 100
@@ -212,26 +570,26 @@ func SearchResult(api *webapi.WebapiInstance, jobID uuid.UUID) (*webapi.SearchRe
     if len(result.Files) > 0 {
         if job.IsSearchResults() {
             result.Status = 0 // 0 = Success with results
-            return &result, nil
         } else {
             result.Status = 1 // No more results to expect
-            return nil, errors.New("no more results to expect (Search still running)")
-        }
-    } else {
-        switch job.Status {
-        case webapi.SearchStatusLive:
-            result.Status = 3 // No results yet available keep trying
-            return nil, errors.New("no results yet available keep trying")
-        case webapi.SearchStatusTerminated:
-            result.Status = 1 // No more results to expect
-            return nil, errors.New("no more results to expect (Search terminated)")
-        default: // SearchStatusNoIndex, SearchStatusNotStarted
-            result.Status = 1 // No more results to expect
-            return nil, errors.New("no more results to expect (Search not started)")
         }
+        return &result, nil
     }
 
-    return nil, errors.New("search not successful")
+    switch job.Status {
+    case webapi.SearchStatusLive:
+        result.Status = 3 // No results yet available keep trying
+        return &result, ErrNoResultsYet
+    case webapi.SearchStatusTerminated:
+        result.Status = 1 // No more results to expect
+        return &result, ErrSearchTerminated
+    case webapi.SearchStatusNoIndex:
+        result.Status = 1 // No more results to expect
+        return &result, ErrNoIndex
+    default: // SearchStatusNotStarted
+        result.Status = 1 // No more results to expect
+        return &result, ErrSearchNotStarted
+    }
 }
 
 // Download and abstracted function that starts downloading a file
@@ -242,33 +600,20 @@ func Download(api *webapi.WebapiInstance, hashStr string, nodeIDStr string, path
     hash, valid1 := webapi.DecodeBlake3Hash(hashStr)
     nodeID, valid2 := webapi.DecodeBlake3Hash(nodeIDStr)
     if !valid1 || !valid2 {
-        //http.Error(w, "", http.StatusBadRequest)
-        return nil, errors.New("hash or node ID was not valid")
+        return nil, ErrInvalidHash
     }
 
     filePath := path
     if filePath == "" {
-        // http.Error(w, "", http.StatusBadRequest)
-        return nil, errors.New("file path not provided")
+        return nil, ErrNoFilePath
     }
 
-    ID := uuid.New()
-
-    info := &webapi.DownloadInfo{Backend: api.Backend, Api: api, ID: ID, Created: time.Now(), Hash: hash, NodeID: nodeID}
-
-    // create the file immediately
-    err := info.InitDiskFile(filePath)
+    info, err := api.DownloadStart(hash, nodeID, filePath)
     if err != nil {
         return nil, err
     }
 
-    // add the download to the list
-    api.DownloadAdd(info)
-
-    // start the download!
-    go info.Start()
-
-    return &ID, nil
+    return &info.ID, nil
 }
 
 // DownloadStatus Abstracted function that finds the status of a downloaded files
@@ -277,28 +622,49 @@ func DownloadStatus(api *webapi.WebapiInstance, DownloadID *uuid.UUID) (*webapi.
 
     info := api.DownloadLookup(*DownloadID)
     if info == nil {
-        //EncodeJSON(api.Backend, w, r, apiResponseDownloadStatus{APIStatus: DownloadResponseIDNotFound})
-        return nil, errors.New("download ID not found")
+        return nil, ErrDownloadNotFound
     }
 
-    info.RLock()
+    response := info.StatusResponse()
 
-    response := webapi.ApiResponseDownloadStatus{APIStatus: webapi.DownloadResponseSuccess, ID: info.ID, DownloadStatus: info.Status}
+    return &response, nil
+}
 
-    if info.Status >= webapi.DownloadWaitSwarm {
-        response.File = info.File
+// DownloadWait Abstracted function that blocks until the download
+// is finished or canceled, or the context is cancelled.
+// It returns nil if the download finished, ErrDownloadCanceled if it
+// was canceled, ErrDownloadVerifyFailed if the downloaded data did not
+// match the hash, or the context error.
+func DownloadWait(ctx context.Context, api *webapi.WebapiInstance, DownloadID *uuid.UUID) error {
+    info := api.DownloadLookup(*DownloadID)
+    if info == nil {
+        return ErrDownloadNotFound
+    }
 
-        response.Progress.TotalSize = info.File.Size
-        response.Progress.DownloadedSize = info.DiskFile.StoredSize
+    events, unsubscribe := info.Subscribe()
+    defer unsubscribe()
 
-        response.Progress.Percentage = math.Round(float64(info.DiskFile.StoredSize)/float64(info.File.Size)*100*100) / 100
-    }
+    status := webapi.DownloadWaitMetadata
 
-    if info.Status >= webapi.DownloadActive {
-        response.Swarm.CountPeers = info.Swarm.CountPeers
-    }
+    for {
+        select {
+        case event, ok := <-events:
+            if ok {
+                status = event.Status
+                continue
+            }
 
-    info.RUnlock()
+            // The channel is closed after the final event.
+            switch status {
+            case webapi.DownloadFinished:
+                return nil
+            case webapi.DownloadVerifyFailed:
+                return ErrDownloadVerifyFailed
+            }
+            return ErrDownloadCanceled
 
-    return &response, nil
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    }
 }
@@ -0,0 +1,334 @@
+/*
+File Name:  files_test.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+package Abstrations
+
+import (
+    "bytes"
+    "context"
+    "encoding/hex"
+    "errors"
+    "os"
+    "path"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/Abstraction/webapitest"
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/PeernetOfficial/core/warehouse"
+    "github.com/google/uuid"
+)
+
+func TestDownloadWait(t *testing.T) {
+    for _, test := range []struct {
+        corrupt bool
+        err     error
+    }{
+        {false, nil},
+        {true, ErrDownloadVerifyFailed},
+    } {
+        backend := webapitest.NewBackend()
+        api, server := webapitest.NewServer(backend, uuid.Nil)
+
+        peer := backend.AddPeer()
+        peer.Corrupt = test.corrupt
+        file := peer.AddFile(webapi.ApiFile{Name: "a.txt"}, []byte("downloaded data"))
+
+        id, err := Download(api, hex.EncodeToString(file.Hash), hex.EncodeToString(file.NodeID), filepath.Join(t.TempDir(), "a.txt"))
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        err = DownloadWait(ctx, api, id)
+        cancel()
+        server.Close()
+
+        if err != test.err {
+            t.Fatalf("corrupt %t: DownloadWait returned %v, expected %v", test.corrupt, err, test.err)
+        }
+    }
+}
+
+func TestTouchMany(t *testing.T) {
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    directory := t.TempDir()
+    for name, data := range map[string]string{"a.txt": "same data", "b.txt": "same data", "c.txt": "other data"} {
+        if err := os.WriteFile(filepath.Join(directory, name), []byte(data), 0666); err != nil {
+            t.Fatal(err)
+        }
+    }
+    paths := []string{filepath.Join(directory, "a.txt"), filepath.Join(directory, "missing.txt"), filepath.Join(directory, "b.txt"), filepath.Join(directory, "c.txt")}
+
+    result, err := TouchMany(api, paths, &TouchOptions{Folder: "docs", Name: "ignored"})
+    if err != nil {
+        t.Fatal(err)
+    } else if len(result.Files) != len(paths) || result.BlockchainHeight != 1 {
+        t.Fatalf("%d results, height %d", len(result.Files), result.BlockchainHeight)
+    }
+
+    // The results are in the order of the paths. The missing file is skipped.
+    for n, file := range result.Files {
+        if file.Path != paths[n] {
+            t.Fatalf("result %d for '%s', expected '%s'", n, file.Path, paths[n])
+        } else if (file.Err != nil) != (n == 1) {
+            t.Fatalf("file '%s' error %v", file.Path, file.Err)
+        } else if file.Err == nil && (file.File.Name != filepath.Base(paths[n]) || file.File.Folder != "docs") {
+            t.Fatalf("file '%s' published as '%s/%s'", file.Path, file.File.Folder, file.File.Name)
+        }
+    }
+
+    if files, _ := backend.Blockchain.ListFiles(); len(files) != 3 {
+        t.Fatalf("%d files published", len(files))
+    }
+}
+
+func TestTouchManyRollback(t *testing.T) {
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    directory := t.TempDir()
+    for name, data := range map[string]string{"shared.txt": "shared data", "new.txt": "new data"} {
+        if err := os.WriteFile(filepath.Join(directory, name), []byte(data), 0666); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    // The data of shared.txt is already published by another file.
+    if _, err := Touch(api, filepath.Join(directory, "shared.txt")); err != nil {
+        t.Fatal(err)
+    }
+    _, height, version := backend.Blockchain.Header()
+
+    backend.Blockchain.FailStatus = blockchain.StatusCorruptBlockRecord
+    result, err := TouchMany(api, []string{filepath.Join(directory, "shared.txt"), filepath.Join(directory, "new.txt")}, nil)
+    if !errors.Is(err, ErrBlockchain) {
+        t.Fatalf("TouchMany returned %v", err)
+    } else if result.BlockchainHeight != height || result.BlockchainVersion != version {
+        t.Fatalf("height %d version %d, expected %d %d", result.BlockchainHeight, result.BlockchainVersion, height, version)
+    }
+    for _, file := range result.Files {
+        if !errors.Is(file.Err, ErrBlockchain) {
+            t.Errorf("file '%s' error %v", file.Path, file.Err)
+        }
+    }
+
+    // Only the data that is not referenced by any other file is deleted.
+    if _, _, status, _ := backend.Warehouse.FileExists(protocol.HashData([]byte("new data"))); status == warehouse.StatusOK {
+        t.Error("data of the new file still in the warehouse")
+    }
+    if _, _, status, _ := backend.Warehouse.FileExists(protocol.HashData([]byte("shared data"))); status != warehouse.StatusOK {
+        t.Error("data of the published file deleted")
+    }
+    if files, _ := backend.Blockchain.ListFiles(); len(files) != 1 {
+        t.Fatalf("%d files published", len(files))
+    }
+}
+
+// fileTags returns the metadata of the file by type
+func fileTags(file *webapi.ApiFile) (tags map[uint16][]webapi.ApiFileMetadata) {
+    tags = make(map[uint16][]webapi.ApiFileMetadata)
+    for _, meta := range file.Metadata {
+        tags[meta.Type] = append(tags[meta.Type], meta)
+    }
+
+    return tags
+}
+
+func TestUpdate(t *testing.T) {
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    filePath := filepath.Join(t.TempDir(), "a.txt")
+    if err := os.WriteFile(filePath, []byte("updated data"), 0666); err != nil {
+        t.Fatal(err)
+    }
+
+    created := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+    touched, err := TouchMany(api, []string{filePath}, &TouchOptions{Folder: "docs", Description: "old description", DateCreated: created})
+    if err != nil {
+        t.Fatal(err)
+    }
+    original := touched.Files[0].File
+
+    const tagCustom = 200 // not used by the blockchain package
+
+    // Nil fields are kept, empty strings remove the value.
+    name, description := "b.txt", ""
+    _, file, err := Update(api, original.ID, FilePatch{Name: &name, Description: &description, AddTags: []webapi.ApiFileMetadata{{Type: tagCustom, Blob: []byte("first")}}})
+    if err != nil {
+        t.Fatal(err)
+    } else if file.Name != "b.txt" || file.Folder != "docs" || file.Description != "" || !bytes.Equal(file.Hash, original.Hash) || file.Size != original.Size {
+        t.Fatalf("updated file %+v", file)
+    }
+
+    // Existing tags of the same type are replaced. Name, folder and description tags set the fields.
+    later := created.Add(time.Hour)
+    _, file, err = Update(api, original.ID, FilePatch{AddTags: []webapi.ApiFileMetadata{
+        {Type: tagCustom, Blob: []byte("second")},
+        {Type: blockchain.TagDateCreated, Date: later},
+        {Type: blockchain.TagFolder, Text: "archive"},
+        {Type: blockchain.TagDescription, Text: "new description"},
+    }})
+    if err != nil {
+        t.Fatal(err)
+    }
+    tags := fileTags(file)
+    if len(tags[tagCustom]) != 1 || !bytes.Equal(tags[tagCustom][0].Blob, []byte("second")) {
+        t.Fatalf("custom tags %+v", tags[tagCustom])
+    } else if len(tags[blockchain.TagDateCreated]) != 1 || !tags[blockchain.TagDateCreated][0].Date.Equal(later) {
+        t.Fatalf("date created tags %+v", tags[blockchain.TagDateCreated])
+    } else if file.Name != "b.txt" || file.Folder != "archive" || file.Description != "new description" {
+        t.Fatalf("updated file %+v", file)
+    }
+
+    // removing tags
+    empty := ""
+    if _, file, err = Update(api, original.ID, FilePatch{Folder: &empty, RemoveTags: []uint16{tagCustom, blockchain.TagDateCreated}}); err != nil {
+        t.Fatal(err)
+    }
+    tags = fileTags(file)
+    if len(tags[tagCustom]) != 0 || len(tags[blockchain.TagDateCreated]) != 0 || file.Folder != "" || file.Name != "b.txt" {
+        t.Fatalf("updated file %+v", file)
+    }
+
+    // Virtual tags are read-only. The file is not changed.
+    _, height, version := backend.Blockchain.Header()
+    if _, _, err = Update(api, original.ID, FilePatch{Name: &name, AddTags: []webapi.ApiFileMetadata{{Type: blockchain.TagSharedByCount, Number: 5}}}); err != ErrTagReadOnly {
+        t.Fatalf("setting a virtual tag returned %v", err)
+    }
+    if _, newHeight, newVersion := backend.Blockchain.Header(); newHeight != height || newVersion != version {
+        t.Fatal("blockchain changed by rejected update")
+    }
+
+    if _, _, err = Update(api, uuid.New(), FilePatch{Name: &name}); err != ErrFileNotFound {
+        t.Fatalf("updating unknown file returned %v", err)
+    }
+
+    files, _ := backend.Blockchain.ListFiles()
+    if len(files) != 1 || files[0].ID != original.ID {
+        t.Fatalf("%d files on the blockchain", len(files))
+    }
+}
+
+// rmPublish shares the files with the data in the virtual folders. The key is the virtual path of the file.
+func rmPublish(t *testing.T, api *webapi.WebapiInstance, files map[string]string) (IDs map[string]uuid.UUID) {
+    t.Helper()
+
+    directory := t.TempDir()
+    IDs = make(map[string]uuid.UUID)
+
+    for virtual, data := range files {
+        folder, name := path.Split(virtual)
+        filePath := filepath.Join(directory, uuid.NewString()+"-"+name)
+        if err := os.WriteFile(filePath, []byte(data), 0666); err != nil {
+            t.Fatal(err)
+        }
+
+        touched, err := TouchMany(api, []string{filePath}, &TouchOptions{Folder: webapi.CleanFolder(folder)})
+        if err != nil {
+            t.Fatal(err)
+        }
+        IDs[virtual] = touched.Files[0].File.ID
+    }
+
+    return IDs
+}
+
+// rmCheck verifies the deleted files and collected hashes
+func rmCheck(t *testing.T, result *RmReturn, err error, deleted []uuid.UUID, collected [][]byte) {
+    t.Helper()
+
+    if err != nil {
+        t.Fatal(err)
+    } else if len(result.DeletedFiles) != len(deleted) || len(result.CollectedHashes) != len(collected) {
+        t.Fatalf("%d files deleted and %d hashes collected, expected %d and %d", len(result.DeletedFiles), len(result.CollectedHashes), len(deleted), len(collected))
+    }
+
+    for _, ID := range deleted {
+        found := false
+        for _, file := range result.DeletedFiles {
+            found = found || file.ID == ID
+        }
+        if !found {
+            t.Errorf("file %s not deleted", ID.String())
+        }
+    }
+    for _, hash := range collected {
+        if !webapi.ContainsHash(result.CollectedHashes, hash) {
+            t.Errorf("hash %s not collected", hex.EncodeToString(hash))
+        }
+    }
+}
+
+func TestRm(t *testing.T) {
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    IDs := rmPublish(t, api, map[string]string{
+        "a.txt":               "shared data",
+        "docs/b.txt":          "shared data",
+        "docs/c.txt":          "docs data",
+        "docs/2022/d.txt":     "docs data",
+        "docs/2022/e.txt":     "nested data",
+        "docsother/f.txt":     "other data",
+        "copies/g.txt":        "copy data",
+        "copies/nested/h.txt": "copy data",
+    })
+    shared, docs, nested, other, copied := protocol.HashData([]byte("shared data")), protocol.HashData([]byte("docs data")), protocol.HashData([]byte("nested data")), protocol.HashData([]byte("other data")), protocol.HashData([]byte("copy data"))
+
+    // The hash is still referenced by docs/b.txt, it is not collected.
+    result, err := RmID(api, IDs["a.txt"])
+    rmCheck(t, result, err, []uuid.UUID{IDs["a.txt"]}, nil)
+    if _, _, status, _ := backend.Warehouse.FileExists(shared); status != warehouse.StatusOK {
+        t.Fatal("referenced data deleted from the warehouse")
+    }
+
+    // The folder includes sub-folders, but not folders that only share the prefix. Data referenced by multiple removed files is collected once.
+    result, err = RmFolder(api, "/docs/")
+    rmCheck(t, result, err, []uuid.UUID{IDs["docs/b.txt"], IDs["docs/c.txt"], IDs["docs/2022/d.txt"], IDs["docs/2022/e.txt"]}, [][]byte{shared, docs, nested})
+    for _, hash := range [][]byte{shared, docs, nested} {
+        if _, _, status, _ := backend.Warehouse.FileExists(hash); status == warehouse.StatusOK {
+            t.Errorf("data %s still in the warehouse", hex.EncodeToString(hash))
+        }
+    }
+    if _, _, status, _ := backend.Warehouse.FileExists(other); status != warehouse.StatusOK {
+        t.Fatal("data of a file outside the folder deleted")
+    }
+
+    // All files with the hash are removed.
+    result, err = RmHash(api, copied)
+    rmCheck(t, result, err, []uuid.UUID{IDs["copies/g.txt"], IDs["copies/nested/h.txt"]}, [][]byte{copied})
+
+    result, err = Rm(api, IDs["docsother/f.txt"].String())
+    rmCheck(t, result, err, []uuid.UUID{IDs["docsother/f.txt"]}, [][]byte{other})
+
+    // nothing left to remove
+    if _, err = RmID(api, IDs["a.txt"]); err != ErrFileNotFound {
+        t.Errorf("removing deleted file returned %v", err)
+    }
+    if _, err = RmHash(api, copied); err != ErrFileNotFound {
+        t.Errorf("removing deleted hash returned %v", err)
+    }
+    if _, err = RmFolder(api, "docs"); err != ErrFileNotFound {
+        t.Errorf("removing deleted folder returned %v", err)
+    }
+    if _, err = RmFolder(api, "/"); err != ErrFileNotFound {
+        t.Errorf("removing the root returned %v", err)
+    }
+    if _, err = Rm(api, "not-a-uuid"); err == nil {
+        t.Error("invalid ID accepted")
+    }
+}
@@ -3,20 +3,20 @@ module github.com/PeernetOfficial/Abstraction
 go 1.19
 
 require (
+	github.com/IncSW/geoip2 v0.1.2
 	github.com/PeernetOfficial/core v0.0.0-20221101165801-6989ef4a19c5
 	github.com/google/uuid v1.3.0
+	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/websocket v1.5.0
+	golang.org/x/net v0.0.0-20221014081412-f15817d10f9b
+	lukechampine.com/blake3 v1.1.7
 )
 
 require (
-	github.com/IncSW/geoip2 v0.1.2 // indirect
 	github.com/akrylysov/pogreb v0.10.1 // indirect
 	github.com/enfipy/locker v1.1.0 // indirect
-	github.com/gorilla/mux v1.8.0 // indirect
-	github.com/gorilla/websocket v1.5.0 // indirect
 	github.com/klauspost/cpuid/v2 v2.1.2 // indirect
 	golang.org/x/crypto v0.0.0-20221012134737-56aed061732a // indirect
-	golang.org/x/net v0.0.0-20221014081412-f15817d10f9b // indirect
 	golang.org/x/sys v0.0.0-20221013171732-95e765b1cc43 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
-	lukechampine.com/blake3 v1.1.7 // indirect
 )
@@ -0,0 +1,137 @@
+/*
+File Name:  peernet.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+package Abstrations
+
+import (
+    "context"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/google/uuid"
+)
+
+/*
+The interfaces below cover the abstracted functions independent of the backend.
+Application code should depend on them instead of *webapi.WebapiInstance:
+
+    Embedded            runs the functions against an embedded backend (this package)
+    client.Client       runs the functions against a running web API over HTTP
+    peernettest.Fake    deterministic in-memory implementation for tests
+*/
+
+// Searcher searches files in the Peernet network.
+type Searcher interface {
+    Search(term string) (*webapi.SearchResult, error)
+    SearchContext(ctx context.Context, term string, opts *webapi.SearchRequest) (*webapi.SearchResult, error)
+    StartSearch(input *webapi.SearchRequest) (uuid.UUID, error)
+    SearchResult(jobID uuid.UUID) (*webapi.SearchResult, error)
+}
+
+// Downloader downloads files from the Peernet network.
+type Downloader interface {
+    Download(hashStr string, nodeIDStr string, path string) (*uuid.UUID, error)
+    DownloadStatus(DownloadID *uuid.UUID) (*webapi.ApiResponseDownloadStatus, error)
+    DownloadWait(ctx context.Context, DownloadID *uuid.UUID) error
+}
+
+// Sharer shares files on the users blockchain.
+type Sharer interface {
+    Touch(filePath string) (*TouchReturn, error)
+    Rm(idStr string) (*RmReturn, error)
+}
+
+// ProfileStore reads and writes the users profile.
+type ProfileStore interface {
+    ProfileList() ([]webapi.ApiBlockRecordProfile, error)
+    ProfileRead(field uint16) (*webapi.ApiBlockRecordProfile, error)
+    ProfileWrite(fields []webapi.ApiBlockRecordProfile) (*TouchReturn, error)
+    ProfileDelete(fields []uint16) (*TouchReturn, error)
+}
+
+// Peernet combines all interfaces.
+type Peernet interface {
+    Searcher
+    Downloader
+    Sharer
+    ProfileStore
+}
+
+// Embedded implements the interfaces using the embedded backend of the web API instance.
+type Embedded struct {
+    API *webapi.WebapiInstance
+}
+
+var _ Peernet = (*Embedded)(nil)
+
+// NewEmbedded returns the implementation of the interfaces for the web API instance.
+func NewEmbedded(api *webapi.WebapiInstance) *Embedded {
+    return &Embedded{API: api}
+}
+
+// Search see the function Search.
+func (e *Embedded) Search(term string) (*webapi.SearchResult, error) {
+    return Search(e.API, term)
+}
+
+// SearchContext see the function SearchContext.
+func (e *Embedded) SearchContext(ctx context.Context, term string, opts *webapi.SearchRequest) (*webapi.SearchResult, error) {
+    return SearchContext(ctx, e.API, term, opts)
+}
+
+// StartSearch see the function StartSearch.
+func (e *Embedded) StartSearch(input *webapi.SearchRequest) (uuid.UUID, error) {
+    return StartSearch(e.API, input)
+}
+
+// SearchResult see the function SearchResult.
+func (e *Embedded) SearchResult(jobID uuid.UUID) (*webapi.SearchResult, error) {
+    return SearchResult(e.API, jobID)
+}
+
+// Download see the function Download.
+func (e *Embedded) Download(hashStr string, nodeIDStr string, path string) (*uuid.UUID, error) {
+    return Download(e.API, hashStr, nodeIDStr, path)
+}
+
+// DownloadStatus see the function DownloadStatus.
+func (e *Embedded) DownloadStatus(DownloadID *uuid.UUID) (*webapi.ApiResponseDownloadStatus, error) {
+    return DownloadStatus(e.API, DownloadID)
+}
+
+// DownloadWait see the function DownloadWait.
+func (e *Embedded) DownloadWait(ctx context.Context, DownloadID *uuid.UUID) error {
+    return DownloadWait(ctx, e.API, DownloadID)
+}
+
+// Touch see the function Touch.
+func (e *Embedded) Touch(filePath string) (*TouchReturn, error) {
+    return Touch(e.API, filePath)
+}
+
+// Rm see the function Rm.
+func (e *Embedded) Rm(idStr string) (*RmReturn, error) {
+    return Rm(e.API, idStr)
+}
+
+// ProfileList see the function ProfileList.
+func (e *Embedded) ProfileList() ([]webapi.ApiBlockRecordProfile, error) {
+    return ProfileList(e.API)
+}
+
+// ProfileRead see the function ProfileRead.
+func (e *Embedded) ProfileRead(field uint16) (*webapi.ApiBlockRecordProfile, error) {
+    return ProfileRead(e.API, field)
+}
+
+// ProfileWrite see the function ProfileWrite.
+func (e *Embedded) ProfileWrite(fields []webapi.ApiBlockRecordProfile) (*TouchReturn, error) {
+    return ProfileWrite(e.API, fields)
+}
+
+// ProfileDelete see the function ProfileDelete.
+func (e *Embedded) ProfileDelete(fields []uint16) (*TouchReturn, error) {
+    return ProfileDelete(e.API, fields)
+}
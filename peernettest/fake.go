@@ -0,0 +1,365 @@
+/*
+File Name:  fake.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+/*
+Package peernettest provides a deterministic in-memory implementation of the
+abstraction interfaces for tests. It does not use the network or the disk
+except for reading shared files and writing downloaded files.
+
+Search results and downloadable files are scripted:
+
+    fake := peernettest.New()
+    fake.AddSearchResult("space", file1, file2)
+    fake.AddDownload(file1.Hash, []byte("content"))
+*/
+package peernettest
+
+import (
+    "bytes"
+    "context"
+    "encoding/hex"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    Abstrations "github.com/PeernetOfficial/Abstraction"
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/google/uuid"
+)
+
+// Fake is an in-memory implementation of Abstrations.Peernet. It is safe for concurrent use.
+type Fake struct {
+    NodeID []byte // Node ID used for shared files.
+
+    searchResults map[string][]webapi.ApiFile // scripted search results by lower case term
+    data          map[string][]byte           // downloadable data by hex hash
+    files         []webapi.ApiFile            // shared files
+    profile       map[uint16]webapi.ApiBlockRecordProfile
+    height        uint64
+    version       uint64
+    jobs          map[uuid.UUID][]webapi.ApiFile // remaining results of search jobs
+    downloads     map[uuid.UUID]*webapi.ApiResponseDownloadStatus
+    mutex         sync.Mutex
+}
+
+var _ Abstrations.Peernet = (*Fake)(nil)
+
+// searchResultLimit is the count of results returned by SearchResult, same as the API default
+const searchResultLimit = 100
+
+// New creates a new empty fake.
+func New() *Fake {
+    return &Fake{
+        NodeID:        protocol.HashData([]byte("peernettest")),
+        searchResults: make(map[string][]webapi.ApiFile),
+        data:          make(map[string][]byte),
+        profile:       make(map[uint16]webapi.ApiBlockRecordProfile),
+        jobs:          make(map[uuid.UUID][]webapi.ApiFile),
+        downloads:     make(map[uuid.UUID]*webapi.ApiResponseDownloadStatus),
+    }
+}
+
+// AddSearchResult scripts the files returned when searching for the term. The term is not case sensitive.
+func (fake *Fake) AddSearchResult(term string, files ...webapi.ApiFile) {
+    fake.mutex.Lock()
+    defer fake.mutex.Unlock()
+
+    term = strings.ToLower(term)
+    fake.searchResults[term] = append(fake.searchResults[term], files...)
+}
+
+// AddDownload scripts the data returned when downloading the hash. Downloads of unknown hashes are canceled.
+func (fake *Fake) AddDownload(hash []byte, data []byte) {
+    fake.mutex.Lock()
+    defer fake.mutex.Unlock()
+
+    fake.data[hex.EncodeToString(hash)] = data
+}
+
+// Files returns all shared files.
+func (fake *Fake) Files() []webapi.ApiFile {
+    fake.mutex.Lock()
+    defer fake.mutex.Unlock()
+
+    return append([]webapi.ApiFile{}, fake.files...)
+}
+
+// --- Searcher ---
+
+// Search returns all scripted results for the term.
+func (fake *Fake) Search(term string) (*webapi.SearchResult, error) {
+    return fake.SearchContext(context.Background(), term, nil)
+}
+
+// SearchContext returns the scripted results for the term, limited to opts.MaxResults if set.
+func (fake *Fake) SearchContext(ctx context.Context, term string, opts *webapi.SearchRequest) (*webapi.SearchResult, error) {
+    if err := ctx.Err(); err != nil {
+        return &webapi.SearchResult{Status: 1, Files: []webapi.ApiFile{}}, err
+    }
+
+    files := fake.scriptedResults(term)
+    if opts != nil && opts.MaxResults > 0 && len(files) > opts.MaxResults {
+        files = files[:opts.MaxResults]
+    }
+
+    return &webapi.SearchResult{Status: 1, Files: files}, nil
+}
+
+// StartSearch starts a search job returning the scripted results for the term.
+func (fake *Fake) StartSearch(input *webapi.SearchRequest) (uuid.UUID, error) {
+    if input.Timeout <= 0 {
+        input.Timeout = 20
+    }
+    if input.MaxResults <= 0 {
+        input.MaxResults = 200
+    }
+
+    files := fake.scriptedResults(input.Term)
+    if len(files) > input.MaxResults {
+        files = files[:input.MaxResults]
+    }
+
+    fake.mutex.Lock()
+    defer fake.mutex.Unlock()
+
+    for _, terminate := range input.TerminateID {
+        delete(fake.jobs, terminate)
+    }
+
+    ID := uuid.New()
+    fake.jobs[ID] = files
+
+    return ID, nil
+}
+
+// SearchResult returns the next results of the search job, same as Abstrations.SearchResult.
+func (fake *Fake) SearchResult(jobID uuid.UUID) (*webapi.SearchResult, error) {
+    fake.mutex.Lock()
+    defer fake.mutex.Unlock()
+
+    remaining, ok := fake.jobs[jobID]
+    if !ok {
+        return &webapi.SearchResult{Status: 2, Files: []webapi.ApiFile{}}, Abstrations.ErrJobNotFound
+    }
+
+    result := &webapi.SearchResult{Files: []webapi.ApiFile{}}
+
+    count := len(remaining)
+    if count > searchResultLimit {
+        count = searchResultLimit
+    }
+    result.Files = append(result.Files, remaining[:count]...)
+    fake.jobs[jobID] = remaining[count:]
+
+    if len(result.Files) == 0 {
+        result.Status = 1 // No more results to expect
+        return result, Abstrations.ErrSearchTerminated
+    } else if len(fake.jobs[jobID]) == 0 {
+        result.Status = 1 // No more results to expect
+    }
+
+    return result, nil
+}
+
+// scriptedResults returns a copy of the scripted results for the term
+func (fake *Fake) scriptedResults(term string) []webapi.ApiFile {
+    fake.mutex.Lock()
+    defer fake.mutex.Unlock()
+
+    return append([]webapi.ApiFile{}, fake.searchResults[strings.ToLower(term)]...)
+}
+
+// --- Downloader ---
+
+// Download writes the scripted data of the hash immediately to the path and finishes the download.
+// If no data is scripted for the hash, the download is canceled.
+func (fake *Fake) Download(hashStr string, nodeIDStr string, path string) (*uuid.UUID, error) {
+    hash, valid1 := webapi.DecodeBlake3Hash(hashStr)
+    nodeID, valid2 := webapi.DecodeBlake3Hash(nodeIDStr)
+    if !valid1 || !valid2 {
+        return nil, Abstrations.ErrInvalidHash
+    } else if path == "" {
+        return nil, Abstrations.ErrNoFilePath
+    }
+
+    fake.mutex.Lock()
+    defer fake.mutex.Unlock()
+
+    status := &webapi.ApiResponseDownloadStatus{APIStatus: webapi.DownloadResponseSuccess, ID: uuid.New(), DownloadStatus: webapi.DownloadCanceled}
+    status.File = webapi.ApiFile{Hash: hash, NodeID: nodeID}
+
+    if data, ok := fake.data[hex.EncodeToString(hash)]; ok {
+        if err := os.WriteFile(path, data, 0666); err != nil {
+            return nil, err
+        }
+
+        status.DownloadStatus = webapi.DownloadFinished
+        status.File.Size = uint64(len(data))
+        status.Progress.TotalSize = uint64(len(data))
+        status.Progress.DownloadedSize = uint64(len(data))
+        status.Progress.Percentage = 100
+        status.Swarm.CountPeers = 1
+    }
+
+    fake.downloads[status.ID] = status
+
+    return &status.ID, nil
+}
+
+// DownloadStatus returns the status of the download.
+func (fake *Fake) DownloadStatus(DownloadID *uuid.UUID) (*webapi.ApiResponseDownloadStatus, error) {
+    fake.mutex.Lock()
+    defer fake.mutex.Unlock()
+
+    status, ok := fake.downloads[*DownloadID]
+    if !ok {
+        return nil, Abstrations.ErrDownloadNotFound
+    }
+
+    response := *status
+    return &response, nil
+}
+
+// DownloadWait returns immediately as downloads are processed synchronously.
+func (fake *Fake) DownloadWait(ctx context.Context, DownloadID *uuid.UUID) error {
+    status, err := fake.DownloadStatus(DownloadID)
+    if err != nil {
+        return err
+    } else if status.DownloadStatus != webapi.DownloadFinished {
+        return Abstrations.ErrDownloadCanceled
+    }
+
+    return nil
+}
+
+// --- Sharer ---
+
+// Touch reads the file and shares it. The data becomes available for download.
+func (fake *Fake) Touch(filePath string) (*Abstrations.TouchReturn, error) {
+    data, err := os.ReadFile(filePath)
+    if err != nil {
+        return nil, err
+    }
+
+    fake.mutex.Lock()
+    defer fake.mutex.Unlock()
+
+    file := webapi.ApiFile{ID: uuid.New(), Hash: protocol.HashData(data), NodeID: fake.NodeID, Date: time.Now(), Size: uint64(len(data))}
+    _, file.Name = filepath.Split(filePath)
+
+    fileType, fileFormat, _ := webapi.FileDetectType(filePath)
+    file.Type = uint8(fileType)
+    file.Format = fileFormat
+
+    fake.files = append(fake.files, file)
+    fake.data[hex.EncodeToString(file.Hash)] = data
+
+    return fake.update(), nil
+}
+
+// Rm removes the shared file. The data is removed if not referenced by other files.
+func (fake *Fake) Rm(idStr string) (*Abstrations.RmReturn, error) {
+    ID, err := uuid.Parse(idStr)
+    if err != nil {
+        return nil, err
+    }
+
+    fake.mutex.Lock()
+    defer fake.mutex.Unlock()
+
+    var deleted *webapi.ApiFile
+    for n := range fake.files {
+        if fake.files[n].ID == ID {
+            deleted = &webapi.ApiFile{}
+            *deleted = fake.files[n]
+            fake.files = append(fake.files[:n], fake.files[n+1:]...)
+            break
+        }
+    }
+    if deleted == nil {
+        return nil, Abstrations.ErrFileNotFound
+    }
+
+    touch := fake.update()
+    result := &Abstrations.RmReturn{BlockchainHeight: touch.BlockchainHeight, BlockchainVersion: touch.BlockchainVersion, DeletedFiles: []webapi.ApiFile{*deleted}}
+
+    referenced := false
+    for n := range fake.files {
+        referenced = referenced || bytes.Equal(fake.files[n].Hash, deleted.Hash)
+    }
+    if !referenced {
+        delete(fake.data, hex.EncodeToString(deleted.Hash))
+        result.CollectedHashes = append(result.CollectedHashes, deleted.Hash)
+    }
+
+    return result, nil
+}
+
+// update increases the blockchain height and version like a change to the blockchain would. The caller must hold the lock.
+func (fake *Fake) update() *Abstrations.TouchReturn {
+    fake.height++
+    fake.version++
+
+    return &Abstrations.TouchReturn{BlockchainHeight: fake.height, BlockchainVersion: fake.version}
+}
+
+// --- ProfileStore ---
+
+// ProfileList lists all profile fields ordered by type.
+func (fake *Fake) ProfileList() ([]webapi.ApiBlockRecordProfile, error) {
+    fake.mutex.Lock()
+    defer fake.mutex.Unlock()
+
+    var fields []webapi.ApiBlockRecordProfile
+    for _, field := range fake.profile {
+        fields = append(fields, field)
+    }
+
+    sort.Slice(fields, func(i, j int) bool { return fields[i].Type < fields[j].Type })
+
+    return fields, nil
+}
+
+// ProfileRead reads a single profile field.
+func (fake *Fake) ProfileRead(field uint16) (*webapi.ApiBlockRecordProfile, error) {
+    fake.mutex.Lock()
+    defer fake.mutex.Unlock()
+
+    value, ok := fake.profile[field]
+    if !ok {
+        return nil, Abstrations.ErrProfileFieldNotFound
+    }
+
+    return &value, nil
+}
+
+// ProfileWrite writes the profile fields.
+func (fake *Fake) ProfileWrite(fields []webapi.ApiBlockRecordProfile) (*Abstrations.TouchReturn, error) {
+    fake.mutex.Lock()
+    defer fake.mutex.Unlock()
+
+    for _, field := range fields {
+        fake.profile[field.Type] = field
+    }
+
+    return fake.update(), nil
+}
+
+// ProfileDelete deletes the profile fields.
+func (fake *Fake) ProfileDelete(fields []uint16) (*Abstrations.TouchReturn, error) {
+    fake.mutex.Lock()
+    defer fake.mutex.Unlock()
+
+    for _, field := range fields {
+        delete(fake.profile, field)
+    }
+
+    return fake.update(), nil
+}
@@ -0,0 +1,73 @@
+/*
+File Name:  profile.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+package Abstrations
+
+import (
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/core/blockchain"
+)
+
+// ProfileList Abstracted function that
+// lists all profile fields of the user
+func ProfileList(api *webapi.WebapiInstance) ([]webapi.ApiBlockRecordProfile, error) {
+    fields, status := api.Backend.UserBlockchain().ProfileList()
+    if status != blockchain.StatusOK {
+        return nil, blockchainError(status)
+    }
+
+    var result []webapi.ApiBlockRecordProfile
+    for n := range fields {
+        result = append(result, webapi.BlockRecordProfileToAPI(fields[n]))
+    }
+
+    return result, nil
+}
+
+// ProfileRead Abstracted function that reads
+// a single profile field. See blockchain.ProfileX.
+// returns ErrProfileFieldNotFound if not set
+func ProfileRead(api *webapi.WebapiInstance, field uint16) (*webapi.ApiBlockRecordProfile, error) {
+    data, status := api.Backend.UserBlockchain().ProfileReadField(field)
+    if status == blockchain.StatusDataNotFound {
+        return nil, ErrProfileFieldNotFound
+    } else if status != blockchain.StatusOK {
+        return nil, blockchainError(status)
+    }
+
+    result := webapi.BlockRecordProfileToAPI(blockchain.BlockRecordProfile{Type: field, Data: data})
+
+    return &result, nil
+}
+
+// ProfileWrite Abstracted function that writes
+// the profile fields to the blockchain
+// returns blockchain version and height
+func ProfileWrite(api *webapi.WebapiInstance, fields []webapi.ApiBlockRecordProfile) (*TouchReturn, error) {
+    var records []blockchain.BlockRecordProfile
+    for n := range fields {
+        records = append(records, webapi.BlockRecordProfileFromAPI(fields[n]))
+    }
+
+    newHeight, newVersion, status := api.Backend.UserBlockchain().ProfileWrite(records)
+    if status != blockchain.StatusOK {
+        return nil, blockchainError(status)
+    }
+
+    return &TouchReturn{BlockchainHeight: newHeight, BlockchainVersion: newVersion}, nil
+}
+
+// ProfileDelete Abstracted function that deletes
+// the profile fields identified by their types
+// returns blockchain version and height
+func ProfileDelete(api *webapi.WebapiInstance, fields []uint16) (*TouchReturn, error) {
+    newHeight, newVersion, status := api.Backend.UserBlockchain().ProfileDelete(fields)
+    if status != blockchain.StatusOK {
+        return nil, blockchainError(status)
+    }
+
+    return &TouchReturn{BlockchainHeight: newHeight, BlockchainVersion: newVersion}, nil
+}
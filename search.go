@@ -0,0 +1,166 @@
+/*
+File Name:  search.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+package Abstrations
+
+import (
+    "context"
+    "time"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/google/uuid"
+)
+
+// searchPollInterval is the interval to check the search job for new results
+const searchPollInterval = time.Millisecond * 100
+
+// SearchResultStream provides the results of a search job as they arrive.
+// The Results channel is closed once the search job terminates, the
+// context is cancelled, the search timeout or MaxResults is reached,
+// or Close is called. Status and Err are only valid after that.
+type SearchResultStream struct {
+    JobID   uuid.UUID             // ID of the underlying search job
+    Results <-chan webapi.ApiFile // Results as they arrive
+
+    ctx    context.Context    // context provided by the caller
+    cancel context.CancelFunc // stops feeding results
+    status int                // final status, see webapi.SearchResult
+    err    error              // final error
+}
+
+// SearchStream abstracted function that starts a search and returns
+// a stream of results fed from the search job. The options are optional
+// and may be nil; the term always overrides opts.Term.
+func SearchStream(ctx context.Context, api *webapi.WebapiInstance, term string, opts *webapi.SearchRequest) (*SearchResultStream, error) {
+    var input webapi.SearchRequest
+    if opts != nil {
+        input = *opts
+    } else {
+        input.FileType = -1
+        input.FileFormat = -1
+        input.SizeMin = -1
+        input.SizeMax = -1
+    }
+    input.Term = term
+
+    jobID, err := StartSearch(api, &input)
+    if err != nil {
+        return nil, err
+    }
+
+    job := api.JobLookup(jobID)
+    if job == nil {
+        return nil, ErrJobNotFound
+    }
+
+    results := make(chan webapi.ApiFile)
+    stream := &SearchResultStream{JobID: jobID, Results: results, ctx: ctx}
+
+    // The search timeout is enforced in addition to the callers context.
+    var searchCtx context.Context
+    searchCtx, stream.cancel = context.WithTimeout(ctx, input.Parse())
+
+    go stream.feed(searchCtx, api, job, input.MaxResults, results)
+
+    return stream, nil
+}
+
+// feed sends the results of the job to the channel until the search is finished.
+func (stream *SearchResultStream) feed(ctx context.Context, api *webapi.WebapiInstance, job *webapi.SearchJob, maxResults int, results chan<- webapi.ApiFile) {
+    // The job is only used by this stream, remove it once done.
+    defer func() {
+        stream.cancel()
+        job.Terminate()
+        api.RemoveJob(job)
+        close(results)
+    }()
+
+    ticker := time.NewTicker(searchPollInterval)
+    defer ticker.Stop()
+
+    for count := 0; ; {
+        for _, file := range job.ReturnNext(maxResults - count) {
+            select {
+            case results <- *file:
+                count++
+            case <-ctx.Done():
+                stream.finish(1, job)
+                return
+            }
+        }
+
+        if count >= maxResults {
+            stream.finish(0, job) // Success with results
+            return
+        } else if !job.IsSearchResults() {
+            stream.finish(1, job) // No more results to expect
+            return
+        }
+
+        select {
+        case <-ctx.Done():
+            stream.finish(1, job)
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// finish sets the final status. Only an error of the callers context or a missing search index is reported, reaching the search timeout or closing the stream is regular.
+func (stream *SearchResultStream) finish(status int, job *webapi.SearchJob) {
+    stream.status = status
+    if stream.err = stream.ctx.Err(); stream.err == nil && job.Status == webapi.SearchStatusNoIndex {
+        stream.err = ErrNoIndex
+    }
+}
+
+// Close stops the stream and terminates the search. The Results channel will be closed.
+func (stream *SearchResultStream) Close() {
+    stream.cancel()
+}
+
+// Status returns the final status of the search. See webapi.SearchResult. Only valid after the Results channel is closed.
+func (stream *SearchResultStream) Status() int {
+    return stream.status
+}
+
+// Err returns the final error of the search. Only valid after the Results channel is closed.
+func (stream *SearchResultStream) Err() error {
+    return stream.err
+}
+
+// Next returns the next result. It returns false if the stream is finished or the context is cancelled.
+func (stream *SearchResultStream) Next(ctx context.Context) (file webapi.ApiFile, ok bool) {
+    select {
+    case file, ok = <-stream.Results:
+        return file, ok
+    case <-ctx.Done():
+        return file, false
+    }
+}
+
+// SearchContext abstracted function that runs a search and blocks until
+// the search job terminates, the context is cancelled, the search timeout
+// is reached or MaxResults results were collected. All results are collected.
+// The options are optional and may be nil; the term always overrides opts.Term.
+// If the context is cancelled, the results collected so far are returned together with the context error.
+func SearchContext(ctx context.Context, api *webapi.WebapiInstance, term string, opts *webapi.SearchRequest) (*webapi.SearchResult, error) {
+    stream, err := SearchStream(ctx, api, term, opts)
+    if err != nil {
+        return nil, err
+    }
+
+    var result webapi.SearchResult
+    result.Files = []webapi.ApiFile{}
+
+    for file := range stream.Results {
+        result.Files = append(result.Files, file)
+    }
+
+    result.Status = stream.Status()
+
+    return &result, stream.Err()
+}
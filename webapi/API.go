@@ -11,6 +11,7 @@ import (
     "encoding/json"
     "errors"
     "net/http"
+    "strings"
     "sync"
     "time"
 
@@ -22,12 +23,13 @@ import (
 )
 
 type WebapiInstance struct {
-    Backend         *core.Backend
+    Backend         Backend
     geoipCityReader *geoip2.CityReader
 
     // Router can be used to register additional API functions
     Router          *mux.Router
     AllowKeyInParam []string // List of paths that accept the API key as &k= parameter
+    AllowBasicAuth  []string // List of path prefixes that accept the API key as password via HTTP basic authentication, for example WebDAV
 
     // search jobs
     allJobs      map[uuid.UUID]*SearchJob
@@ -36,6 +38,24 @@ type WebapiInstance struct {
     // download info
     downloads      map[uuid.UUID]*DownloadInfo
     downloadsMutex sync.RWMutex
+    journal        downloadJournal // unfinished downloads persisted in the data folder
+    journalMutex   sync.Mutex
+    journalSave    sync.Mutex // serializes writing the journal file
+    queue          downloadQueue // downloads waiting for a slot
+    queueMutex     sync.Mutex
+    history        []DownloadHistoryEntry // ended downloads, oldest first
+    historyMutex   sync.Mutex
+
+    // folder sync roots
+    syncRoots map[uuid.UUID]*syncWatcher
+    syncMutex sync.RWMutex
+
+    // mirrors of remote peers
+    mirrors      map[uuid.UUID]*mirrorWatcher
+    mirrorsMutex sync.RWMutex
+
+    // bandwidth limits
+    bandwidth bandwidthState
 }
 
 // WSUpgrader is used for websocket functionality. It allows all requests.
@@ -56,12 +76,25 @@ func Start(Backend *core.Backend, ListenAddresses []string, UseSSL bool, Certifi
         return nil
     }
 
+    api = New(NewCoreBackend(Backend), APIKey)
+
+    for _, listen := range ListenAddresses {
+        go startWebAPI(api.Backend, listen, UseSSL, CertificateFile, CertificateKey, api.Router, "API", TimeoutRead, TimeoutWrite)
+    }
+
+    return api
+}
+
+// New creates the API with all routes registered but does not listen. The router can be served by any HTTP server, for example httptest.
+// The API key may be uuid.Nil to disable it although this is not recommended for security reasons.
+func New(Backend Backend, APIKey uuid.UUID) (api *WebapiInstance) {
     api = &WebapiInstance{
         Backend:         Backend,
         Router:          mux.NewRouter(),
         AllowKeyInParam: []string{"/File/read", "/File/view"},
         allJobs:         make(map[uuid.UUID]*SearchJob),
         downloads:       make(map[uuid.UUID]*DownloadInfo),
+        queue:           downloadQueue{max: DownloadMaxActiveDefault},
     }
 
     if APIKey != uuid.Nil {
@@ -80,6 +113,8 @@ func Start(Backend *core.Backend, ListenAddresses []string, UseSSL bool, Certifi
     api.Router.HandleFunc("/blockchain/File/list", api.apiBlockchainFileList).Methods("GET")
     api.Router.HandleFunc("/blockchain/File/delete", api.apiBlockchainFileDelete).Methods("POST")
     api.Router.HandleFunc("/blockchain/File/update", api.apiBlockchainFileUpdate).Methods("POST")
+    api.Router.HandleFunc("/blockchain/File/export", api.apiBlockchainFileExport).Methods("GET")
+    api.Router.HandleFunc("/blockchain/File/import", api.apiBlockchainFileImport).Methods("POST")
     api.Router.HandleFunc("/profile/list", api.apiProfileList).Methods("GET")
     api.Router.HandleFunc("/profile/read", api.apiProfileRead).Methods("GET")
     api.Router.HandleFunc("/profile/write", api.apiProfileWrite).Methods("POST")
@@ -94,24 +129,46 @@ func Start(Backend *core.Backend, ListenAddresses []string, UseSSL bool, Certifi
     api.Router.HandleFunc("/download/start", api.apiDownloadStart).Methods("GET")
     api.Router.HandleFunc("/download/Status", api.apiDownloadStatus).Methods("GET")
     api.Router.HandleFunc("/download/action", api.apiDownloadAction).Methods("GET")
+    api.Router.HandleFunc("/download/list", api.apiDownloadList).Methods("GET")
+    api.Router.HandleFunc("/download/history", api.apiDownloadHistory).Methods("GET")
+    api.Router.HandleFunc("/download/history/clear", api.apiDownloadHistoryClear).Methods("POST")
+    api.Router.HandleFunc("/link/create", api.apiLinkCreate).Methods("GET")
+    api.Router.HandleFunc("/link/download", api.apiLinkDownload).Methods("GET")
     api.Router.HandleFunc("/warehouse/create", api.apiWarehouseCreateFile).Methods("POST")
     api.Router.HandleFunc("/warehouse/create/path", api.apiWarehouseCreateFilePath).Methods("GET")
+    api.Router.HandleFunc("/warehouse/create/dir", api.apiWarehouseCreateDirectory).Methods("GET")
     api.Router.HandleFunc("/warehouse/read", api.apiWarehouseReadFile).Methods("GET")
     api.Router.HandleFunc("/warehouse/read/path", api.apiWarehouseReadFilePath).Methods("GET")
     api.Router.HandleFunc("/warehouse/delete", api.apiWarehouseDeleteFile).Methods("GET")
     api.Router.HandleFunc("/File/read", api.apiFileRead).Methods("GET")
     api.Router.HandleFunc("/File/view", api.apiFileView).Methods("GET")
+    api.Router.HandleFunc("/sync/list", api.apiSyncList).Methods("GET")
+    api.Router.HandleFunc("/sync/add", api.apiSyncAdd).Methods("GET")
+    api.Router.HandleFunc("/sync/remove", api.apiSyncRemove).Methods("GET")
+    api.Router.HandleFunc("/sync/action", api.apiSyncAction).Methods("GET")
+    api.Router.HandleFunc("/sync/plan", api.apiSyncPlan).Methods("GET")
+    api.Router.HandleFunc("/sync/run", api.apiSyncRun).Methods("GET")
+    api.Router.HandleFunc("/mirror/list", api.apiMirrorList).Methods("GET")
+    api.Router.HandleFunc("/mirror/add", api.apiMirrorAdd).Methods("GET")
+    api.Router.HandleFunc("/mirror/remove", api.apiMirrorRemove).Methods("GET")
+    api.Router.HandleFunc("/bandwidth/get", api.apiBandwidthGet).Methods("GET")
+    api.Router.HandleFunc("/bandwidth/set", api.apiBandwidthSet).Methods("POST")
+    api.Router.HandleFunc("/download/queue", api.apiDownloadQueue).Methods("GET")
+    api.Router.HandleFunc("/download/queue/set", api.apiDownloadQueueSet).Methods("GET")
 
-    for _, listen := range ListenAddresses {
-        go startWebAPI(Backend, listen, UseSSL, CertificateFile, CertificateKey, api.Router, "API", TimeoutRead, TimeoutWrite)
-    }
+    api.bandwidthInit()
+    api.historyInit()
+    api.queueInit()
+    api.downloadInit()
+    api.syncInit()
+    api.mirrorInit()
 
     return api
 }
 
 // startWebAPI starts a web-server with given parameters and logs the Status. If may block forever and only returns if there is an error.
 // The certificate File and key are only used if SSL is enabled. The read and write timeout may be 0 for no timeout.
-func startWebAPI(Backend *core.Backend, WebListen string, UseSSL bool, CertificateFile, CertificateKey string, Handler http.Handler, Info string, ReadTimeout, WriteTimeout time.Duration) {
+func startWebAPI(Backend Backend, WebListen string, UseSSL bool, CertificateFile, CertificateKey string, Handler http.Handler, Info string, ReadTimeout, WriteTimeout time.Duration) {
     Backend.LogError("startWebAPI", "Start API at '%s'\n", WebListen)
 
     tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12} // for security reasons disable TLS 1.0/1.1
@@ -139,7 +196,7 @@ func startWebAPI(Backend *core.Backend, WebListen string, UseSSL bool, Certifica
 }
 
 // EncodeJSON encodes the data as JSON
-func EncodeJSON(Backend *core.Backend, w http.ResponseWriter, r *http.Request, data interface{}) (err error) {
+func EncodeJSON(Backend Backend, w http.ResponseWriter, r *http.Request, data interface{}) (err error) {
     w.Header().Set("Content-Type", "application/json")
 
     err = json.NewEncoder(w).Encode(data)
@@ -172,6 +229,10 @@ func (api *WebapiInstance) authenticateMiddleware(APIKey uuid.UUID) func(http.Ha
     return (func(next http.Handler) http.Handler {
         return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
             keyID, err := uuid.Parse(r.Header.Get("x-api-key"))
+            basicAuth := api.isBasicAuthPath(r.URL.Path)
+            if _, password, ok := r.BasicAuth(); err != nil && ok && basicAuth { // basic authentication with the API key as password, used by WebDAV clients
+                keyID, err = uuid.Parse(password)
+            }
             if err != nil { // special case for some paths
                 for _, exceptPath := range api.AllowKeyInParam {
                     if exceptPath == r.URL.Path {
@@ -181,12 +242,10 @@ func (api *WebapiInstance) authenticateMiddleware(APIKey uuid.UUID) func(http.Ha
                     }
                 }
             }
-            if err != nil { // Invalid key format
-                w.WriteHeader(http.StatusUnauthorized)
-                return
-            }
-
-            if keyID != APIKey {
+            if err != nil || keyID != APIKey { // Invalid key format or wrong key
+                if basicAuth { // ask the client for the credentials
+                    w.Header().Set("WWW-Authenticate", `Basic realm="Peernet"`)
+                }
                 w.WriteHeader(http.StatusUnauthorized)
                 return
             }
@@ -195,3 +254,14 @@ func (api *WebapiInstance) authenticateMiddleware(APIKey uuid.UUID) func(http.Ha
         })
     })
 }
+
+// isBasicAuthPath checks if the path is in one of the path prefixes that accept HTTP basic authentication
+func (api *WebapiInstance) isBasicAuthPath(path string) bool {
+    for _, prefix := range api.AllowBasicAuth {
+        if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+            return true
+        }
+    }
+
+    return false
+}
@@ -0,0 +1,181 @@
+/*
+File Name:  API_test.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi_test
+
+import (
+    "bytes"
+    "encoding/hex"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/Abstraction/webapitest"
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/warehouse"
+    "github.com/google/uuid"
+)
+
+// request sends the request with the API key and decodes the JSON response into result, if not nil. It returns the HTTP status code.
+func request(t *testing.T, server *httptest.Server, key uuid.UUID, method, path string, body []byte, result interface{}) (statusCode int) {
+    t.Helper()
+
+    req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(body))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if key != uuid.Nil {
+        req.Header.Set("x-api-key", key.String())
+    }
+
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+
+    if result != nil && resp.StatusCode == http.StatusOK {
+        if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+            t.Fatalf("%s %s: decoding response: %v", method, path, err)
+        }
+    }
+
+    return resp.StatusCode
+}
+
+// waitDownload waits until the download ended and returns the final status
+func waitDownload(t *testing.T, info *webapi.DownloadInfo) (status int) {
+    t.Helper()
+
+    for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+        if status = info.GetStatus(); webapi.IsDownloadTerminal(status) {
+            return status
+        }
+    }
+
+    t.Fatalf("download still in status %d", info.GetStatus())
+    return status
+}
+
+func TestAuthentication(t *testing.T) {
+    key := uuid.New()
+    _, server := webapitest.NewServer(webapitest.NewBackend(), key)
+    defer server.Close()
+
+    var status webapi.ApiResponseStatus
+
+    if code := request(t, server, uuid.Nil, "GET", "/Status", nil, nil); code != http.StatusUnauthorized {
+        t.Fatalf("no key: status code %d, expected 401", code)
+    }
+    if code := request(t, server, uuid.New(), "GET", "/Status", nil, nil); code != http.StatusUnauthorized {
+        t.Fatalf("wrong key: status code %d, expected 401", code)
+    }
+    if code := request(t, server, key, "GET", "/Status", nil, &status); code != http.StatusOK {
+        t.Fatalf("valid key: status code %d, expected 200", code)
+    }
+}
+
+func TestBlockchainFileAddList(t *testing.T) {
+    key := uuid.New()
+    backend := webapitest.NewBackend()
+    _, server := webapitest.NewServer(backend, key)
+    defer server.Close()
+
+    data := []byte("test data")
+
+    var created webapi.WarehouseResult
+    if request(t, server, key, "POST", "/warehouse/create", data, &created); created.Status != warehouse.StatusOK {
+        t.Fatalf("warehouse create status %d", created.Status)
+    }
+
+    input, _ := json.Marshal(webapi.ApiBlockAddFiles{Files: []webapi.ApiFile{{Name: "test.txt", Folder: "docs", Hash: created.Hash}}})
+
+    var added webapi.ApiBlockchainBlockStatus
+    if request(t, server, key, "POST", "/blockchain/File/add", input, &added); added.Status != blockchain.StatusOK || added.Height != 1 {
+        t.Fatalf("add status %d height %d", added.Status, added.Height)
+    }
+
+    var list webapi.ApiBlockAddFiles
+    request(t, server, key, "GET", "/blockchain/File/list", nil, &list)
+
+    if len(list.Files) != 1 {
+        t.Fatalf("listed %d files, expected 1", len(list.Files))
+    }
+    if file := list.Files[0]; file.Name != "test.txt" || file.Folder != "docs" || !bytes.Equal(file.Hash, created.Hash) || file.Size != uint64(len(data)) {
+        t.Fatalf("listed file %+v does not match", file)
+    }
+
+    // A file that is not in the warehouse is rejected.
+    input, _ = json.Marshal(webapi.ApiBlockAddFiles{Files: []webapi.ApiFile{{Name: "missing.txt", Hash: make([]byte, 32)}}})
+    if request(t, server, key, "POST", "/blockchain/File/add", input, &added); added.Status != blockchain.StatusNotInWarehouse {
+        t.Fatalf("add of missing file status %d", added.Status)
+    }
+}
+
+func TestDownloadStart(t *testing.T) {
+    key := uuid.New()
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, key)
+    defer server.Close()
+
+    data := []byte("remote file data")
+    file := backend.AddPeer().AddFile(webapi.ApiFile{Name: "remote.txt"}, data)
+    target := filepath.Join(t.TempDir(), "remote.txt")
+
+    query := url.Values{"path": {target}, "Hash": {hex.EncodeToString(file.Hash)}, "node": {hex.EncodeToString(file.NodeID)}}
+
+    var started webapi.ApiResponseDownloadStatus
+    if request(t, server, key, "GET", "/download/start?"+query.Encode(), nil, &started); started.APIStatus != webapi.DownloadResponseSuccess {
+        t.Fatalf("download start API status %d", started.APIStatus)
+    }
+
+    if status := waitDownload(t, api.DownloadLookup(started.ID)); status != webapi.DownloadFinished {
+        t.Fatalf("download ended with status %d", status)
+    }
+
+    var status webapi.ApiResponseDownloadStatus
+    request(t, server, key, "GET", "/download/Status?ID="+started.ID.String(), nil, &status)
+    if status.DownloadStatus != webapi.DownloadFinished || status.Progress.DownloadedSize != uint64(len(data)) || status.File.Name != "remote.txt" {
+        t.Fatalf("download status %+v", status)
+    }
+
+    if stored, err := os.ReadFile(target); err != nil || !bytes.Equal(stored, data) {
+        t.Fatalf("stored data %q does not match: %v", stored, err)
+    }
+}
+
+func TestDownloadQueue(t *testing.T) {
+    key := uuid.New()
+    backend := webapitest.NewBackend()
+    backend.Data = t.TempDir()
+    _, server := webapitest.NewServer(backend, key)
+
+    var queue webapi.ApiDownloadQueue
+    if request(t, server, key, "GET", "/download/queue", nil, &queue); queue.MaxActive != webapi.DownloadMaxActiveDefault {
+        t.Fatalf("default maximum %d", queue.MaxActive)
+    }
+    if code := request(t, server, key, "GET", "/download/queue/set?max=-1", nil, nil); code != http.StatusBadRequest {
+        t.Fatalf("invalid maximum: status code %d, expected 400", code)
+    }
+    if request(t, server, key, "GET", "/download/queue/set?max=2", nil, &queue); queue.MaxActive != 2 {
+        t.Fatalf("maximum %d after setting 2", queue.MaxActive)
+    }
+    server.Close()
+
+    // The maximum is kept after a restart.
+    _, server = webapitest.NewServer(backend, key)
+    defer server.Close()
+
+    if request(t, server, key, "GET", "/download/queue", nil, &queue); queue.MaxActive != 2 {
+        t.Fatalf("maximum %d after restart, expected 2", queue.MaxActive)
+    }
+}
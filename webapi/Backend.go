@@ -0,0 +1,110 @@
+/*
+File Name:  Backend.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi
+
+import (
+    "io"
+    "time"
+
+    "github.com/PeernetOfficial/core"
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/btcec"
+    "github.com/PeernetOfficial/core/dht"
+    "github.com/PeernetOfficial/core/merkle"
+    "github.com/PeernetOfficial/core/search"
+    "github.com/google/uuid"
+)
+
+// Backend provides all core functions used by the API. NewCoreBackend wraps a *core.Backend connected to the network.
+// The package webapitest provides an in-memory implementation to test the API without network.
+type Backend interface {
+    UserWarehouse() Warehouse   // Warehouse of the user.
+    UserBlockchain() Blockchain // Blockchain of the user.
+    SearchIndex() SearchIndex   // Search index. Nil if not available.
+    DataFolder() string         // Folder to store data such as state files. Empty if state shall not be persisted.
+    LogError(function, format string, v ...interface{})
+    SelfNodeID() []byte
+    ExportPrivateKey() (privateKey *btcec.PrivateKey, publicKey *btcec.PublicKey)
+    DeleteAccount()
+    FindNode(nodeID []byte, Timeout time.Duration) (node *dht.Node, peer *core.PeerInfo, err error)
+    PeerlistGet() (peers []*core.PeerInfo)
+    PeerlistLookup(publicKey *btcec.PublicKey) (peer *core.PeerInfo)
+    NodelistLookup(nodeID []byte) (peer *core.PeerInfo)
+    PeerlistCount() (count int)
+    ReadBlock(PublicKey *btcec.PublicKey, Version, BlockNumber uint64) (decoded *blockchain.BlockDecoded, raw []byte, found bool, err error)
+    ReadFile(PublicKey *btcec.PublicKey, Version, BlockNumber uint64, FileID uuid.UUID) (file blockchain.BlockRecordFile, raw []byte, found bool, err error)
+
+    // FileTransfer starts the transfer of a file from the remote peer. See FileStartReader.
+    FileTransfer(peer *core.PeerInfo, hash []byte, offset, limit uint64, cancelChan <-chan struct{}) (reader io.ReadCloser, fileSize, transferSize uint64, err error)
+}
+
+// Warehouse provides the functions of the warehouse used by the API. It is implemented by *warehouse.Warehouse.
+type Warehouse interface {
+    CreateFile(data io.Reader, fileSize uint64) (hash []byte, status int, err error)
+    CreateFileFromPath(file string) (hash []byte, status int, err error)
+    ReadFile(hash []byte, offset, limit int64, writer io.Writer) (status int, bytesRead int64, err error)
+    ReadFileToDisk(hash []byte, offset, limit int64, fileTarget string) (status int, bytesRead int64, err error)
+    DeleteFile(hash []byte) (status int, err error)
+    FileExists(hash []byte) (path string, fileSize uint64, status int, err error)
+    ReadMerkleTree(hash []byte, headerOnly bool) (tree *merkle.MerkleTree, status int, err error)
+}
+
+// Blockchain provides the functions of the user's blockchain used by the API. It is implemented by *blockchain.Blockchain.
+type Blockchain interface {
+    Header() (publicKey *btcec.PublicKey, height uint64, version uint64)
+    Append(RecordsRaw []blockchain.BlockRecordRaw) (newHeight, newVersion uint64, status int)
+    Read(number uint64) (decoded *blockchain.BlockDecoded, status int, err error)
+    AddFiles(files []blockchain.BlockRecordFile) (newHeight, newVersion uint64, status int)
+    ListFiles() (files []blockchain.BlockRecordFile, status int)
+    FileExists(hash []byte) (files []blockchain.BlockRecordFile, status int)
+    DeleteFiles(IDs []uuid.UUID) (newHeight, newVersion uint64, deletedFiles []*blockchain.BlockRecordFile, status int)
+    ReplaceFiles(files []blockchain.BlockRecordFile) (newHeight, newVersion uint64, status int)
+    ProfileList() (fields []blockchain.BlockRecordProfile, status int)
+    ProfileReadField(index uint16) (data []byte, status int)
+    ProfileWrite(fields []blockchain.BlockRecordProfile) (newHeight, newVersion uint64, status int)
+    ProfileDelete(fields []uint16) (newHeight, newVersion uint64, status int)
+}
+
+// SearchIndex provides the local search index. It is implemented by *search.SearchIndexStore.
+type SearchIndex interface {
+    Search(term string) (results []search.SearchIndexRecord)
+}
+
+// coreBackend implements Backend for a *core.Backend.
+type coreBackend struct {
+    *core.Backend
+}
+
+// NewCoreBackend returns the Backend for the core backend.
+func NewCoreBackend(backend *core.Backend) Backend {
+    return &coreBackend{Backend: backend}
+}
+
+func (backend *coreBackend) UserWarehouse() Warehouse {
+    return backend.Backend.UserWarehouse
+}
+
+func (backend *coreBackend) UserBlockchain() Blockchain {
+    return backend.Backend.UserBlockchain
+}
+
+func (backend *coreBackend) SearchIndex() SearchIndex {
+    // A nil pointer must not be returned as non-nil interface.
+    if backend.Backend.SearchIndex == nil {
+        return nil
+    }
+
+    return backend.Backend.SearchIndex
+}
+
+func (backend *coreBackend) DataFolder() string {
+    return backend.Backend.Config.DataFolder
+}
+
+func (backend *coreBackend) FileTransfer(peer *core.PeerInfo, hash []byte, offset, limit uint64, cancelChan <-chan struct{}) (reader io.ReadCloser, fileSize, transferSize uint64, err error) {
+    return FileStartReader(peer, hash, offset, limit, cancelChan)
+}
@@ -0,0 +1,340 @@
+/*
+File Name:  Bandwidth.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+
+Rate limits for downloads and streaming of files. Data passes token buckets that refill at the configured rate.
+The limits can be changed at runtime and switched by a time-of-day schedule.
+*/
+
+package webapi
+
+import (
+    "errors"
+    "io"
+    "net/http"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// BandwidthStateFile is the name of the file in the data folder that stores the bandwidth limits
+const BandwidthStateFile = "Bandwidth.json"
+
+// bandwidthChunk is the maximum count of bytes read at once through a rate limited reader or writer
+const bandwidthChunk = 16 * 1024
+
+// BandwidthLimits are rate limits in bytes per second. 0 means unlimited.
+type BandwidthLimits struct {
+    Download     uint64 `json:"download"`     // Total rate of all downloads.
+    DownloadFile uint64 `json:"downloadfile"` // Rate per download. It can be changed for each download.
+    Stream       uint64 `json:"stream"`       // Total rate of files served via /File/read, /File/view and /warehouse/read.
+}
+
+// BandwidthSchedule applies other limits during the time of day
+type BandwidthSchedule struct {
+    Start  string          `json:"start"`  // Start time in local time as "HH:MM".
+    End    string          `json:"end"`    // End time in local time as "HH:MM", exclusive. If before the start time, the schedule spans midnight.
+    Limits BandwidthLimits `json:"limits"` // Limits applied during the time.
+}
+
+// ApiBandwidth contains the bandwidth limits
+type ApiBandwidth struct {
+    Limits   BandwidthLimits     `json:"limits"`   // Default limits, applied outside of scheduled times.
+    Schedule []BandwidthSchedule `json:"schedule"` // Optional schedule. The first entry matching the current time applies.
+    Active   BandwidthLimits     `json:"active"`   // Limits currently applied. Ignored when setting the limits.
+}
+
+// ErrBandwidthSchedule is returned for an invalid time in the bandwidth schedule
+var ErrBandwidthSchedule = errors.New("invalid schedule time, expected HH:MM")
+
+// bandwidthState contains the bandwidth limits and the global token buckets
+type bandwidthState struct {
+    settings ApiBandwidth
+    download *tokenBucket
+    stream   *tokenBucket
+    sync.RWMutex
+}
+
+// tokenBucket limits the rate of data. Data that exceeds the available tokens is delayed until the bucket is refilled.
+// The bucket holds at most the tokens of one second.
+type tokenBucket struct {
+    rate   func() uint64 // Current rate in bytes per second. 0 means unlimited.
+    tokens float64
+    last   time.Time
+    sync.Mutex
+}
+
+// wait takes the tokens for the count of bytes and waits until they are available. It returns false if canceled while waiting.
+func (bucket *tokenBucket) wait(count int, cancel <-chan struct{}) bool {
+    rate := bucket.rate()
+    if rate == 0 || count <= 0 {
+        return true
+    }
+
+    bucket.Lock()
+    now := time.Now()
+    bucket.tokens += now.Sub(bucket.last).Seconds() * float64(rate)
+    if bucket.tokens > float64(rate) {
+        bucket.tokens = float64(rate)
+    }
+    bucket.last = now
+    bucket.tokens -= float64(count)
+    delay := time.Duration(-bucket.tokens / float64(rate) * float64(time.Second))
+    bucket.Unlock()
+
+    if delay <= 0 {
+        return true
+    }
+
+    timer := time.NewTimer(delay)
+    defer timer.Stop()
+
+    select {
+    case <-timer.C:
+        return true
+    case <-cancel:
+        return false
+    }
+}
+
+// bandwidthReader is a reader limited by token buckets
+type bandwidthReader struct {
+    io.ReadCloser
+    buckets  []*tokenBucket
+    cancel   <-chan struct{}
+    throttle func(waiting bool) // Optional callback before and after waiting for tokens. Used to exclude the waiting time from stall detection.
+}
+
+func (reader *bandwidthReader) Read(data []byte) (n int, err error) {
+    if len(data) > bandwidthChunk {
+        data = data[:bandwidthChunk]
+    }
+
+    n, err = reader.ReadCloser.Read(data)
+
+    if reader.throttle != nil {
+        reader.throttle(true)
+        defer reader.throttle(false)
+    }
+
+    for _, bucket := range reader.buckets {
+        if !bucket.wait(n, reader.cancel) && err == nil {
+            err = io.ErrClosedPipe
+        }
+    }
+
+    return n, err
+}
+
+// bandwidthWriter is a writer limited by token buckets
+type bandwidthWriter struct {
+    io.Writer
+    buckets []*tokenBucket
+    cancel  <-chan struct{}
+}
+
+func (writer *bandwidthWriter) Write(data []byte) (written int, err error) {
+    for len(data) > 0 {
+        chunk := data
+        if len(chunk) > bandwidthChunk {
+            chunk = chunk[:bandwidthChunk]
+        }
+
+        for _, bucket := range writer.buckets {
+            if !bucket.wait(len(chunk), writer.cancel) {
+                return written, io.ErrClosedPipe
+            }
+        }
+
+        n, err := writer.Writer.Write(chunk)
+        written += n
+        if err != nil {
+            return written, err
+        }
+        data = data[n:]
+    }
+
+    return written, nil
+}
+
+// bandwidthResponseWriter is a HTTP response writer limited by token buckets
+type bandwidthResponseWriter struct {
+    http.ResponseWriter
+    limited *bandwidthWriter
+}
+
+func (writer *bandwidthResponseWriter) Write(data []byte) (written int, err error) {
+    return writer.limited.Write(data)
+}
+
+// bandwidthInit loads the bandwidth limits from the data folder
+func (api *WebapiInstance) bandwidthInit() {
+    api.bandwidth.download = &tokenBucket{rate: func() uint64 { return api.BandwidthActive().Download }}
+    api.bandwidth.stream = &tokenBucket{rate: func() uint64 { return api.BandwidthActive().Stream }}
+
+    api.stateLoad("bandwidthInit", BandwidthStateFile, &api.bandwidth.settings)
+}
+
+// bandwidthSave writes the state file. The caller must hold the bandwidth lock.
+func (api *WebapiInstance) bandwidthSave() {
+    api.stateSave("bandwidthSave", BandwidthStateFile, api.bandwidth.settings)
+}
+
+// BandwidthGet returns the bandwidth limits, including the limits currently applied
+func (api *WebapiInstance) BandwidthGet() (settings ApiBandwidth) {
+    api.bandwidth.RLock()
+    settings = api.bandwidth.settings
+    settings.Schedule = append([]BandwidthSchedule{}, settings.Schedule...)
+    api.bandwidth.RUnlock()
+
+    settings.Active = api.BandwidthActive()
+
+    return settings
+}
+
+// BandwidthSet changes the bandwidth limits and the schedule. They apply immediately, including to running downloads and streams.
+func (api *WebapiInstance) BandwidthSet(limits BandwidthLimits, schedule []BandwidthSchedule) (err error) {
+    for _, entry := range schedule {
+        if _, err = parseTimeOfDay(entry.Start); err != nil {
+            return err
+        } else if _, err = parseTimeOfDay(entry.End); err != nil {
+            return err
+        }
+    }
+
+    api.bandwidth.Lock()
+    defer api.bandwidth.Unlock()
+
+    api.bandwidth.settings = ApiBandwidth{Limits: limits, Schedule: append([]BandwidthSchedule{}, schedule...)}
+    api.bandwidthSave()
+
+    return nil
+}
+
+// BandwidthActive returns the limits currently applied according to the schedule
+func (api *WebapiInstance) BandwidthActive() (limits BandwidthLimits) {
+    api.bandwidth.RLock()
+    defer api.bandwidth.RUnlock()
+
+    return api.bandwidth.settings.limitsAt(time.Now())
+}
+
+// limitsAt returns the limits that apply at the time of day according to the schedule
+func (settings *ApiBandwidth) limitsAt(now time.Time) (limits BandwidthLimits) {
+    minute := now.Hour()*60 + now.Minute()
+
+    for _, entry := range settings.Schedule {
+        start, err1 := parseTimeOfDay(entry.Start)
+        end, err2 := parseTimeOfDay(entry.End)
+        if err1 != nil || err2 != nil {
+            continue
+        }
+
+        if (start <= end && minute >= start && minute < end) || (start > end && (minute >= start || minute < end)) {
+            return entry.Limits
+        }
+    }
+
+    return settings.Limits
+}
+
+// parseTimeOfDay parses the time "HH:MM" and returns the minute of the day
+func parseTimeOfDay(text string) (minute int, err error) {
+    parsed, err := time.Parse("15:04", text)
+    if err != nil {
+        return 0, ErrBandwidthSchedule
+    }
+
+    return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// streamReader returns the reader limited by the stream limit
+func (api *WebapiInstance) streamReader(reader io.ReadCloser, cancel <-chan struct{}) io.ReadCloser {
+    return &bandwidthReader{ReadCloser: reader, buckets: []*tokenBucket{api.bandwidth.stream}, cancel: cancel}
+}
+
+// streamWriter returns the HTTP response writer limited by the stream limit
+func (api *WebapiInstance) streamWriter(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+    return &bandwidthResponseWriter{ResponseWriter: w, limited: &bandwidthWriter{Writer: w, buckets: []*tokenBucket{api.bandwidth.stream}, cancel: r.Context().Done()}}
+}
+
+// bandwidthBuckets returns the token buckets of the rate of the download and the total download limit
+func (info *DownloadInfo) bandwidthBuckets() []*tokenBucket {
+    info.bandwidthOnce.Do(func() {
+        info.bandwidth = &tokenBucket{rate: func() uint64 {
+            if limit := atomic.LoadUint64(&info.rateLimit); limit > 0 {
+                return limit
+            }
+            return info.Api.BandwidthActive().DownloadFile
+        }}
+    })
+
+    return []*tokenBucket{info.bandwidth, info.Api.bandwidth.download}
+}
+
+// bandwidthReader returns the reader limited by the rate of the download and the total download limit
+func (info *DownloadInfo) bandwidthReader(reader io.ReadCloser, cancel <-chan struct{}, throttle func(waiting bool)) io.ReadCloser {
+    if info.Api == nil {
+        return reader
+    }
+
+    return &bandwidthReader{ReadCloser: reader, buckets: info.bandwidthBuckets(), cancel: cancel, throttle: throttle}
+}
+
+// bandwidthWriter returns the writer limited by the rate of the download and the total download limit
+func (info *DownloadInfo) bandwidthWriter(writer io.Writer) io.Writer {
+    if info.Api == nil {
+        return writer
+    }
+
+    return &bandwidthWriter{Writer: writer, buckets: info.bandwidthBuckets()}
+}
+
+// SetRateLimit sets the rate limit of the download in bytes per second. 0 applies the default limit per download.
+func (info *DownloadInfo) SetRateLimit(limit uint64) {
+    atomic.StoreUint64(&info.rateLimit, limit)
+
+    if info.Api != nil {
+        info.Lock()
+        info.journalUpdate()
+        info.Unlock()
+    }
+}
+
+// RateLimit returns the rate limit of the download in bytes per second. 0 means the default limit per download applies.
+func (info *DownloadInfo) RateLimit() uint64 {
+    return atomic.LoadUint64(&info.rateLimit)
+}
+
+/*
+apiBandwidthGet returns the bandwidth limits, the schedule, and the limits currently applied.
+
+Request:    GET /bandwidth/get
+Response:   200 with JSON structure ApiBandwidth
+*/
+func (api *WebapiInstance) apiBandwidthGet(w http.ResponseWriter, r *http.Request) {
+    EncodeJSON(api.Backend, w, r, api.BandwidthGet())
+}
+
+/*
+apiBandwidthSet changes the bandwidth limits and the schedule. They apply immediately, including to running downloads and streams.
+The limits are in bytes per second, 0 means unlimited. The Active field is ignored.
+
+Request:    POST /bandwidth/set with JSON structure ApiBandwidth
+Response:   200 with JSON structure ApiBandwidth
+            400 if invalid input or schedule time
+*/
+func (api *WebapiInstance) apiBandwidthSet(w http.ResponseWriter, r *http.Request) {
+    var input ApiBandwidth
+    if err := DecodeJSON(w, r, &input); err != nil {
+        return
+    }
+
+    if err := api.BandwidthSet(input.Limits, input.Schedule); err != nil {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    EncodeJSON(api.Backend, w, r, api.BandwidthGet())
+}
@@ -0,0 +1,91 @@
+/*
+File Name:  Bandwidth_internal_test.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi
+
+import (
+    "testing"
+    "time"
+)
+
+func TestTokenBucket(t *testing.T) {
+    const rate = 100 * 1024
+    bucket := &tokenBucket{rate: func() uint64 { return rate }}
+
+    // The bucket starts full with the tokens of one second.
+    start := time.Now()
+    if !bucket.wait(rate, nil) || time.Since(start) > 50*time.Millisecond {
+        t.Fatalf("full bucket waited %s", time.Since(start))
+    }
+
+    // Afterwards data is delayed according to the rate.
+    start = time.Now()
+    if !bucket.wait(rate/4, nil) {
+        t.Fatal("wait canceled")
+    }
+    if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 500*time.Millisecond {
+        t.Fatalf("waited %s for a quarter second of data", elapsed)
+    }
+
+    // Waiting stops when canceled.
+    cancel := make(chan struct{})
+    close(cancel)
+    start = time.Now()
+    if bucket.wait(10*rate, cancel) || time.Since(start) > 50*time.Millisecond {
+        t.Fatal("canceled wait not stopped")
+    }
+
+    // Rate 0 is unlimited.
+    unlimited := &tokenBucket{rate: func() uint64 { return 0 }}
+    start = time.Now()
+    if !unlimited.wait(1<<30, nil) || time.Since(start) > 50*time.Millisecond {
+        t.Fatal("unlimited bucket waited")
+    }
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+    for text, minute := range map[string]int{"00:00": 0, "06:30": 390, "23:59": 1439} {
+        if parsed, err := parseTimeOfDay(text); err != nil || parsed != minute {
+            t.Errorf("parsing '%s' returned %d %v, expected %d", text, parsed, err, minute)
+        }
+    }
+
+    for _, text := range []string{"", "24:00", "12:60", "noon", "12:00:00"} {
+        if _, err := parseTimeOfDay(text); err != ErrBandwidthSchedule {
+            t.Errorf("parsing '%s' returned %v", text, err)
+        }
+    }
+}
+
+func TestBandwidthSchedule(t *testing.T) {
+    night := BandwidthLimits{Download: 1}
+    noon := BandwidthLimits{Download: 2}
+    standard := BandwidthLimits{Download: 3}
+
+    settings := ApiBandwidth{Limits: standard, Schedule: []BandwidthSchedule{
+        {Start: "invalid", End: "23:59", Limits: BandwidthLimits{Download: 4}}, // ignored
+        {Start: "22:00", End: "06:00", Limits: night},                         // spans midnight
+        {Start: "12:00", End: "13:00", Limits: noon},
+    }}
+
+    for clock, expected := range map[string]BandwidthLimits{
+        "21:59": standard,
+        "22:00": night,
+        "23:59": night,
+        "00:00": night,
+        "05:59": night,
+        "06:00": standard,
+        "11:59": standard,
+        "12:00": noon,
+        "12:59": noon,
+        "13:00": standard,
+    } {
+        now, _ := time.ParseInLocation("2006-01-02 15:04", "2021-06-01 "+clock, time.Local)
+        if limits := settings.limitsAt(now); limits != expected {
+            t.Errorf("limits at %s are %+v, expected %+v", clock, limits, expected)
+        }
+    }
+}
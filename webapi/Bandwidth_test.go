@@ -0,0 +1,89 @@
+/*
+File Name:  Bandwidth_test.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi_test
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/Abstraction/webapitest"
+    "github.com/google/uuid"
+)
+
+func TestBandwidthSet(t *testing.T) {
+    key := uuid.New()
+    backend := webapitest.NewBackend()
+    backend.Data = t.TempDir()
+    _, server := webapitest.NewServer(backend, key)
+
+    for _, invalid := range []string{"", "24:00", "6:00pm"} {
+        body, _ := json.Marshal(webapi.ApiBandwidth{Schedule: []webapi.BandwidthSchedule{{Start: invalid, End: "06:00"}}})
+        if code := request(t, server, key, "POST", "/bandwidth/set", body, nil); code != http.StatusBadRequest {
+            t.Errorf("schedule start '%s': status code %d, expected 400", invalid, code)
+        }
+    }
+
+    settings := webapi.ApiBandwidth{Limits: webapi.BandwidthLimits{Download: 1000, DownloadFile: 100, Stream: 10}, Schedule: []webapi.BandwidthSchedule{{Start: "22:00", End: "06:00", Limits: webapi.BandwidthLimits{Download: 5000}}}}
+    body, _ := json.Marshal(settings)
+
+    var result webapi.ApiBandwidth
+    if code := request(t, server, key, "POST", "/bandwidth/set", body, &result); code != http.StatusOK || result.Limits != settings.Limits || len(result.Schedule) != 1 || result.Schedule[0] != settings.Schedule[0] {
+        t.Fatalf("status code %d, settings %+v", code, result)
+    }
+    server.Close()
+
+    // The limits are kept after a restart.
+    _, server = webapitest.NewServer(backend, key)
+    defer server.Close()
+
+    if request(t, server, key, "GET", "/bandwidth/get", nil, &result); result.Limits != settings.Limits || len(result.Schedule) != 1 {
+        t.Fatalf("settings after restart %+v", result)
+    }
+}
+
+func TestBandwidthDownloadSelf(t *testing.T) {
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    const limit = 64 * 1024
+    if err := api.BandwidthSet(webapi.BandwidthLimits{Download: limit}, nil); err != nil {
+        t.Fatal(err)
+    }
+
+    // The user's own file is copied from the local warehouse, limited by the total download rate.
+    data := swarmData(1)[:2*limit]
+    hash, _, err := backend.Warehouse.CreateFile(bytes.NewReader(data), uint64(len(data)))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    target := filepath.Join(t.TempDir(), "self.bin")
+    start := time.Now()
+
+    info, err := api.DownloadStart(hash, backend.SelfNodeID(), target)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if status := waitDownload(t, info); status != webapi.DownloadFinished {
+        t.Fatalf("download ended with status %d", status)
+    }
+
+    // The bucket holds the data of one second, the rest is delayed by another second.
+    if elapsed := time.Since(start); elapsed < 750*time.Millisecond {
+        t.Fatalf("copying %d bytes took %s at a limit of %d bytes per second", len(data), elapsed, limit)
+    }
+    if stored, _ := os.ReadFile(target); !bytes.Equal(stored, data) {
+        t.Fatal("stored data does not match")
+    }
+}
@@ -24,10 +24,10 @@ type apiBlockchainHeader struct {
 apiBlockchainHeaderFunc returns the current blockchain header information
 
 Request:    GET /blockchain/header
-Result:     200 with JSON structure apiResponsePeerSelf
+Result:     200 with JSON structure ApiResponsePeerSelf
 */
 func (api *WebapiInstance) apiBlockchainHeaderFunc(w http.ResponseWriter, r *http.Request) {
-    publicKey, height, version := api.Backend.UserBlockchain.Header()
+    publicKey, height, version := api.Backend.UserBlockchain().Header()
 
     EncodeJSON(api.Backend, w, r, apiBlockchainHeader{Version: version, Height: height, PeerID: hex.EncodeToString(publicKey.SerializeCompressed())})
 }
@@ -42,7 +42,7 @@ type apiBlockchainBlockRaw struct {
     Records []apiBlockRecordRaw `json:"records"` // Block records in encoded raw format.
 }
 
-type apiBlockchainBlockStatus struct {
+type ApiBlockchainBlockStatus struct {
     Status  int    `json:"Status"`  // See blockchain.StatusX.
     Height  uint64 `json:"height"`  // Height of the blockchain (number of blocks).
     Version uint64 `json:"version"` // Version of the blockchain.
@@ -53,7 +53,7 @@ apiBlockchainAppend appends a block to the blockchain. This is a low-level funct
 Do not use this function. Adding invalid data to the blockchain may corrupt it which might result in blacklisting by other peers.
 
 Request:    POST /blockchain/append with JSON structure apiBlockchainBlockRaw
-Response:   200 with JSON structure apiBlockchainBlockStatus
+Response:   200 with JSON structure ApiBlockchainBlockStatus
 */
 func (api *WebapiInstance) apiBlockchainAppend(w http.ResponseWriter, r *http.Request) {
     var input apiBlockchainBlockRaw
@@ -67,9 +67,9 @@ func (api *WebapiInstance) apiBlockchainAppend(w http.ResponseWriter, r *http.Re
         records = append(records, blockchain.BlockRecordRaw{Type: record.Type, Data: record.Data})
     }
 
-    newHeight, newVersion, status := api.Backend.UserBlockchain.Append(records)
+    newHeight, newVersion, status := api.Backend.UserBlockchain().Append(records)
 
-    EncodeJSON(api.Backend, w, r, apiBlockchainBlockStatus{Status: status, Height: newHeight, Version: newVersion})
+    EncodeJSON(api.Backend, w, r, ApiBlockchainBlockStatus{Status: status, Height: newHeight, Version: newVersion})
 }
 
 type apiBlockchainBlock struct {
@@ -96,7 +96,7 @@ func (api *WebapiInstance) apiBlockchainRead(w http.ResponseWriter, r *http.Requ
         return
     }
 
-    block, status, _ := api.Backend.UserBlockchain.Read(uint64(blockN))
+    block, status, _ := api.Backend.UserBlockchain().Read(uint64(blockN))
     result := apiBlockchainBlock{Status: status}
 
     if status == 0 {
@@ -109,10 +109,10 @@ func (api *WebapiInstance) apiBlockchainRead(w http.ResponseWriter, r *http.Requ
         for _, record := range block.RecordsDecoded {
             switch v := record.(type) {
             case blockchain.BlockRecordFile:
-                result.RecordsDecoded = append(result.RecordsDecoded, blockRecordFileToAPI(v))
+                result.RecordsDecoded = append(result.RecordsDecoded, BlockRecordFileToAPI(v))
 
             case blockchain.BlockRecordProfile:
-                result.RecordsDecoded = append(result.RecordsDecoded, blockRecordProfileToAPI(v))
+                result.RecordsDecoded = append(result.RecordsDecoded, BlockRecordProfileToAPI(v))
 
             }
         }
@@ -0,0 +1,219 @@
+/*
+File Name:  Download History.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+
+Finished, canceled, and failed downloads are recorded in the download history. Unlike the downloads list, it survives restarts.
+*/
+
+package webapi
+
+import (
+    "encoding/hex"
+    "errors"
+    "net/http"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// DownloadHistoryFile is the name of the file in the data folder that stores the download history.
+const DownloadHistoryFile = "DownloadHistory.json"
+
+// DownloadHistoryMax is the maximum count of entries in the download history. The oldest entries are removed first.
+const DownloadHistoryMax = 1000
+
+// DownloadHistoryEntry is a download that ended
+type DownloadHistoryEntry struct {
+    ID      uuid.UUID `json:"id"`      // Download ID
+    Hash    []byte    `json:"hash"`    // File hash
+    NodeID  []byte    `json:"nodeid"`  // Node ID of the owner
+    Name    string    `json:"name"`    // File name, if known
+    Path    string    `json:"path"`    // Target file on disk
+    Size    uint64    `json:"size"`    // File size in bytes, if known
+    Created time.Time `json:"created"` // When the download was created
+    Ended   time.Time `json:"ended"`   // When the download ended
+    Status  int       `json:"status"`  // Outcome of the download: DownloadFinished, DownloadCanceled, or DownloadVerifyFailed.
+}
+
+// ApiResponseDownloadHistory contains the matching entries of the download history
+type ApiResponseDownloadHistory struct {
+    Total   int                    `json:"total"`   // Total count of matching entries.
+    Entries []DownloadHistoryEntry `json:"entries"` // Entries starting at the offset, most recent first.
+}
+
+var errHistoryNotFound = errors.New("download history entry not found")
+
+// historyInit loads the download history from the data folder
+func (api *WebapiInstance) historyInit() {
+    api.stateLoad("historyInit", DownloadHistoryFile, &api.history)
+}
+
+// historySave writes the download history. The caller must hold the history mutex.
+func (api *WebapiInstance) historySave() {
+    entries := api.history
+    if entries == nil {
+        entries = []DownloadHistoryEntry{}
+    }
+
+    api.stateSave("historySave", DownloadHistoryFile, entries)
+}
+
+// historyAdd records the ended download in the history. The history file is not written.
+func (api *WebapiInstance) historyAdd(entry DownloadHistoryEntry) {
+    api.historyMutex.Lock()
+    defer api.historyMutex.Unlock()
+
+    api.history = append(api.history, entry)
+    if len(api.history) > DownloadHistoryMax {
+        api.history = append([]DownloadHistoryEntry(nil), api.history[len(api.history)-DownloadHistoryMax:]...)
+    }
+}
+
+// historyEntry returns the history entry of the ended download. The caller must hold the lock.
+func (info *DownloadInfo) historyEntry() DownloadHistoryEntry {
+    path, err := filepath.Abs(info.DiskFile.Name)
+    if err != nil {
+        path = info.DiskFile.Name
+    }
+
+    ended := info.Ended
+    if ended.IsZero() {
+        ended = time.Now()
+    }
+
+    return DownloadHistoryEntry{ID: info.ID, Hash: info.Hash, NodeID: info.NodeID, Name: info.File.Name, Path: path, Size: info.File.Size, Created: info.Created, Ended: ended, Status: info.Status}
+}
+
+// DownloadHistory returns the entries of the download history matching the search text and status, most recent first.
+// The search text matches the file name and path (case-insensitive), and the hex encoded hash and node ID. Empty matches all entries.
+// If statuses is empty, all outcomes match. Limit 0 returns all entries starting at the offset.
+func (api *WebapiInstance) DownloadHistory(search string, statuses []int, offset, limit int) (result ApiResponseDownloadHistory) {
+    api.historyMutex.Lock()
+    defer api.historyMutex.Unlock()
+
+    search = strings.ToLower(search)
+    result.Entries = []DownloadHistoryEntry{}
+
+    for n := len(api.history) - 1; n >= 0; n-- {
+        entry := api.history[n]
+        if !entry.matches(search, statuses) {
+            continue
+        }
+
+        if result.Total >= offset && (limit <= 0 || len(result.Entries) < limit) {
+            result.Entries = append(result.Entries, entry)
+        }
+        result.Total++
+    }
+
+    return result
+}
+
+// matches checks if the history entry matches the lowercase search text and status filter
+func (entry *DownloadHistoryEntry) matches(search string, statuses []int) bool {
+    if len(statuses) > 0 && !containsInt(statuses, entry.Status) {
+        return false
+    }
+
+    return search == "" || strings.Contains(strings.ToLower(entry.Name), search) || strings.Contains(strings.ToLower(entry.Path), search) ||
+        strings.HasPrefix(hex.EncodeToString(entry.Hash), search) || strings.HasPrefix(hex.EncodeToString(entry.NodeID), search)
+}
+
+// DownloadHistoryDelete removes the download from the history
+func (api *WebapiInstance) DownloadHistoryDelete(id uuid.UUID) (err error) {
+    api.historyMutex.Lock()
+    defer api.historyMutex.Unlock()
+
+    for n := range api.history {
+        if api.history[n].ID == id {
+            api.history = append(api.history[:n], api.history[n+1:]...)
+            api.historySave()
+            return nil
+        }
+    }
+
+    return errHistoryNotFound
+}
+
+// DownloadHistoryClear removes all entries from the download history
+func (api *WebapiInstance) DownloadHistoryClear() {
+    api.historyMutex.Lock()
+    defer api.historyMutex.Unlock()
+
+    api.history = nil
+    api.historySave()
+}
+
+// containsInt checks if the list contains the value
+func containsInt(list []int, value int) bool {
+    for _, item := range list {
+        if item == value {
+            return true
+        }
+    }
+
+    return false
+}
+
+// parseStatusFilter parses the repeated &status= parameter. Invalid values are ignored.
+func parseStatusFilter(r *http.Request) (statuses []int) {
+    for _, text := range r.Form["status"] {
+        if status, err := strconv.Atoi(text); err == nil {
+            statuses = append(statuses, status)
+        }
+    }
+
+    return statuses
+}
+
+/*
+apiDownloadHistory returns the ended downloads, most recent first. The history is persisted and survives restarts.
+The search text matches the file name and path (case-insensitive), and the beginning of the hex encoded hash or node ID.
+The status filter can be repeated to match multiple outcomes (DownloadFinished, DownloadCanceled, DownloadVerifyFailed).
+
+Request:    GET /download/history?search=[text]&status=[status]&offset=[offset]&limit=[max records]
+Result:     200 with JSON structure ApiResponseDownloadHistory
+*/
+func (api *WebapiInstance) apiDownloadHistory(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    offset, _ := strconv.Atoi(r.Form.Get("offset"))
+    limit, err := strconv.Atoi(r.Form.Get("limit"))
+    if err != nil {
+        limit = 100
+    }
+
+    EncodeJSON(api.Backend, w, r, api.DownloadHistory(r.Form.Get("search"), parseStatusFilter(r), offset, limit))
+}
+
+/*
+apiDownloadHistoryClear removes a single download or all downloads from the history. Downloaded files are not deleted.
+
+Request:    POST /download/history/clear?ID=[download ID]
+            If the ID is omitted, the entire history is cleared.
+Result:     204 on success
+            404 if the download was not found in the history
+*/
+func (api *WebapiInstance) apiDownloadHistoryClear(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+
+    if text := r.Form.Get("ID"); text != "" {
+        id, err := uuid.Parse(text)
+        if err != nil {
+            http.Error(w, "", http.StatusBadRequest)
+            return
+        }
+
+        if err := api.DownloadHistoryDelete(id); err != nil {
+            http.Error(w, "", http.StatusNotFound)
+            return
+        }
+    } else {
+        api.DownloadHistoryClear()
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
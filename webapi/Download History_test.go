@@ -0,0 +1,122 @@
+/*
+File Name:  Download History_test.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi_test
+
+import (
+    "encoding/hex"
+    "encoding/json"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strconv"
+    "testing"
+    "time"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/Abstraction/webapitest"
+    "github.com/google/uuid"
+)
+
+func TestDownloadHistory(t *testing.T) {
+    key := uuid.New()
+    backend := webapitest.NewBackend()
+    backend.Data = t.TempDir()
+
+    // The history is full with old downloads, alternating finished and canceled ones.
+    var old []webapi.DownloadHistoryEntry
+    for n := 0; n < webapi.DownloadHistoryMax; n++ {
+        status := webapi.DownloadFinished
+        if n%2 == 1 {
+            status = webapi.DownloadCanceled
+        }
+        ended := time.Now().Add(time.Duration(n-webapi.DownloadHistoryMax) * time.Minute)
+        old = append(old, webapi.DownloadHistoryEntry{ID: uuid.New(), Name: "old-" + strconv.Itoa(n) + ".txt", Created: ended, Ended: ended, Status: status})
+    }
+    raw, _ := json.Marshal(old)
+    if err := os.WriteFile(filepath.Join(backend.Data, webapi.DownloadHistoryFile), raw, 0666); err != nil {
+        t.Fatal(err)
+    }
+
+    api, server := webapitest.NewServer(backend, key)
+
+    file := backend.AddPeer().AddFile(webapi.ApiFile{Name: "Report.txt"}, []byte("report data"))
+    info, err := api.DownloadStart(file.Hash, file.NodeID, filepath.Join(t.TempDir(), file.Name))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if status := waitDownload(t, info); status != webapi.DownloadFinished {
+        t.Fatalf("download ended with status %d", status)
+    }
+
+    // The oldest entry is removed, the new one is first.
+    all := api.DownloadHistory("", nil, 0, 0)
+    if all.Total != webapi.DownloadHistoryMax || len(all.Entries) != webapi.DownloadHistoryMax {
+        t.Fatalf("%d entries, expected %d", all.Total, webapi.DownloadHistoryMax)
+    }
+    if all.Entries[0].ID != info.ID || all.Entries[0].Name != file.Name || all.Entries[len(all.Entries)-1].ID != old[1].ID {
+        t.Fatalf("first entry %+v, last entry %+v", all.Entries[0], all.Entries[len(all.Entries)-1])
+    }
+
+    for _, test := range []struct {
+        search   string
+        statuses []int
+        total    int
+    }{
+        {"report", nil, 1},                         // name, case-insensitive
+        {hex.EncodeToString(file.Hash)[:8], nil, 1}, // beginning of the hash
+        {hex.EncodeToString(file.Hash)[8:16], nil, 0},
+        {"old-0.txt", nil, 0}, // removed
+        {"old-999.txt", nil, 1},
+        {"", []int{webapi.DownloadFinished}, webapi.DownloadHistoryMax / 2},
+        {"", []int{webapi.DownloadCanceled}, webapi.DownloadHistoryMax / 2},
+        {"", []int{webapi.DownloadFinished, webapi.DownloadCanceled}, webapi.DownloadHistoryMax},
+        {"", []int{webapi.DownloadVerifyFailed}, 0},
+        {"report", []int{webapi.DownloadCanceled}, 0},
+    } {
+        if result := api.DownloadHistory(test.search, test.statuses, 0, 0); result.Total != test.total || len(result.Entries) != test.total {
+            t.Errorf("search '%s' status %v: %d entries, expected %d", test.search, test.statuses, result.Total, test.total)
+        }
+    }
+
+    // paging
+    page := api.DownloadHistory("", nil, 10, 5)
+    if page.Total != webapi.DownloadHistoryMax || len(page.Entries) != 5 || page.Entries[0].ID != all.Entries[10].ID || page.Entries[4].ID != all.Entries[14].ID {
+        t.Fatalf("page with %d of %d entries", len(page.Entries), page.Total)
+    }
+
+    var result webapi.ApiResponseDownloadHistory
+    if request(t, server, key, "GET", "/download/history?search=report&limit=10", nil, &result); result.Total != 1 || result.Entries[0].ID != info.ID {
+        t.Fatalf("search via API returned %+v", result)
+    }
+
+    // Clearing is only possible via POST.
+    if code := request(t, server, key, "GET", "/download/history/clear", nil, nil); code != http.StatusMethodNotAllowed {
+        t.Fatalf("clearing via GET: status code %d", code)
+    }
+    if code := request(t, server, key, "POST", "/download/history/clear?ID="+uuid.New().String(), nil, nil); code != http.StatusNotFound {
+        t.Fatalf("clearing unknown download: status code %d", code)
+    }
+    if code := request(t, server, key, "POST", "/download/history/clear?ID="+old[1].ID.String(), nil, nil); code != http.StatusNoContent {
+        t.Fatalf("clearing download: status code %d", code)
+    }
+    server.Close()
+
+    // The history is kept after a restart.
+    api, server = webapitest.NewServer(backend, key)
+    defer server.Close()
+
+    if all = api.DownloadHistory("", nil, 0, 0); all.Total != webapi.DownloadHistoryMax-1 || all.Entries[0].ID != info.ID {
+        t.Fatalf("%d entries after restart", all.Total)
+    }
+
+    if code := request(t, server, key, "POST", "/download/history/clear", nil, nil); code != http.StatusNoContent {
+        t.Fatalf("clearing the history: status code %d", code)
+    }
+    if all = api.DownloadHistory("", nil, 0, 0); all.Total != 0 {
+        t.Fatalf("%d entries after clearing", all.Total)
+    }
+}
@@ -0,0 +1,178 @@
+/*
+File Name:  Download Journal.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi
+
+import (
+    "path/filepath"
+    "sort"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// DownloadJournalFile is the name of the file in the data folder that stores the unfinished downloads.
+const DownloadJournalFile = "Downloads.json"
+
+// DownloadJournalInterval is the minimum interval to write the journal because of download progress. Status changes are written immediately.
+const DownloadJournalInterval = 5 * time.Second
+
+// DownloadJournalEntry is the state of an unfinished download stored in the journal
+type DownloadJournalEntry struct {
+    ID         uuid.UUID `json:"id"`         // Download ID. It stays the same after a restart.
+    Hash       []byte    `json:"hash"`       // File hash
+    NodeID     []byte    `json:"nodeid"`     // Node ID of the owner
+    Path       string    `json:"path"`       // Target file on disk
+    StoredSize uint64    `json:"storedsize"` // Count of bytes stored in the target file
+    Status     int       `json:"status"`     // Status of the download. See DownloadX.
+    Created    time.Time `json:"created"`    // When the download was created
+    File       ApiFile   `json:"file"`       // File metadata, if known
+
+    Priority     int    `json:"priority,omitempty"`     // Priority of the download in the queue
+    RateLimit    uint64 `json:"ratelimit,omitempty"`    // Rate limit of the download in bytes per second
+    FragmentSize uint64 `json:"fragmentsize,omitempty"` // Size of fragments the file is downloaded in
+    Fragments    []bool `json:"fragments,omitempty"`    // Fragments stored in the target file. The download is resumed with the missing ones.
+}
+
+// downloadJournal contains the unfinished downloads as stored in the journal file
+type downloadJournal struct {
+    entries   map[uuid.UUID]DownloadJournalEntry
+    lastWrite time.Time
+}
+
+// downloadInit restores the unfinished downloads from the journal and resumes them with the missing fragments
+func (api *WebapiInstance) downloadInit() {
+    api.journal.entries = make(map[uuid.UUID]DownloadJournalEntry)
+
+    var entries []DownloadJournalEntry
+    if !api.stateLoad("downloadInit", DownloadJournalFile, &entries) {
+        return
+    }
+
+    // restore the queue order
+    sort.SliceStable(entries, func(i, j int) bool { return entries[i].Created.Before(entries[j].Created) })
+
+    for _, entry := range entries {
+        if err := api.downloadRestore(entry); err != nil {
+            api.Backend.LogError("downloadInit", "restoring download %s to '%s': %v", entry.ID.String(), entry.Path, err)
+        }
+    }
+}
+
+// downloadRestore restores the download from the journal entry and queues it. A paused download is queued once resumed.
+func (api *WebapiInstance) downloadRestore(entry DownloadJournalEntry) (err error) {
+    info := &DownloadInfo{Backend: api.Backend, Api: api, ID: entry.ID, Created: entry.Created, Hash: entry.Hash, NodeID: entry.NodeID, File: entry.File, priority: entry.Priority, rateLimit: entry.RateLimit}
+
+    if err = info.InitDiskFile(entry.Path); err != nil {
+        return err
+    }
+
+    info.DiskFile.StoredSize = entry.StoredSize
+    info.DiskFile.FragmentSize = entry.FragmentSize
+    info.DiskFile.Fragments = entry.Fragments
+
+    // The journal may be behind the target file, but never ahead of it unless the file was modified.
+    // Fragments beyond the end of the file are downloaded again.
+    if stat, err := info.DiskFile.Handle.Stat(); err == nil && uint64(stat.Size()) < info.DiskFile.StoredSize {
+        info.DiskFile.StoredSize = uint64(stat.Size())
+
+        for index := range info.DiskFile.Fragments {
+            end := uint64(index+1) * info.DiskFile.FragmentSize
+            if end > info.File.Size {
+                end = info.File.Size
+            }
+            if end > uint64(stat.Size()) {
+                info.DiskFile.Fragments[index] = false
+            }
+        }
+    }
+
+    api.DownloadAdd(info)
+
+    info.Lock()
+    defer info.Unlock()
+
+    if entry.Status == DownloadPause {
+        info.Status = DownloadPause
+        info.resumed = make(chan struct{})
+
+        go func() {
+            if info.waitResume() == DownloadActive {
+                info.Start()
+            }
+        }()
+    } else if api.downloadAcquire(info) {
+        go info.Start()
+    } else {
+        info.Status = DownloadQueued
+    }
+
+    api.journalMutex.Lock()
+    api.journal.entries[info.ID] = info.journalEntry()
+    api.journalMutex.Unlock()
+
+    return nil
+}
+
+// journalEntry returns the journal entry of the download. The caller must hold the lock.
+func (info *DownloadInfo) journalEntry() DownloadJournalEntry {
+    path, err := filepath.Abs(info.DiskFile.Name)
+    if err != nil {
+        path = info.DiskFile.Name
+    }
+
+    priority, _ := info.Api.downloadQueueStatus(info)
+
+    return DownloadJournalEntry{ID: info.ID, Hash: info.Hash, NodeID: info.NodeID, Path: path, StoredSize: info.DiskFile.StoredSize, Status: info.Status, Created: info.Created, File: info.File,
+        Priority: priority, RateLimit: info.RateLimit(), FragmentSize: info.DiskFile.FragmentSize, Fragments: append([]bool(nil), info.DiskFile.Fragments...)}
+}
+
+// journalUpdate updates the download in the journal. If the journal file needs to be written, it is written by Unlock. The caller must hold the lock.
+func (info *DownloadInfo) journalUpdate() {
+    info.journalStatus = info.Status
+    info.journalUpdated = time.Now()
+
+    if info.Api.stateFilename(DownloadJournalFile) != "" && info.Api.downloadJournalUpdate(info.journalEntry()) {
+        info.journalDirty = true
+    }
+}
+
+// downloadJournalUpdate updates the download in the journal. Finished and canceled downloads are removed.
+// It returns true if the journal file shall be written: Immediately on status changes and otherwise at most every DownloadJournalInterval.
+func (api *WebapiInstance) downloadJournalUpdate(entry DownloadJournalEntry) (save bool) {
+    api.journalMutex.Lock()
+    defer api.journalMutex.Unlock()
+
+    previous, exists := api.journal.entries[entry.ID]
+
+    if IsDownloadTerminal(entry.Status) {
+        if !exists {
+            return false
+        }
+        delete(api.journal.entries, entry.ID)
+        return true
+    }
+
+    api.journal.entries[entry.ID] = entry
+
+    return !exists || previous.Status != entry.Status || time.Since(api.journal.lastWrite) >= DownloadJournalInterval
+}
+
+// downloadJournalSave writes the current journal to the file
+func (api *WebapiInstance) downloadJournalSave() {
+    api.journalSave.Lock()
+    defer api.journalSave.Unlock()
+
+    api.journalMutex.Lock()
+    entries := []DownloadJournalEntry{}
+    for _, entry := range api.journal.entries {
+        entries = append(entries, entry)
+    }
+    api.journal.lastWrite = time.Now()
+    api.journalMutex.Unlock()
+
+    api.stateSave("downloadJournalSave", DownloadJournalFile, entries)
+}
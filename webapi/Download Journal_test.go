@@ -0,0 +1,135 @@
+/*
+File Name:  Download Journal_test.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi_test
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/Abstraction/webapitest"
+    "github.com/PeernetOfficial/core/merkle"
+    "github.com/google/uuid"
+)
+
+// waitProgress waits until the download stored at least the size
+func waitProgress(t *testing.T, info *webapi.DownloadInfo, size uint64) {
+    t.Helper()
+
+    for start := time.Now(); info.StatusResponse().Progress.DownloadedSize < size; time.Sleep(5 * time.Millisecond) {
+        if time.Since(start) > 10*time.Second {
+            t.Fatalf("download stored only %d bytes", info.StatusResponse().Progress.DownloadedSize)
+        }
+    }
+}
+
+// storedSize returns the status and the count of bytes stored in the target file
+func storedSize(info *webapi.DownloadInfo) (status int, stored uint64) {
+    info.RLock()
+    defer info.RUnlock()
+
+    return info.Status, info.DiskFile.StoredSize
+}
+
+// TestDownloadJournalRestart checks that unfinished downloads are restored after a restart: Paused ones stay paused, active ones continue at the stored size.
+func TestDownloadJournalRestart(t *testing.T) {
+    backend := webapitest.NewBackend()
+    backend.Data = t.TempDir()
+    directory := t.TempDir()
+
+    peer := backend.AddPeer()
+    peer.Delay = 50 * time.Millisecond
+    dataPaused, dataActive := swarmData(8), swarmData(8)
+    filePaused := peer.AddFile(webapi.ApiFile{Name: "paused.bin"}, dataPaused)
+    fileActive := peer.AddFile(webapi.ApiFile{Name: "active.bin"}, dataActive)
+
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+
+    paused, err := api.DownloadStart(filePaused.Hash, filePaused.NodeID, filepath.Join(directory, filePaused.Name))
+    if err != nil {
+        t.Fatal(err)
+    }
+    active, err := api.DownloadStart(fileActive.Hash, fileActive.NodeID, filepath.Join(directory, fileActive.Name))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    waitProgress(t, paused, merkle.MinimumFragmentSize)
+    waitProgress(t, active, merkle.MinimumFragmentSize)
+
+    // Status changes are written to the journal immediately. Pausing and resuming writes the current progress of the active download.
+    if paused.Pause() != webapi.DownloadResponseSuccess || active.Pause() != webapi.DownloadResponseSuccess || active.Resume() != webapi.DownloadResponseSuccess {
+        t.Fatal("pausing the downloads failed")
+    }
+
+    entries := make(map[uuid.UUID]webapi.DownloadJournalEntry)
+    for _, entry := range waitJournal(t, backend.Data, 2) {
+        entries[entry.ID] = entry
+    }
+    if entries[paused.ID].Status != webapi.DownloadPause || entries[active.ID].Status != webapi.DownloadActive {
+        t.Fatalf("journal entries %+v", entries)
+    }
+    journal, err := os.ReadFile(filepath.Join(backend.Data, webapi.DownloadJournalFile))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // Simulate a crash: The downloads of the old instance stop without updating the journal.
+    paused.Cancel()
+    active.Cancel()
+    server.Close()
+    if err := os.WriteFile(filepath.Join(backend.Data, webapi.DownloadJournalFile), journal, 0666); err != nil {
+        t.Fatal(err)
+    }
+
+    api, server = webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    restoredPaused, restoredActive := api.DownloadLookup(paused.ID), api.DownloadLookup(active.ID)
+    if restoredPaused == nil || restoredActive == nil {
+        t.Fatal("downloads not restored from the journal")
+    }
+
+    if status, stored := storedSize(restoredActive); status == webapi.DownloadPause || stored != entries[active.ID].StoredSize {
+        t.Fatalf("active download restored with status %d at %d bytes, expected %d", status, stored, entries[active.ID].StoredSize)
+    }
+    if status := waitDownload(t, restoredActive); status != webapi.DownloadFinished {
+        t.Fatalf("active download ended with status %d", status)
+    }
+
+    // Only the missing data was downloaded again.
+    var downloaded uint64
+    for _, peer := range restoredActive.StatusResponse().Swarm.Peers {
+        downloaded += peer.Downloaded
+    }
+    if downloaded > uint64(len(dataActive))-entries[active.ID].StoredSize {
+        t.Fatalf("downloaded %d bytes after the restart, expected at most %d", downloaded, uint64(len(dataActive))-entries[active.ID].StoredSize)
+    }
+    if stored, _ := os.ReadFile(filepath.Join(directory, fileActive.Name)); !bytes.Equal(stored, dataActive) {
+        t.Fatal("stored data of the active download does not match")
+    }
+
+    // The paused download did not continue in the meantime.
+    if status, stored := storedSize(restoredPaused); status != webapi.DownloadPause || stored != entries[paused.ID].StoredSize {
+        t.Fatalf("paused download restored with status %d at %d bytes, expected %d", status, stored, entries[paused.ID].StoredSize)
+    }
+
+    if restoredPaused.Resume() != webapi.DownloadResponseSuccess {
+        t.Fatal("resuming the paused download failed")
+    }
+    if status := waitDownload(t, restoredPaused); status != webapi.DownloadFinished {
+        t.Fatalf("paused download ended with status %d", status)
+    }
+    if stored, _ := os.ReadFile(filepath.Join(directory, filePaused.Name)); !bytes.Equal(stored, dataPaused) {
+        t.Fatal("stored data of the paused download does not match")
+    }
+
+    waitJournal(t, backend.Data, 0)
+}
@@ -0,0 +1,269 @@
+/*
+File Name:  Download Queue.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+
+The count of active downloads is limited. Each active or waiting download holds a slot until it is paused, canceled, or finished.
+Further downloads are queued by priority and started automatically once slots are freed.
+Resuming a paused download requires a slot as well, otherwise it is queued again.
+
+Lock order: The download lock may be held when acquiring the queue mutex, but not vice versa.
+*/
+
+package webapi
+
+import (
+    "net/http"
+    "strconv"
+)
+
+// DownloadMaxActiveDefault is the default maximum count of active downloads. Further downloads are queued.
+const DownloadMaxActiveDefault = 5
+
+// DownloadQueueFile is the name of the file in the data folder that stores the maximum count of active downloads.
+const DownloadQueueFile = "DownloadQueue.json"
+
+// downloadQueue contains the downloads waiting for a slot
+type downloadQueue struct {
+    queued []*DownloadInfo // Queued downloads in the order they are started. Ordered by priority (highest first).
+    active int             // Count of downloads holding a slot
+    max    int             // Maximum count of active downloads. 0 means unlimited.
+}
+
+// ApiDownloadQueue contains the maximum count of active downloads and the current usage of the slots
+type ApiDownloadQueue struct {
+    MaxActive int `json:"maxactive"` // Maximum count of active downloads. 0 means unlimited.
+    Active    int `json:"active"`    // Count of downloads holding a slot. Ignored when setting the limit.
+    Queued    int `json:"queued"`    // Count of downloads waiting for a slot. Ignored when setting the limit.
+}
+
+// downloadQueueSettings are the settings of the download queue stored in the data folder
+type downloadQueueSettings struct {
+    MaxActive int `json:"maxactive"`
+}
+
+// queueInit loads the maximum count of active downloads from the data folder
+func (api *WebapiInstance) queueInit() {
+    var settings downloadQueueSettings
+    if api.stateLoad("queueInit", DownloadQueueFile, &settings) && settings.MaxActive >= 0 {
+        api.queue.max = settings.MaxActive
+    }
+}
+
+// DownloadSetMaxActive sets the maximum count of active downloads. 0 means unlimited. Queued downloads are started if slots are available.
+// The limit is persisted in the data folder.
+func (api *WebapiInstance) DownloadSetMaxActive(max int) {
+    api.queueMutex.Lock()
+    api.queue.max = max
+    api.stateSave("DownloadSetMaxActive", DownloadQueueFile, downloadQueueSettings{MaxActive: max})
+    api.queueMutex.Unlock()
+
+    api.downloadSchedule()
+}
+
+// DownloadQueueGet returns the maximum count of active downloads and the count of active and queued downloads
+func (api *WebapiInstance) DownloadQueueGet() (queue ApiDownloadQueue) {
+    api.queueMutex.Lock()
+    defer api.queueMutex.Unlock()
+
+    return ApiDownloadQueue{MaxActive: api.queue.max, Active: api.queue.active, Queued: len(api.queue.queued)}
+}
+
+// downloadAcquire takes a slot for the download. If no slot is available, the download is queued by its priority.
+// It returns true if a slot was taken. The caller must hold the download lock.
+func (api *WebapiInstance) downloadAcquire(info *DownloadInfo) (acquired bool) {
+    api.queueMutex.Lock()
+    defer api.queueMutex.Unlock()
+
+    if len(api.queue.queued) == 0 && api.queue.hasSlot() {
+        api.queue.active++
+        info.slot = true
+        return true
+    }
+
+    // insert after all downloads with the same or higher priority
+    position := len(api.queue.queued)
+    for n, queued := range api.queue.queued {
+        if queued.priority < info.priority {
+            position = n
+            break
+        }
+    }
+    api.queue.insert(info, position)
+
+    return false
+}
+
+// downloadRelease frees the slot of the download or removes it from the queue. Queued downloads are started if slots are available.
+// It is called when the download is paused, canceled, or finished.
+func (api *WebapiInstance) downloadRelease(info *DownloadInfo) {
+    api.queueMutex.Lock()
+    defer api.queueMutex.Unlock()
+
+    if info.slot {
+        info.slot = false
+        api.queue.active--
+
+        go api.downloadSchedule() // the queued downloads cannot be started while the caller holds the download lock
+    } else if position := api.queue.position(info); position >= 0 {
+        api.queue.remove(position)
+    }
+}
+
+// downloadSchedule starts queued downloads while slots are available
+func (api *WebapiInstance) downloadSchedule() {
+    var start []*DownloadInfo
+
+    api.queueMutex.Lock()
+    for len(api.queue.queued) > 0 && api.queue.hasSlot() {
+        info := api.queue.queued[0]
+        api.queue.remove(0)
+
+        api.queue.active++
+        info.slot = true
+        start = append(start, info)
+    }
+    api.queueMutex.Unlock()
+
+    for _, info := range start {
+        info.dequeue()
+    }
+}
+
+// dequeue starts the download after it got a slot. A paused download that was resumed continues the transfer.
+func (info *DownloadInfo) dequeue() {
+    info.Lock()
+    defer info.Unlock()
+
+    if info.Status != DownloadQueued { // canceled in the meantime
+        return
+    }
+
+    if info.resumed != nil {
+        info.Status = DownloadActive
+        close(info.resumed)
+        info.resumed = nil
+    } else {
+        info.Status = DownloadWaitMetadata
+        go info.Start()
+    }
+
+    info.publish()
+}
+
+// DownloadMove moves the queued download to the position in the queue. Position 0 is the top and starts next. Status is DownloadResponseX.
+// The priority of the download is not changed, it only applies when downloads are queued.
+func (api *WebapiInstance) DownloadMove(info *DownloadInfo, position int) (status int) {
+    api.queueMutex.Lock()
+    defer api.queueMutex.Unlock()
+
+    current := api.queue.position(info)
+    if current < 0 { // The download must be queued.
+        return DownloadResponseActionInvalid
+    }
+
+    api.queue.remove(current)
+
+    if position < 0 {
+        position = 0
+    } else if position > len(api.queue.queued) {
+        position = len(api.queue.queued)
+    }
+    api.queue.insert(info, position)
+
+    return DownloadResponseSuccess
+}
+
+// DownloadSetPriority sets the priority of the download. Downloads with higher priority are started first.
+// If the download is queued, it is moved to the position matching the new priority. Status is DownloadResponseX.
+func (api *WebapiInstance) DownloadSetPriority(info *DownloadInfo, priority int) (status int) {
+    api.queueMutex.Lock()
+    defer api.queueMutex.Unlock()
+
+    info.priority = priority
+
+    current := api.queue.position(info)
+    if current < 0 {
+        return DownloadResponseSuccess
+    }
+
+    api.queue.remove(current)
+
+    position := len(api.queue.queued)
+    for n, queued := range api.queue.queued {
+        if queued.priority < priority {
+            position = n
+            break
+        }
+    }
+    api.queue.insert(info, position)
+
+    return DownloadResponseSuccess
+}
+
+// downloadQueueStatus returns the priority and queue position of the download. The position is -1 if not queued.
+func (api *WebapiInstance) downloadQueueStatus(info *DownloadInfo) (priority, position int) {
+    api.queueMutex.Lock()
+    defer api.queueMutex.Unlock()
+
+    return info.priority, api.queue.position(info)
+}
+
+// hasSlot checks if a slot is available. The caller must hold the queue mutex.
+func (queue *downloadQueue) hasSlot() bool {
+    return queue.max <= 0 || queue.active < queue.max
+}
+
+// position returns the position of the download in the queue, or -1 if not queued. The caller must hold the queue mutex.
+func (queue *downloadQueue) position(info *DownloadInfo) int {
+    for n, queued := range queue.queued {
+        if queued == info {
+            return n
+        }
+    }
+
+    return -1
+}
+
+// insert inserts the download at the position. The caller must hold the queue mutex.
+func (queue *downloadQueue) insert(info *DownloadInfo, position int) {
+    queue.queued = append(queue.queued, nil)
+    copy(queue.queued[position+1:], queue.queued[position:])
+    queue.queued[position] = info
+}
+
+// remove removes the download at the position. The caller must hold the queue mutex.
+func (queue *downloadQueue) remove(position int) {
+    queue.queued = append(queue.queued[:position], queue.queued[position+1:]...)
+}
+
+/*
+apiDownloadQueue returns the maximum count of active downloads and the count of active and queued downloads.
+
+Request:    GET /download/queue
+Result:     200 with JSON structure ApiDownloadQueue
+*/
+func (api *WebapiInstance) apiDownloadQueue(w http.ResponseWriter, r *http.Request) {
+    EncodeJSON(api.Backend, w, r, api.DownloadQueueGet())
+}
+
+/*
+apiDownloadQueueSet changes the maximum count of active downloads. 0 means unlimited. Queued downloads are started if slots are available.
+The limit is persisted and applies after a restart.
+
+Request:    GET /download/queue/set?max=[count]
+Result:     200 with JSON structure ApiDownloadQueue
+            400 if the count is invalid
+*/
+func (api *WebapiInstance) apiDownloadQueueSet(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    max, err := strconv.Atoi(r.Form.Get("max"))
+    if err != nil || max < 0 {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    api.DownloadSetMaxActive(max)
+
+    EncodeJSON(api.Backend, w, r, api.DownloadQueueGet())
+}
@@ -0,0 +1,136 @@
+/*
+File Name:  Download Queue_test.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi_test
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/Abstraction/webapitest"
+    "github.com/google/uuid"
+)
+
+// queuePositions checks the position of each download in the queue. -1 means not queued.
+func queuePositions(t *testing.T, downloads map[string]*webapi.DownloadInfo, expected map[string]int) {
+    t.Helper()
+
+    for name, position := range expected {
+        if status := downloads[name].StatusResponse(); status.Queue.Position != position {
+            t.Errorf("download %s at position %d with status %d, expected position %d", name, status.Queue.Position, status.DownloadStatus, position)
+        }
+    }
+}
+
+// waitDequeued waits until the download left the queue
+func waitDequeued(t *testing.T, info *webapi.DownloadInfo) {
+    t.Helper()
+
+    for start := time.Now(); info.GetStatus() == webapi.DownloadQueued; time.Sleep(5 * time.Millisecond) {
+        if time.Since(start) > 10*time.Second {
+            t.Fatal("download not started from the queue")
+        }
+    }
+}
+
+func TestDownloadQueueOrder(t *testing.T) {
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    api.DownloadSetMaxActive(1)
+
+    // Transfers are delayed so the active download does not finish during the test.
+    peer := backend.AddPeer()
+    peer.Delay = 50 * time.Millisecond
+
+    directory := t.TempDir()
+    data := make(map[string][]byte)
+    files := make(map[string]webapi.ApiFile)
+    downloads := make(map[string]*webapi.DownloadInfo)
+
+    for _, name := range []string{"a", "b", "c", "d"} {
+        data[name] = swarmData(4)
+        files[name] = peer.AddFile(webapi.ApiFile{Name: name}, data[name])
+    }
+
+    for _, start := range []struct {
+        name     string
+        priority int
+    }{{"a", 0}, {"b", 0}, {"c", 5}, {"d", 0}} {
+        info, err := api.DownloadStartPriority(files[start.name].Hash, files[start.name].NodeID, filepath.Join(directory, start.name), start.priority)
+        if err != nil {
+            t.Fatal(err)
+        }
+        downloads[start.name] = info
+    }
+
+    // The first download takes the only slot, the others are queued by priority.
+    if status := downloads["a"].GetStatus(); status == webapi.DownloadQueued {
+        t.Fatal("first download queued")
+    }
+    queuePositions(t, downloads, map[string]int{"a": -1, "c": 0, "b": 1, "d": 2})
+
+    // A higher priority moves the download to the top.
+    if api.DownloadSetPriority(downloads["d"], 10) != webapi.DownloadResponseSuccess {
+        t.Fatal("setting the priority failed")
+    }
+    queuePositions(t, downloads, map[string]int{"d": 0, "c": 1, "b": 2})
+
+    // Moving changes the position, but not the priority.
+    if api.DownloadMove(downloads["b"], 0) != webapi.DownloadResponseSuccess {
+        t.Fatal("moving the download failed")
+    }
+    queuePositions(t, downloads, map[string]int{"b": 0, "d": 1, "c": 2})
+    if api.DownloadMove(downloads["a"], 0) != webapi.DownloadResponseActionInvalid {
+        t.Fatal("active download moved in the queue")
+    }
+
+    // Pausing releases the slot: The top of the queue starts.
+    waitProgress(t, downloads["a"], 1)
+    if downloads["a"].Pause() != webapi.DownloadResponseSuccess {
+        t.Fatal("pausing the download failed")
+    }
+    waitDequeued(t, downloads["b"])
+    queuePositions(t, downloads, map[string]int{"a": -1, "b": -1, "d": 0, "c": 1})
+
+    if queue := api.DownloadQueueGet(); queue.Active != 1 || queue.Queued != 2 {
+        t.Fatalf("queue %+v, expected 1 active and 2 queued", queue)
+    }
+
+    // Resuming requires a slot again: The download is queued after the ones with higher priority.
+    if downloads["a"].Resume() != webapi.DownloadResponseSuccess || downloads["a"].GetStatus() != webapi.DownloadQueued {
+        t.Fatalf("resumed download in status %d, expected queued", downloads["a"].GetStatus())
+    }
+    queuePositions(t, downloads, map[string]int{"d": 0, "c": 1, "a": 2})
+
+    // Canceling releases the slot as well.
+    if downloads["b"].Cancel() != webapi.DownloadResponseSuccess {
+        t.Fatal("canceling the download failed")
+    }
+    waitDequeued(t, downloads["d"])
+    queuePositions(t, downloads, map[string]int{"d": -1, "c": 0, "a": 1})
+
+    // Without limit, all queued downloads start.
+    api.DownloadSetMaxActive(0)
+
+    for _, name := range []string{"a", "c", "d"} {
+        if status := waitDownload(t, downloads[name]); status != webapi.DownloadFinished {
+            t.Fatalf("download %s ended with status %d", name, status)
+        }
+        if stored, _ := os.ReadFile(filepath.Join(directory, name)); !bytes.Equal(stored, data[name]) {
+            t.Fatalf("stored data of download %s does not match", name)
+        }
+    }
+
+    if queue := api.DownloadQueueGet(); queue.Active != 0 || queue.Queued != 0 {
+        t.Fatalf("queue %+v after all downloads ended", queue)
+    }
+}
@@ -0,0 +1,636 @@
+/*
+File Name:  Download Swarm.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+
+The file is split into fragments using the fragment size of the file record. Fragments are downloaded in parallel from all peers
+known to share the file. A fragment is only marked as stored once it was received completely. Fragments of a failed or stalled
+peer are reassigned to the other peers.
+*/
+
+package webapi
+
+import (
+    "bytes"
+    "errors"
+    "io"
+    "sync"
+    "time"
+
+    "github.com/PeernetOfficial/core"
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/merkle"
+    "github.com/PeernetOfficial/core/protocol"
+    "lukechampine.com/blake3"
+)
+
+// SwarmMaxPeers is the maximum count of peers a download fetches fragments from in parallel.
+var SwarmMaxPeers = 16
+
+// SwarmStallTimeout is the time after which a peer not delivering any data is considered stalled. Its fragment is reassigned.
+var SwarmStallTimeout = 30 * time.Second
+
+// SwarmMaxErrors is the count of failed fragments after which a peer is dropped from the swarm.
+const SwarmMaxErrors = 3
+
+// DownloadPeer is a peer participating in the swarm of a download.
+type DownloadPeer struct {
+    Peer       *core.PeerInfo // Peer
+    Downloaded uint64         // Count of bytes received from the peer.
+    Fragments  uint64         // Count of fragments received completely.
+    Errors     int            // Count of failed or stalled fragments.
+    Active     bool           // If false, the peer was dropped from the swarm.
+    Started    time.Time      // When the peer joined the swarm.
+    Ended      time.Time      // When the peer left the swarm.
+}
+
+// ApiDownloadPeer is a peer participating in the swarm of a download.
+type ApiDownloadPeer struct {
+    NodeID     []byte `json:"nodeid"`     // Node ID of the peer.
+    Downloaded uint64 `json:"downloaded"` // Count of bytes received from the peer.
+    Fragments  uint64 `json:"fragments"`  // Count of fragments received completely.
+    Throughput uint64 `json:"throughput"` // Average throughput in bytes per second while the peer participated in the swarm.
+    Active     bool   `json:"active"`     // If false, the peer was dropped from the swarm after failing or stalling repeatedly.
+}
+
+// Throughput returns the average throughput of the peer in bytes per second
+func (peer *DownloadPeer) Throughput() uint64 {
+    ended := peer.Ended
+    if peer.Active || ended.IsZero() {
+        ended = time.Now()
+    }
+
+    if duration := ended.Sub(peer.Started).Seconds(); duration > 0 {
+        return uint64(float64(peer.Downloaded) / duration)
+    }
+
+    return 0
+}
+
+// downloadSwarm is a single transfer of the remaining fragments
+type downloadSwarm struct {
+    info      *DownloadInfo
+    stop      chan struct{} // Closed when the transfer is stopped by pausing or canceling the download.
+    fileSize  uint64
+    fragments uint64        // Count of fragments of the file
+    queue     chan uint64   // Indexes of fragments to download. Failed fragments are queued again.
+    remaining int           // Count of fragments not yet stored. Protected by the download lock.
+    done      chan struct{} // Closed when all fragments are stored.
+    workers   int           // Count of running workers. Protected by the download lock.
+    wait      sync.WaitGroup
+}
+
+// swarmReader makes sure the reader is only closed once. It is closed by the stall watchdog, when the transfer is stopped, and when the fragment is done.
+type swarmReader struct {
+    io.ReadCloser
+    once sync.Once
+}
+
+func (reader *swarmReader) Close() (err error) {
+    reader.once.Do(func() { err = reader.ReadCloser.Close() })
+    return err
+}
+
+// errTransferStopped is returned internally when the transfer was stopped because the download is not active anymore
+var errTransferStopped = errors.New("transfer stopped")
+
+// errNoSources is returned if no peer is available to download the file from
+var errNoSources = errors.New("no peer shares the file")
+
+// transferSwarm downloads the remaining fragments from the swarm. It returns true if all fragments are stored.
+// If the download is paused or canceled in the meantime, it returns false.
+func (info *DownloadInfo) transferSwarm() (finished bool, err error) {
+    info.Lock()
+    stop := make(chan struct{})
+    info.transferStop = stop
+    info.Unlock()
+
+    sources, record := info.swarmSources()
+    if len(sources) == 0 {
+        return false, errNoSources
+    }
+
+    // The size of the file is taken from the file record. If no record is available, the first peer is asked.
+    var fileSize, fragmentSize uint64
+    if record != nil {
+        fileSize, fragmentSize = record.Size, record.FragmentSize
+    } else {
+        reader, size, _, err := info.Backend.FileTransfer(sources[0], info.Hash, 0, 1, stop)
+        if err != nil {
+            return false, err
+        }
+        reader.Close()
+        fileSize = size
+    }
+    if fragmentSize == 0 {
+        fragmentSize = merkle.CalculateFragmentSize(fileSize)
+    }
+
+    info.Lock()
+    if info.Status < DownloadActive {
+        if record != nil && info.File.Hash == nil {
+            info.File = BlockRecordFileToAPI(*record)
+        }
+        info.File.Size = fileSize
+        info.Status = DownloadActive
+        info.publish()
+    } else if info.Status != DownloadActive || info.transferStop != stop { // paused or canceled in the meantime
+        info.Unlock()
+        return false, nil
+    }
+
+    if fileSize != info.File.Size {
+        info.Unlock()
+        return false, errors.New("file size mismatch")
+    }
+
+    info.initFragments(fragmentSize)
+
+    swarm := &downloadSwarm{info: info, stop: stop, fileSize: fileSize, fragments: uint64(len(info.DiskFile.Fragments)), done: make(chan struct{})}
+    swarm.queue = make(chan uint64, len(info.DiskFile.Fragments))
+    for index, stored := range info.DiskFile.Fragments {
+        if !stored {
+            swarm.queue <- uint64(index)
+            swarm.remaining++
+        }
+    }
+
+    info.Swarm.Peers = nil
+    for _, peer := range sources {
+        info.Swarm.Peers = append(info.Swarm.Peers, &DownloadPeer{Peer: peer, Active: true, Started: time.Now()})
+    }
+    info.Swarm.CountPeers = uint64(len(sources))
+    remaining := swarm.remaining
+    if remaining > 0 {
+        info.swarm = swarm
+        for _, peer := range info.Swarm.Peers {
+            swarm.start(peer)
+        }
+    }
+    info.publish()
+    info.Unlock()
+
+    if remaining == 0 {
+        return true, nil
+    }
+
+    swarm.wait.Wait()
+
+    info.Lock()
+    if info.swarm == swarm {
+        info.swarm = nil
+    }
+    remaining = swarm.remaining
+    stopped := info.Status != DownloadActive || info.transferStop != stop
+    discovery := info.discovery
+    info.Unlock()
+
+    if remaining == 0 {
+        return true, nil
+    } else if stopped {
+        return false, nil
+    }
+
+    // All peers failed. Wait for the discovery to finish and try again if other peers were found in the meantime.
+    select {
+    case <-discovery:
+    case <-stop:
+        return false, nil
+    }
+
+    if info.swarmNewSources() {
+        return info.transferSwarm()
+    }
+
+    return false, errors.New("no peer left in the swarm")
+}
+
+// swarmNewSources checks if peers were discovered that did not participate in the last swarm
+func (info *DownloadInfo) swarmNewSources() bool {
+    info.RLock()
+    defer info.RUnlock()
+
+    for _, source := range info.sources {
+        if !info.isSource(source) {
+            continue
+        }
+
+        participated := false
+        for _, peer := range info.Swarm.Peers {
+            participated = participated || peer.Peer == source
+        }
+        if !participated {
+            return true
+        }
+    }
+
+    return false
+}
+
+// start starts the worker downloading fragments from the peer. The caller must hold the lock.
+func (swarm *downloadSwarm) start(peer *DownloadPeer) {
+    swarm.workers++
+    swarm.wait.Add(1)
+
+    go func() {
+        swarm.worker(peer)
+
+        swarm.info.Lock()
+        swarm.workers--
+        swarm.info.Unlock()
+
+        swarm.wait.Done()
+    }()
+}
+
+// join adds the discovered peer to the running swarm. The caller must hold the lock.
+// Once all workers ended, the swarm is finishing and peers cannot join anymore.
+func (swarm *downloadSwarm) join(peer *core.PeerInfo) {
+    info := swarm.info
+
+    if swarm.workers == 0 || info.Status != DownloadActive || info.transferStop != swarm.stop || len(info.Swarm.Peers) >= SwarmMaxPeers || !info.isSource(peer) {
+        return
+    }
+
+    member := &DownloadPeer{Peer: peer, Active: true, Started: time.Now()}
+    info.Swarm.Peers = append(info.Swarm.Peers, member)
+    info.Swarm.CountPeers++
+    info.publish()
+
+    swarm.start(member)
+}
+
+// swarmSources returns the known peers sharing the file, starting with the owner. The file record is returned if found on any of the blockchains.
+// Only the blockchain of the owner is read before the transfer starts. Other peers are discovered in the background and join the running swarm.
+// The peers are kept for later transfers and verification retries. It waits for the discovery only if no peer or no file record is known yet.
+func (info *DownloadInfo) swarmSources() (peers []*core.PeerInfo, record *blockchain.BlockRecordFile) {
+    info.swarmDiscover()
+
+    for {
+        peers = nil
+
+        info.RLock()
+        for _, peer := range info.sources {
+            if len(peers) < SwarmMaxPeers && info.isSource(peer) {
+                peers = append(peers, peer)
+            }
+        }
+        record, discovery := info.record, info.discovery
+        info.RUnlock()
+
+        if len(peers) > 0 && record != nil {
+            return peers, record
+        }
+
+        select {
+        case <-discovery:
+            return peers, record
+        default:
+            <-discovery
+        }
+    }
+}
+
+// swarmDiscover reads the file record from the owner's blockchain and starts the discovery of other peers sharing the file. It runs only once per download.
+func (info *DownloadInfo) swarmDiscover() {
+    info.Lock()
+    if info.discovery != nil {
+        info.Unlock()
+        return
+    }
+    discovery := make(chan struct{})
+    info.discovery = discovery
+    owner := info.Peer
+    info.Unlock()
+
+    if owner != nil {
+        record := info.swarmFindRecord(owner)
+
+        info.Lock()
+        info.sources = append(info.sources, owner)
+        info.record = record
+        info.Unlock()
+    }
+
+    go func() {
+        defer close(discovery)
+        info.swarmDiscoverPeers(owner)
+    }()
+}
+
+// swarmDiscoverPeers searches the blockchains of connected peers for the file. Found peers join the running swarm.
+// It stops once enough peers are known or the download ended.
+func (info *DownloadInfo) swarmDiscoverPeers(owner *core.PeerInfo) {
+    selfID := info.Backend.SelfNodeID()
+
+    for _, peer := range info.Backend.PeerlistGet() {
+        info.RLock()
+        count, status := 0, info.Status
+        for _, source := range info.sources {
+            if info.isSource(source) {
+                count++
+            }
+        }
+        skip := bytes.Equal(peer.NodeID, selfID) || (owner != nil && bytes.Equal(peer.NodeID, owner.NodeID)) || !info.isSource(peer)
+        info.RUnlock()
+
+        if count >= SwarmMaxPeers || IsDownloadTerminal(status) {
+            return
+        } else if skip {
+            continue
+        }
+
+        found := info.swarmFindRecord(peer)
+        if found == nil {
+            continue
+        }
+
+        info.Lock()
+        info.sources = append(info.sources, peer)
+        if info.record == nil {
+            info.record = found
+        }
+        if info.swarm != nil {
+            info.swarm.join(peer)
+        }
+        info.Unlock()
+    }
+}
+
+// swarmFindRecord returns the file record with the hash from the peer's blockchain, if available
+func (info *DownloadInfo) swarmFindRecord(peer *core.PeerInfo) (record *blockchain.BlockRecordFile) {
+    for blockN := uint64(0); blockN < peer.BlockchainHeight; blockN++ {
+        blockDecoded, _, found, _ := info.Backend.ReadBlock(peer.PublicKey, peer.BlockchainVersion, blockN)
+        if !found {
+            continue
+        }
+
+        for _, decoded := range blockDecoded.RecordsDecoded {
+            if file, ok := decoded.(blockchain.BlockRecordFile); ok && bytes.Equal(file.Hash, info.Hash) {
+                return &file
+            }
+        }
+    }
+
+    return nil
+}
+
+// initFragments initializes the list of stored fragments. If the fragment size changed, fragments covered by the stored size are considered stored.
+// The stored size is set to the count of bytes in stored fragments. The caller must hold the lock.
+func (info *DownloadInfo) initFragments(fragmentSize uint64) {
+    count := (info.File.Size + fragmentSize - 1) / fragmentSize
+
+    keep := info.DiskFile.FragmentSize == fragmentSize && uint64(len(info.DiskFile.Fragments)) == count
+    if !keep {
+        info.DiskFile.FragmentSize = fragmentSize
+        info.DiskFile.Fragments = make([]bool, count)
+    }
+
+    storedSize := info.DiskFile.StoredSize
+    info.DiskFile.StoredSize = 0
+
+    for index := range info.DiskFile.Fragments {
+        offset, length := info.fragmentRange(uint64(index))
+        if !keep && offset+length <= storedSize {
+            info.DiskFile.Fragments[index] = true
+        }
+        if info.DiskFile.Fragments[index] {
+            info.DiskFile.StoredSize += length
+        }
+    }
+}
+
+// fragmentRange returns the offset and length of the fragment. The caller must hold the lock.
+func (info *DownloadInfo) fragmentRange(index uint64) (offset, length uint64) {
+    offset = index * info.DiskFile.FragmentSize
+    length = info.DiskFile.FragmentSize
+    if offset+length > info.File.Size {
+        length = info.File.Size - offset
+    }
+
+    return offset, length
+}
+
+// worker downloads fragments from the peer until all fragments are stored, the transfer is stopped, or the peer failed too often.
+func (swarm *downloadSwarm) worker(peer *DownloadPeer) {
+    for {
+        select {
+        case <-swarm.stop:
+            return
+        case <-swarm.done:
+            return
+        case index := <-swarm.queue:
+            err := swarm.fetch(peer, index)
+            if err == nil {
+                continue
+            }
+
+            swarm.queue <- index // reassign the fragment
+
+            if err == errTransferStopped {
+                return
+            }
+
+            info := swarm.info
+            info.Lock()
+            peer.Errors++
+            if err == errFragmentCorrupt { // The peer delivered corrupted data and is not used anymore.
+                info.excludeSource(string(peer.Peer.NodeID))
+                peer.Errors = SwarmMaxErrors
+            }
+            if peer.Errors >= SwarmMaxErrors {
+                peer.Active = false
+                peer.Ended = time.Now()
+                info.Swarm.CountPeers--
+                info.publish()
+            }
+            active := peer.Active
+            info.Unlock()
+
+            info.Backend.LogError("Download", "download %s fragment %d from peer %x: %v\n", info.ID.String(), index, peer.Peer.NodeID, err)
+
+            if !active {
+                return
+            }
+        }
+    }
+}
+
+// fetch downloads a single fragment from the peer. Data of an incomplete fragment is not counted as stored.
+func (swarm *downloadSwarm) fetch(peer *DownloadPeer, index uint64) (err error) {
+    info := swarm.info
+
+    info.RLock()
+    offset, length := info.fragmentRange(index)
+    info.RUnlock()
+
+    transferReader, fileSize, transferSize, err := info.Backend.FileTransfer(peer.Peer, info.Hash, offset, length, swarm.stop)
+    if err != nil {
+        return err
+    }
+
+    reader := &swarmReader{ReadCloser: transferReader}
+    defer reader.Close()
+
+    // If no data is received within the stall timeout, the reader is closed and the fragment is reassigned.
+    // Time spent waiting for the bandwidth limit does not count.
+    watchdog := time.AfterFunc(SwarmStallTimeout, func() { reader.Close() })
+    defer watchdog.Stop()
+
+    limited := info.bandwidthReader(reader, swarm.stop, func(waiting bool) {
+        if waiting {
+            watchdog.Stop()
+        } else {
+            watchdog.Reset(SwarmStallTimeout)
+        }
+    })
+
+    if fileSize != swarm.fileSize || transferSize != length {
+        return errors.New("file size mismatch")
+    } else if !swarm.register(reader) {
+        return errTransferStopped
+    }
+    defer swarm.unregister(reader)
+
+    // The fragment is hashed while receiving. It can be verified immediately if the expected hash is known.
+    expectedHash := swarm.fragmentHash(index)
+    hasher := blake3.New(protocol.HashSize, nil)
+
+    var received uint64
+    data := make([]byte, 4096)
+
+    for received < length {
+        readSize := uint64(len(data))
+        if length-received < readSize {
+            readSize = length - received
+        }
+
+        n, err := limited.Read(data[:readSize])
+
+        if n > 0 {
+            watchdog.Reset(SwarmStallTimeout)
+
+            if status := swarm.store(peer, data[:n], offset+received); status == DownloadResponseActionInvalid { // not active anymore
+                swarm.discard(received)
+                return errTransferStopped
+            } else if status != DownloadResponseSuccess {
+                swarm.discard(received)
+                return errors.New("error writing file")
+            }
+
+            hasher.Write(data[:n])
+            received += uint64(n)
+        }
+
+        if err != nil && received < length {
+            swarm.discard(received)
+
+            select {
+            case <-swarm.stop:
+                return errTransferStopped
+            default:
+            }
+
+            if err == io.EOF {
+                err = io.ErrUnexpectedEOF
+            }
+            return err
+        }
+    }
+
+    if expectedHash != nil && !bytes.Equal(hasher.Sum(nil), expectedHash) {
+        swarm.discard(received)
+        return errFragmentCorrupt
+    }
+
+    swarm.complete(peer, index)
+
+    return nil
+}
+
+// register registers the reader to be closed when the transfer is stopped. It returns false if the transfer was already stopped.
+func (swarm *downloadSwarm) register(reader io.ReadCloser) bool {
+    info := swarm.info
+    info.Lock()
+    defer info.Unlock()
+
+    if info.Status != DownloadActive || info.transferStop != swarm.stop {
+        return false
+    }
+
+    if info.transferReaders == nil {
+        info.transferReaders = make(map[io.ReadCloser]struct{})
+    }
+    info.transferReaders[reader] = struct{}{}
+
+    return true
+}
+
+func (swarm *downloadSwarm) unregister(reader io.ReadCloser) {
+    swarm.info.Lock()
+    delete(swarm.info.transferReaders, reader)
+    swarm.info.Unlock()
+}
+
+// store stores received data of a fragment. It does not change the download Status.
+func (swarm *downloadSwarm) store(peer *DownloadPeer, data []byte, offset uint64) (status int) {
+    info := swarm.info
+    info.Lock()
+    defer info.Unlock()
+
+    if info.Status != DownloadActive || info.transferStop != swarm.stop { // The download must be active.
+        return DownloadResponseActionInvalid
+    }
+
+    if _, err := info.DiskFile.Handle.WriteAt(data, int64(offset)); err != nil {
+        return DownloadResponseFileWrite
+    }
+
+    info.DiskFile.StoredSize += uint64(len(data))
+    peer.Downloaded += uint64(len(data))
+    info.publish()
+
+    return DownloadResponseSuccess
+}
+
+// discard removes the data of an incomplete fragment from the stored size. The fragment is downloaded again.
+func (swarm *downloadSwarm) discard(size uint64) {
+    if size == 0 {
+        return
+    }
+
+    info := swarm.info
+    info.Lock()
+    info.DiskFile.StoredSize -= size
+    info.publish()
+    info.Unlock()
+}
+
+// complete marks the fragment as stored
+func (swarm *downloadSwarm) complete(peer *DownloadPeer, index uint64) {
+    info := swarm.info
+    info.Lock()
+    defer info.Unlock()
+
+    info.DiskFile.Fragments[index] = true
+    peer.Fragments++
+
+    if info.fragmentSources == nil {
+        info.fragmentSources = make(map[uint64]string)
+    }
+    info.fragmentSources[index] = string(peer.Peer.NodeID)
+
+    swarm.remaining--
+    if swarm.remaining == 0 {
+        close(swarm.done)
+    }
+}
+
+// swarmStatus returns the peers participating in the swarm. The caller must hold the lock.
+func (info *DownloadInfo) swarmStatus() (peers []ApiDownloadPeer) {
+    for _, peer := range info.Swarm.Peers {
+        peers = append(peers, ApiDownloadPeer{NodeID: peer.Peer.NodeID, Downloaded: peer.Downloaded, Fragments: peer.Fragments, Throughput: peer.Throughput(), Active: peer.Active})
+    }
+
+    return peers
+}
@@ -0,0 +1,118 @@
+/*
+File Name:  Download Swarm_test.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi_test
+
+import (
+    "bytes"
+    "math/rand"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/Abstraction/webapitest"
+    "github.com/PeernetOfficial/core/merkle"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/google/uuid"
+)
+
+// swarmData returns random data of the count of fragments
+func swarmData(fragments int) []byte {
+    data := make([]byte, fragments*int(merkle.MinimumFragmentSize)-100)
+    rand.Read(data)
+    return data
+}
+
+// swarmDownload downloads the file from the owner and waits until the download ended. It returns the final status and the stored data.
+func swarmDownload(t *testing.T, api *webapi.WebapiInstance, file webapi.ApiFile) (info *webapi.DownloadInfo, status int, stored []byte) {
+    t.Helper()
+
+    target := filepath.Join(t.TempDir(), file.Name)
+
+    info, err := api.DownloadStart(file.Hash, file.NodeID, target)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    status = waitDownload(t, info)
+    stored, _ = os.ReadFile(target)
+
+    return info, status, stored
+}
+
+func TestDownloadSwarm(t *testing.T) {
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    data := swarmData(8)
+
+    // The same file is shared by multiple peers. Transfers are delayed so all peers get a share of the fragments.
+    var file webapi.ApiFile
+    for n := 0; n < 3; n++ {
+        peer := backend.AddPeer()
+        peer.Delay = 20 * time.Millisecond
+        shared := peer.AddFile(webapi.ApiFile{Name: "swarm.bin"}, data)
+        if n == 0 {
+            file = shared
+        }
+    }
+
+    info, status, stored := swarmDownload(t, api, file)
+    if status != webapi.DownloadFinished {
+        t.Fatalf("download ended with status %d", status)
+    }
+    if !bytes.Equal(protocol.HashData(stored), file.Hash) {
+        t.Fatal("stored data does not match the hash")
+    }
+
+    response := info.StatusResponse()
+
+    contributed := 0
+    var fragments uint64
+    for _, peer := range response.Swarm.Peers {
+        if peer.Fragments > 0 {
+            contributed++
+        }
+        fragments += peer.Fragments
+    }
+
+    if contributed < 2 {
+        t.Fatalf("fragments received from %d peers, expected multiple: %+v", contributed, response.Swarm.Peers)
+    } else if fragments != 8 {
+        t.Fatalf("%d fragments received, expected 8", fragments)
+    }
+}
+
+func TestDownloadSwarmOwnerUnreachable(t *testing.T) {
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    data := swarmData(2)
+
+    // The owner cannot be found, but another peer shares the same file.
+    owner := backend.AddPeer()
+    owner.Unreachable = true
+    file := owner.AddFile(webapi.ApiFile{Name: "swarm.bin"}, data)
+    backend.AddPeer().AddFile(webapi.ApiFile{Name: "copy.bin"}, data)
+    other := owner.AddFile(webapi.ApiFile{Name: "other.bin"}, swarmData(1))
+
+    _, status, stored := swarmDownload(t, api, file)
+    if status != webapi.DownloadFinished {
+        t.Fatalf("download ended with status %d", status)
+    }
+    if !bytes.Equal(stored, data) {
+        t.Fatal("stored data does not match")
+    }
+
+    // Without other peers sharing the file, the download is canceled.
+    if _, status, _ = swarmDownload(t, api, other); status != webapi.DownloadCanceled {
+        t.Fatalf("download ended with status %d, expected canceled", status)
+    }
+}
@@ -2,8 +2,6 @@
 File Name:  Download Transfer.go
 Copyright:  2021 Peernet Foundation s.r.o.
 Author:     Peter Kleissner
-
-Temporary download code to provide dummy results for testing. To be replaced!
 */
 
 package webapi
@@ -24,72 +22,91 @@ func (info *DownloadInfo) Start() {
         return
     }
 
-    for n := 0; n < 3 && info.Peer == nil; n++ {
-        _, info.Peer, _ = info.Backend.FindNode(info.NodeID, time.Second*5)
+    for n := 0; n < 3; n++ {
+        info.RLock()
+        owner, status := info.Peer, info.Status
+        info.RUnlock()
 
-        if info.Status == DownloadCanceled {
-            return
+        if owner != nil || status == DownloadCanceled {
+            break
         }
-    }
 
-    if info.Peer != nil {
-        info.Download()
-    } else {
-        info.Status = DownloadCanceled
-    }
-}
+        _, owner, _ = info.Backend.FindNode(info.NodeID, time.Second*5)
 
-func (info *DownloadInfo) Download() {
-    //fmt.Printf("Download start of %s\n", hex.EncodeToString(info.Hash))
-
-    // try to download the entire File
-    reader, fileSize, transferSize, err := FileStartReader(info.Peer, info.Hash, 0, 0, nil)
-    if reader != nil {
-        defer reader.Close()
+        info.Lock()
+        info.Peer = owner
+        info.Unlock()
     }
-    if err != nil {
-        info.Status = DownloadCanceled
-        return
-    } else if fileSize != transferSize {
-        info.Status = DownloadCanceled
+
+    if info.GetStatus() == DownloadCanceled {
         return
     }
 
-    info.File.Size = fileSize
-    info.Status = DownloadActive
-
-    // download in a loop
-    var fileOffset, totalRead uint64
-    dataRemaining := fileSize
-    readSize := uint64(4096)
+    // If the owner is not found, the File is downloaded from other peers sharing it. Without any, the download is canceled.
+    info.Download()
+}
 
-    for dataRemaining > 0 {
-        //fmt.Printf("data remaining:  downloaded %d from total %d   = %d %%\n", totalRead, fileSize, totalRead*100/fileSize)
-        if dataRemaining < readSize {
-            readSize = dataRemaining
+// Download downloads the File from the swarm. Pausing stops the transfer; once resumed, a new transfer is started for the remaining fragments.
+func (info *DownloadInfo) Download() {
+    for {
+        info.RLock()
+        pauseCount := info.pauseCount
+        info.RUnlock()
+
+        finished, err := info.transfer()
+        if finished {
+            info.Finish()
+            return
         }
 
-        data := make([]byte, readSize)
-        n, err := reader.Read(data)
-
-        totalRead += uint64(n)
-        dataRemaining -= uint64(n)
-        data = data[:n]
+        info.RLock()
+        paused := info.pauseCount != pauseCount
+        info.RUnlock()
+
+        if !paused { // The transfer failed or the download was canceled.
+            if err == errVerifyFailed {
+                info.Backend.LogError("Download", "download %s: no peer delivered data matching the hash\n", info.ID.String())
+                info.setStatus(DownloadVerifyFailed)
+                return
+            } else if err != nil {
+                info.Backend.LogError("Download", "download %s transfer error: %v\n", info.ID.String(), err)
+            }
+            info.setStatus(DownloadCanceled)
+            return
+        }
 
-        if err != nil {
-            info.Status = DownloadCanceled
+        if info.waitResume() != DownloadActive {
             return
         }
+    }
+}
 
-        info.storeDownloadData(data[:n], fileOffset)
+// waitResume waits while the download is paused or queued after resuming. It returns the status once the download is resumed or canceled.
+func (info *DownloadInfo) waitResume() (status int) {
+    for {
+        info.RLock()
+        status = info.Status
+        resumed := info.resumed
+        info.RUnlock()
 
-        fileOffset += uint64(n)
-    }
+        if (status != DownloadPause && status != DownloadQueued) || resumed == nil {
+            return status
+        }
 
-    //fmt.Printf("data finished:  downloaded %d from total %d   = %d %%\n", totalRead, fileSize, totalRead*100/fileSize)
+        <-resumed
+    }
+}
 
-    info.Finish()
-    info.DeleteDefer(time.Hour * 1) // cache the details for 1 hour before removing
+// stopTransfer stops the active transfer, if any, and closes the connections to all peers. The caller must hold the lock.
+func (info *DownloadInfo) stopTransfer() {
+    if info.transferStop != nil {
+        close(info.transferStop)
+        info.transferStop = nil
+    }
+    for reader := range info.transferReaders {
+        reader.Close()
+    }
+    info.transferReaders = nil
 }
 
 // Pause pauses the download. Status is DownloadResponseX.
@@ -102,11 +119,16 @@ func (info *DownloadInfo) Pause() (status int) {
     }
 
     info.Status = DownloadPause
+    info.pauseCount++
+    info.resumed = make(chan struct{})
+    info.stopTransfer()
+    info.publish()
 
     return DownloadResponseSuccess
 }
 
 // Resume resumes the download. Status is DownloadResponseX.
+// If the maximum count of active downloads is reached, the download is queued and continues once a slot is available.
 func (info *DownloadInfo) Resume() (status int) {
     info.Lock()
     defer info.Unlock()
@@ -115,7 +137,18 @@ func (info *DownloadInfo) Resume() (status int) {
         return DownloadResponseActionInvalid
     }
 
+    if info.Api != nil && !info.Api.downloadAcquire(info) {
+        info.Status = DownloadQueued
+        info.publish()
+        return DownloadResponseSuccess
+    }
+
     info.Status = DownloadActive
+    if info.resumed != nil {
+        close(info.resumed)
+        info.resumed = nil
+    }
+    info.publish()
 
     return DownloadResponseSuccess
 }
@@ -125,27 +158,35 @@ func (info *DownloadInfo) Cancel() (status int) {
     info.Lock()
     defer info.Unlock()
 
-    if info.Status >= DownloadCanceled { // The download must not be already canceled or finished.
+    if IsDownloadTerminal(info.Status) { // The download must not be already canceled or finished.
         return DownloadResponseActionInvalid
     }
 
     info.Status = DownloadCanceled
+    info.stopTransfer()
+    if info.resumed != nil {
+        close(info.resumed)
+        info.resumed = nil
+    }
     info.DiskFile.Handle.Close()
+    info.publish()
 
     return DownloadResponseSuccess
 }
 
-// Finish marks the download as finished.
+// Finish marks the download as finished. A download paused after all data was received and verified is finished as well.
 func (info *DownloadInfo) Finish() (status int) {
     info.Lock()
     defer info.Unlock()
 
-    if info.Status != DownloadActive { // The download must be active.
+    if info.Status != DownloadActive && info.Status != DownloadPause { // The download must be active.
         return DownloadResponseActionInvalid
     }
 
     info.Status = DownloadFinished
+    info.Ended = time.Now()
     info.DiskFile.Handle.Close()
+    info.publish()
 
     return DownloadResponseSuccess
 }
@@ -158,45 +199,27 @@ func (info *DownloadInfo) InitDiskFile(path string) (err error) {
     return err
 }
 
-// storeDownloadData stores downloaded data. It does not change the download Status.
-func (info *DownloadInfo) storeDownloadData(data []byte, offset uint64) (status int) {
-    info.Lock()
-    defer info.Unlock()
-
-    if info.Status != DownloadActive { // The download must be active.
-        return DownloadResponseActionInvalid
-    }
-
-    if _, err := info.DiskFile.Handle.WriteAt(data, int64(offset)); err != nil {
-        return DownloadResponseFileWrite
-    }
-
-    info.DiskFile.StoredSize += uint64(len(data))
-
-    return DownloadResponseSuccess
-}
-
+// DownloadSelf copies the File from the local warehouse. The copy is subject to the same rate limits as downloads from peers.
 func (info *DownloadInfo) DownloadSelf() {
     // Check if the File is available in the local warehouse.
-    _, fileSize, status, _ := info.Backend.UserWarehouse.FileExists(info.Hash)
+    _, fileSize, status, _ := info.Backend.UserWarehouse().FileExists(info.Hash)
     if status != warehouse.StatusOK {
-        info.Status = DownloadCanceled
+        info.setStatus(DownloadCanceled)
         return
     }
 
     info.File.Size = fileSize
-    info.Status = DownloadActive
+    info.setStatus(DownloadActive)
 
     // read the File
-    status, bytesRead, _ := info.Backend.UserWarehouse.ReadFile(info.Hash, 0, int64(info.File.Size), info.DiskFile.Handle)
+    status, bytesRead, _ := info.Backend.UserWarehouse().ReadFile(info.Hash, 0, int64(info.File.Size), info.bandwidthWriter(info.DiskFile.Handle))
 
     info.DiskFile.StoredSize = uint64(bytesRead)
 
     if status != warehouse.StatusOK {
-        info.Status = DownloadCanceled
+        info.setStatus(DownloadCanceled)
         return
     }
 
     info.Finish()
-    info.DeleteDefer(time.Hour * 1) // cache the details for 1 hour before removing}
 }
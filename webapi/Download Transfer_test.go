@@ -0,0 +1,71 @@
+/*
+File Name:  Download Transfer_test.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi_test
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/Abstraction/webapitest"
+    "github.com/PeernetOfficial/core/merkle"
+    "github.com/google/uuid"
+)
+
+func TestDownloadPauseResume(t *testing.T) {
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    // Transfers are delayed so the download can be paused in the middle.
+    peer := backend.AddPeer()
+    peer.Delay = 50 * time.Millisecond
+    data := swarmData(8)
+    file := peer.AddFile(webapi.ApiFile{Name: "pause.bin"}, data)
+
+    target := filepath.Join(t.TempDir(), file.Name)
+    info, err := api.DownloadStart(file.Hash, file.NodeID, target)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    waitProgress(t, info, merkle.MinimumFragmentSize)
+
+    if info.Pause() != webapi.DownloadResponseSuccess {
+        t.Fatal("pausing the download failed")
+    }
+    if info.Pause() != webapi.DownloadResponseActionInvalid {
+        t.Fatal("paused download paused again")
+    }
+
+    // No data is stored while paused.
+    _, paused := storedSize(info)
+    if paused >= uint64(len(data)) {
+        t.Fatal("download finished before it was paused")
+    }
+    time.Sleep(4 * peer.Delay)
+    if status, stored := storedSize(info); status != webapi.DownloadPause || stored != paused {
+        t.Fatalf("download in status %d stored %d bytes while paused, %d when paused", status, stored, paused)
+    }
+
+    if info.Resume() != webapi.DownloadResponseSuccess {
+        t.Fatal("resuming the download failed")
+    }
+    if info.Resume() != webapi.DownloadResponseActionInvalid {
+        t.Fatal("active download resumed again")
+    }
+
+    if status := waitDownload(t, info); status != webapi.DownloadFinished {
+        t.Fatalf("download ended with status %d", status)
+    }
+    if stored, err := os.ReadFile(target); err != nil || !bytes.Equal(stored, data) {
+        t.Fatalf("stored data does not match: %v", err)
+    }
+}
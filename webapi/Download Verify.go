@@ -0,0 +1,175 @@
+/*
+File Name:  Download Verify.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+
+Downloaded data is verified against the requested hash. Peers do not provide the merkle verification hashes of single fragments yet.
+Therefore only files consisting of a single fragment (where the merkle root hash equals the file hash) are verified on the fly.
+All other files are verified once all fragments are stored.
+
+If the verification fails, the peers are tried one by one: All fragments not received from the peer are downloaded again from it.
+If the verification still fails, the peer delivered corrupted data and is excluded.
+*/
+
+package webapi
+
+import (
+    "bytes"
+    "errors"
+    "io"
+
+    "github.com/PeernetOfficial/core"
+    "github.com/PeernetOfficial/core/protocol"
+    "lukechampine.com/blake3"
+)
+
+// errFragmentCorrupt is returned when a received fragment does not match its hash
+var errFragmentCorrupt = errors.New("fragment does not match the hash")
+
+// errVerifyFailed is returned when the stored data does not match the file hash and no peer is left to download it from
+var errVerifyFailed = errors.New("verification failed")
+
+// transfer downloads the remaining fragments and verifies the file. Corrupted data is downloaded again from other peers.
+// It returns true if all data is stored and verified. If the download is paused or canceled in the meantime, it returns false.
+func (info *DownloadInfo) transfer() (finished bool, err error) {
+    for {
+        finished, err = info.transferSwarm()
+        if err == errNoSources && info.exclude() { // the peer to download from is not available anymore, try the next one
+            if !info.verifyRetry() {
+                return false, errVerifyFailed
+            }
+            continue
+        } else if !finished {
+            if err != nil && info.hasExcluded() { // all remaining peers failed
+                err = errVerifyFailed
+            }
+            return false, err
+        }
+
+        if info.verify() {
+            return true, nil
+        }
+
+        // If all fragments were received from a single peer, the peer delivered corrupted data.
+        info.Lock()
+        if source, single := info.singleSource(); single {
+            info.excludeSource(source)
+        }
+        info.Unlock()
+
+        if !info.verifyRetry() {
+            return false, errVerifyFailed
+        }
+    }
+}
+
+// verify verifies the stored data against the file hash
+func (info *DownloadInfo) verify() (valid bool) {
+    info.RLock()
+    handle, fileSize := info.DiskFile.Handle, info.File.Size
+    info.RUnlock()
+
+    hasher := blake3.New(protocol.HashSize, nil)
+    if _, err := io.Copy(hasher, io.NewSectionReader(handle, 0, int64(fileSize))); err != nil {
+        return false
+    }
+
+    return bytes.Equal(hasher.Sum(nil), info.Hash)
+}
+
+// verifyRetry selects the next peer to download the file from. All fragments not received from the peer are marked as missing.
+// It returns false if no peer is left.
+func (info *DownloadInfo) verifyRetry() bool {
+    info.Lock()
+    info.trusted = ""
+    info.Unlock()
+
+    sources, _ := info.swarmSources()
+    if len(sources) == 0 {
+        return false
+    }
+
+    info.Lock()
+    defer info.Unlock()
+
+    info.trusted = string(sources[0].NodeID)
+
+    for index, stored := range info.DiskFile.Fragments {
+        if stored && info.fragmentSources[uint64(index)] != info.trusted {
+            _, length := info.fragmentRange(uint64(index))
+            info.DiskFile.Fragments[index] = false
+            info.DiskFile.StoredSize -= length
+            delete(info.fragmentSources, uint64(index))
+        }
+    }
+
+    info.publish()
+
+    return true
+}
+
+// singleSource returns the peer all stored fragments were received from. The caller must hold the lock.
+func (info *DownloadInfo) singleSource() (source string, single bool) {
+    for index, stored := range info.DiskFile.Fragments {
+        if !stored {
+            continue
+        }
+
+        fragmentSource, ok := info.fragmentSources[uint64(index)]
+        if !ok || (single && fragmentSource != source) {
+            return "", false
+        }
+        source, single = fragmentSource, true
+    }
+
+    return source, single
+}
+
+// excludeSource excludes the peer as source of the download. The caller must hold the lock.
+func (info *DownloadInfo) excludeSource(source string) {
+    if info.excluded == nil {
+        info.excluded = make(map[string]bool)
+    }
+    info.excluded[source] = true
+}
+
+// exclude excludes the peer the download is currently restricted to. It returns false if the download is not restricted.
+func (info *DownloadInfo) exclude() bool {
+    info.Lock()
+    defer info.Unlock()
+
+    if info.trusted == "" {
+        return false
+    }
+
+    info.excludeSource(info.trusted)
+    info.trusted = ""
+
+    return true
+}
+
+// hasExcluded checks if any peer was excluded for delivering corrupted data
+func (info *DownloadInfo) hasExcluded() bool {
+    info.RLock()
+    defer info.RUnlock()
+
+    return len(info.excluded) > 0
+}
+
+// isSource checks if fragments may be downloaded from the peer. The caller must hold the lock.
+func (info *DownloadInfo) isSource(peer *core.PeerInfo) bool {
+    if info.trusted != "" {
+        return info.trusted == string(peer.NodeID)
+    }
+
+    return !info.excluded[string(peer.NodeID)]
+}
+
+// fragmentHash returns the expected hash of the fragment, if known. This is only the case for files consisting of a single fragment.
+func (swarm *downloadSwarm) fragmentHash(index uint64) []byte {
+    if swarm.fragments == 1 {
+        return swarm.info.Hash
+    }
+
+    return nil
+}
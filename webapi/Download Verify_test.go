@@ -0,0 +1,67 @@
+/*
+File Name:  Download Verify_test.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi_test
+
+import (
+    "bytes"
+    "testing"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/Abstraction/webapitest"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/google/uuid"
+)
+
+// verifyPeers shares the file by peers of which the ones listed as corrupt deliver corrupted data. The file shared by the first peer is returned.
+func verifyPeers(backend *webapitest.Backend, data []byte, corrupt ...bool) (file webapi.ApiFile) {
+    for n := range corrupt {
+        peer := backend.AddPeer()
+        peer.Corrupt = corrupt[n]
+        shared := peer.AddFile(webapi.ApiFile{Name: "verify.bin"}, data)
+        if n == 0 {
+            file = shared
+        }
+    }
+
+    return file
+}
+
+func TestDownloadVerifyRecover(t *testing.T) {
+    // Single fragments are verified on the fly, multiple fragments once all are stored.
+    for _, fragments := range []int{1, 4} {
+        backend := webapitest.NewBackend()
+        api, server := webapitest.NewServer(backend, uuid.Nil)
+
+        data := swarmData(fragments)
+        file := verifyPeers(backend, data, true, false) // the owner delivers corrupted data
+
+        _, status, stored := swarmDownload(t, api, file)
+        server.Close()
+
+        if status != webapi.DownloadFinished {
+            t.Fatalf("%d fragments: download ended with status %d", fragments, status)
+        } else if !bytes.Equal(stored, data) || !bytes.Equal(protocol.HashData(stored), file.Hash) {
+            t.Fatalf("%d fragments: stored data does not match the hash", fragments)
+        }
+    }
+}
+
+func TestDownloadVerifyFailed(t *testing.T) {
+    for _, fragments := range []int{1, 4} {
+        backend := webapitest.NewBackend()
+        api, server := webapitest.NewServer(backend, uuid.Nil)
+
+        file := verifyPeers(backend, swarmData(fragments), true, true) // no peer delivers valid data
+
+        _, status, _ := swarmDownload(t, api, file)
+        server.Close()
+
+        if status != webapi.DownloadVerifyFailed {
+            t.Fatalf("%d fragments: download ended with status %d, expected %d", fragments, status, webapi.DownloadVerifyFailed)
+        }
+    }
+}
@@ -7,15 +7,20 @@ Author:     Peter Kleissner
 package webapi
 
 import (
+    "bytes"
     "encoding/hex"
+    "io"
     "math"
     "net/http"
     "os"
+    "path/filepath"
+    "sort"
     "strconv"
     "sync"
     "time"
 
     "github.com/PeernetOfficial/core"
+    "github.com/PeernetOfficial/core/blockchain"
     "github.com/google/uuid"
 )
 
@@ -29,11 +34,23 @@ type ApiResponseDownloadStatus struct {
         DownloadedSize uint64  `json:"downloadedsize"` // Count of bytes download so far.
         Percentage     float64 `json:"percentage"`     // Percentage downloaded. Rounded to 2 decimal points. Between 0.00 and 100.00.
     } `json:"progress"` // Progress of the download. Only valid for Status >= DownloadWaitSwarm.
+    Queue struct {
+        Priority int `json:"priority"` // Priority of the download. Downloads with higher priority are started first.
+        Position int `json:"position"` // Position in the queue, starting at 0. -1 if not queued.
+    } `json:"queue"` // Position in the download queue.
+    RateLimit uint64 `json:"ratelimit"` // Rate limit of the download in bytes per second. 0 means the default limit per download applies.
     Swarm struct {
-        CountPeers uint64 `json:"countpeers"` // Count of peers participating in the swarm.
+        CountPeers uint64            `json:"countpeers"` // Count of peers participating in the swarm.
+        Peers      []ApiDownloadPeer `json:"peers"`      // Peers the fragments are downloaded from, including dropped ones.
     } `json:"swarm"` // Information about the swarm. Only valid for Status >= DownloadActive.
 }
 
+// ApiResponseDownloadList contains the downloads matching the filter
+type ApiResponseDownloadList struct {
+    Total     int                         `json:"total"`     // Total count of matching downloads.
+    Downloads []ApiResponseDownloadStatus `json:"downloads"` // Downloads starting at the offset, most recently created first.
+}
+
 const (
     DownloadResponseSuccess       = 0 // Success
     DownloadResponseIDNotFound    = 1 // Error: Download ID not found.
@@ -50,13 +67,16 @@ const (
     DownloadPause        = 3 // Paused by the user.
     DownloadCanceled     = 4 // Canceled by the user before the download finished. Once canceled, a new download has to be started if the File shall be downloaded.
     DownloadFinished     = 5 // Download finished 100%.
+    DownloadVerifyFailed = 6 // The downloaded data does not match the File Hash and no Peer delivered valid data. A new download has to be started.
+    DownloadQueued       = 7 // Waiting for a slot because the maximum count of active downloads is reached.
 )
 
 /*
 apiDownloadStart starts the download of a File. The path is the full path on disk to store the File.
 The Hash parameter identifies the File to download. The node ID identifies the blockchain (i.e., the "owner" of the File).
+If the maximum count of active downloads is reached, the download is queued. Downloads with higher priority are started first.
 
-Request:    GET /download/start?path=[target path on disk]&Hash=[File Hash to download]&node=[node ID]
+Request:    GET /download/start?path=[target path on disk]&Hash=[File Hash to download]&node=[node ID]&priority=[optional priority, default 0]
 Result:     200 with JSON structure ApiResponseDownloadStatus
 */
 func (api *WebapiInstance) apiDownloadStart(w http.ResponseWriter, r *http.Request) {
@@ -76,21 +96,15 @@ func (api *WebapiInstance) apiDownloadStart(w http.ResponseWriter, r *http.Reque
         return
     }
 
-    info := &DownloadInfo{Backend: api.Backend, Api: api, ID: uuid.New(), Created: time.Now(), Hash: hash, NodeID: nodeID}
+    priority, _ := strconv.Atoi(r.Form.Get("priority"))
 
-    // create the File immediately
-    if info.InitDiskFile(filePath) != nil {
+    info, err := api.DownloadStartPriority(hash, nodeID, filePath, priority)
+    if err != nil {
         EncodeJSON(api.Backend, w, r, ApiResponseDownloadStatus{APIStatus: DownloadResponseFileInvalid})
         return
     }
 
-    // add the download to the list
-    api.DownloadAdd(info)
-
-    // start the download!
-    go info.Start()
-
-    EncodeJSON(api.Backend, w, r, ApiResponseDownloadStatus{APIStatus: DownloadResponseSuccess, ID: info.ID, DownloadStatus: DownloadWaitMetadata})
+    EncodeJSON(api.Backend, w, r, ApiResponseDownloadStatus{APIStatus: DownloadResponseSuccess, ID: info.ID, DownloadStatus: info.GetStatus()})
 }
 
 /*
@@ -113,41 +127,58 @@ func (api *WebapiInstance) apiDownloadStatus(w http.ResponseWriter, r *http.Requ
         return
     }
 
-    info.RLock()
-
-    response := ApiResponseDownloadStatus{APIStatus: DownloadResponseSuccess, ID: info.ID, DownloadStatus: info.Status}
-
-    if info.Status >= DownloadWaitSwarm {
-        response.File = info.File
-
-        response.Progress.TotalSize = info.File.Size
-        response.Progress.DownloadedSize = info.DiskFile.StoredSize
+    EncodeJSON(api.Backend, w, r, info.StatusResponse())
+}
 
-        response.Progress.Percentage = math.Round(float64(info.DiskFile.StoredSize)/float64(info.File.Size)*100*100) / 100
-    }
+/*
+apiDownloadList returns all active, queued, paused, and recently ended downloads, most recently created first.
+Ended downloads are removed from the list after 1 hour, they remain in the download history.
+The status filter can be repeated to match multiple statuses (see DownloadX).
 
-    if info.Status >= DownloadActive {
-        response.Swarm.CountPeers = info.Swarm.CountPeers
+Request:    GET /download/list?status=[status]&offset=[offset]&limit=[max records]
+Result:     200 with JSON structure ApiResponseDownloadList
+*/
+func (api *WebapiInstance) apiDownloadList(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    offset, _ := strconv.Atoi(r.Form.Get("offset"))
+    limit, err := strconv.Atoi(r.Form.Get("limit"))
+    if err != nil {
+        limit = 100
     }
 
-    info.RUnlock()
-
-    EncodeJSON(api.Backend, w, r, response)
+    EncodeJSON(api.Backend, w, r, api.DownloadList(parseStatusFilter(r), offset, limit))
 }
 
 /*
 apiDownloadAction pauses, resumes, and cancels a download. Once canceled, a new download has to be started if the File shall be downloaded.
 Only active downloads can be paused. While a download is in discovery phase (querying metadata, joining swarm), it can only be canceled.
-Action: 0 = Pause, 1 = Resume, 2 = Cancel.
+Queued downloads can be moved within the queue. Changing the priority moves a queued download to the matching position.
+The rate limit of a download applies immediately. 0 applies the default limit per download, see /bandwidth/set.
+Action: 0 = Pause, 1 = Resume, 2 = Cancel, 3 = Move to top of the queue, 4 = Move to position in the queue, 5 = Set priority, 6 = Set rate limit.
 
-Request:    GET /download/action?ID=[download ID]&action=[action]
+Request:    GET /download/action?ID=[download ID]&action=[action]&position=[position for action 4]&priority=[priority for action 5]&limit=[bytes per second for action 6]
 Result:     200 with JSON structure ApiResponseDownloadStatus (using APIStatus and DownloadStatus)
 */
 func (api *WebapiInstance) apiDownloadAction(w http.ResponseWriter, r *http.Request) {
     r.ParseForm()
     id, err := uuid.Parse(r.Form.Get("ID"))
     action, err2 := strconv.Atoi(r.Form.Get("action"))
-    if err != nil || err2 != nil || action < 0 || action > 2 {
+    if err != nil || err2 != nil || action < 0 || action > 6 {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    var value int
+    var limit uint64
+    switch action {
+    case 4:
+        value, err = strconv.Atoi(r.Form.Get("position"))
+    case 5:
+        value, err = strconv.Atoi(r.Form.Get("priority"))
+    case 6:
+        limit, err = strconv.ParseUint(r.Form.Get("limit"), 10, 64)
+    }
+    if err != nil {
         http.Error(w, "", http.StatusBadRequest)
         return
     }
@@ -169,9 +200,25 @@ func (api *WebapiInstance) apiDownloadAction(w http.ResponseWriter, r *http.Requ
 
     case 2: // Cancel
         apiStatus = info.Cancel()
+
+    case 3: // Move to top
+        apiStatus = api.DownloadMove(info, 0)
+
+    case 4: // Move to position
+        apiStatus = api.DownloadMove(info, value)
+
+    case 5: // Set priority
+        apiStatus = api.DownloadSetPriority(info, value)
+
+    case 6: // Set rate limit
+        if IsDownloadTerminal(info.GetStatus()) {
+            apiStatus = DownloadResponseActionInvalid
+        } else {
+            info.SetRateLimit(limit)
+        }
     }
 
-    EncodeJSON(api.Backend, w, r, ApiResponseDownloadStatus{APIStatus: apiStatus, ID: info.ID, DownloadStatus: info.Status})
+    EncodeJSON(api.Backend, w, r, ApiResponseDownloadStatus{APIStatus: apiStatus, ID: info.ID, DownloadStatus: info.GetStatus()})
 }
 
 // ---- download tracking ----
@@ -195,17 +242,104 @@ type DownloadInfo struct {
         Name       string   // File name
         Handle     *os.File // Target File (on disk) to store downloaded data
         StoredSize uint64   // Count of bytes downloaded and stored in the File
+
+        FragmentSize uint64 // Size of fragments the File is downloaded in
+        Fragments    []bool // Fragments received completely and stored in the File
     }
 
     Swarm struct { // Information about the swarm. Only valid for Status >= DownloadActive.
-        CountPeers uint64 // Count of peers participating in the swarm.
+        CountPeers uint64          // Count of peers participating in the swarm.
+        Peers      []*DownloadPeer // Peers the fragments are downloaded from, including dropped ones.
     }
 
     // live connections, to be changed
     Peer *core.PeerInfo
 
+    // active transfer, stopped when the download is paused or canceled
+    transferReaders map[io.ReadCloser]struct{} // Open connections to peers of the swarm.
+    transferStop    chan struct{}
+    swarm           *downloadSwarm // Swarm of the active transfer. Peers discovered in the meantime join it.
+
+    // peers sharing the file, kept for all transfers and verification retries of the download
+    sources   []*core.PeerInfo           // Known peers sharing the file, starting with the owner.
+    record    *blockchain.BlockRecordFile // File record, if found on any of the blockchains.
+    discovery chan struct{}               // Closed when the discovery of peers sharing the file finished. Nil if not started.
+
+    pauseCount      int           // Incremented each time the download is paused.
+    resumed         chan struct{} // Closed when the paused download is resumed or canceled.
+    ended           bool          // Set once the download ended. The history entry is added and the removal from the list scheduled only once.
+
+    // persistence of the download, the files are written by Unlock once the lock is released
+    journalStatus  int       // Status of the last journal entry.
+    journalUpdated time.Time // When the last journal entry was created. Zero if none yet.
+    journalDirty   bool      // The journal file needs to be written.
+    historyDirty   bool      // The history file needs to be written.
+
+    // verification of the downloaded data
+    fragmentSources map[uint64]string // Node ID of the peer each fragment was received from. Not known for fragments restored from the journal.
+    excluded        map[string]bool   // Node IDs of peers that delivered corrupted data. They are not used as source anymore.
+    trusted         string            // If set, fragments are only downloaded from this peer. Used to find a peer delivering valid data.
+
+    // download queue, protected by the queue mutex of the API
+    priority int  // Priority of the download. Downloads with higher priority are started first.
+    slot     bool // Whether the download holds one of the slots for active downloads.
+
+    // bandwidth limit of the download
+    rateLimit     uint64       // Rate limit in bytes per second. 0 applies the default limit per download. Accessed atomically.
+    bandwidth     *tokenBucket // Token bucket shared by all transfers of the download.
+    bandwidthOnce sync.Once
+
     Api     *WebapiInstance
-    Backend *core.Backend
+    Backend Backend
+
+    // subscribers receiving events about the download
+    subscribers      []chan DownloadEvent
+    subscribersMutex sync.Mutex
+}
+
+// DownloadEvent informs subscribers about status changes and progress of a download.
+type DownloadEvent struct {
+    ID             uuid.UUID // Download ID
+    Status         int       // Status of the download. See DownloadX.
+    TotalSize      uint64    // Total size in bytes. Only valid for Status >= DownloadWaitSwarm.
+    DownloadedSize uint64    // Count of bytes downloaded and stored so far.
+    CountPeers     uint64    // Count of peers participating in the swarm.
+}
+
+// downloadEventBuffer is the count of events buffered per subscriber. If a subscriber does not read fast enough, progress events are dropped.
+const downloadEventBuffer = 16
+
+// DownloadStart creates the target file and starts the download in the background. The node ID identifies the owner of the file.
+// If the maximum count of active downloads is reached, the download is queued.
+func (api *WebapiInstance) DownloadStart(hash, nodeID []byte, filePath string) (info *DownloadInfo, err error) {
+    return api.DownloadStartPriority(hash, nodeID, filePath, 0)
+}
+
+// DownloadStartPriority is the same as DownloadStart but with a priority. Queued downloads with higher priority are started first.
+func (api *WebapiInstance) DownloadStartPriority(hash, nodeID []byte, filePath string, priority int) (info *DownloadInfo, err error) {
+    info = &DownloadInfo{Backend: api.Backend, Api: api, ID: uuid.New(), Created: time.Now(), Hash: hash, NodeID: nodeID, priority: priority}
+
+    // create the File immediately
+    if err = info.InitDiskFile(filePath); err != nil {
+        return nil, err
+    }
+
+    // add the download to the list
+    api.DownloadAdd(info)
+
+    info.Lock()
+    defer info.Unlock()
+
+    // start the download if a slot is available
+    if api.downloadAcquire(info) {
+        go info.Start()
+    } else {
+        info.Status = DownloadQueued
+    }
+
+    info.journalUpdate()
+
+    return info, nil
 }
 
 func (api *WebapiInstance) DownloadAdd(info *DownloadInfo) {
@@ -227,6 +361,234 @@ func (api *WebapiInstance) DownloadLookup(id uuid.UUID) (info *DownloadInfo) {
     return info
 }
 
+// downloadFind returns the download of the file into the target file that has not ended yet, for example one restored from the journal. Nil if none.
+func (api *WebapiInstance) downloadFind(hash []byte, filePath string) (info *DownloadInfo) {
+    if path, err := filepath.Abs(filePath); err == nil {
+        filePath = path
+    }
+
+    api.downloadsMutex.RLock()
+    defer api.downloadsMutex.RUnlock()
+
+    for _, download := range api.downloads {
+        download.RLock()
+        path, err := filepath.Abs(download.DiskFile.Name)
+        if err != nil {
+            path = download.DiskFile.Name
+        }
+        match := bytes.Equal(download.Hash, hash) && path == filePath && !IsDownloadTerminal(download.Status)
+        download.RUnlock()
+
+        if match {
+            return download
+        }
+    }
+
+    return nil
+}
+
+// DownloadList returns the status of all downloads matching the status filter, most recently created first.
+// Ended downloads are included until they are removed from the list, see DownloadHistory for older ones.
+// If statuses is empty, all downloads match. Limit 0 returns all downloads starting at the offset.
+func (api *WebapiInstance) DownloadList(statuses []int, offset, limit int) (result ApiResponseDownloadList) {
+    api.downloadsMutex.RLock()
+    downloads := make([]*DownloadInfo, 0, len(api.downloads))
+    for _, info := range api.downloads {
+        downloads = append(downloads, info)
+    }
+    api.downloadsMutex.RUnlock()
+
+    sort.Slice(downloads, func(i, j int) bool {
+        if !downloads[i].Created.Equal(downloads[j].Created) {
+            return downloads[i].Created.After(downloads[j].Created)
+        }
+        return bytes.Compare(downloads[i].ID[:], downloads[j].ID[:]) < 0
+    })
+
+    result.Downloads = []ApiResponseDownloadStatus{}
+
+    for _, info := range downloads {
+        if len(statuses) > 0 && !containsInt(statuses, info.GetStatus()) {
+            continue
+        }
+
+        if result.Total >= offset && (limit <= 0 || len(result.Downloads) < limit) {
+            result.Downloads = append(result.Downloads, info.StatusResponse())
+        }
+        result.Total++
+    }
+
+    return result
+}
+
+// IsDownloadTerminal returns true if the download is finished, canceled, or failed verification. The status will not change anymore.
+func IsDownloadTerminal(status int) bool {
+    return status == DownloadCanceled || status == DownloadFinished || status == DownloadVerifyFailed
+}
+
+// Subscribe returns a channel that receives events about status changes and progress of the download.
+// The current state is sent immediately. The channel is closed after the final event once the download is finished or canceled.
+// Progress events may be dropped if the subscriber does not read fast enough, the final event is always delivered.
+// Unsubscribe must be called if the subscriber stops reading before the channel is closed.
+func (info *DownloadInfo) Subscribe() (events <-chan DownloadEvent, unsubscribe func()) {
+    info.RLock()
+    defer info.RUnlock()
+
+    info.subscribersMutex.Lock()
+    defer info.subscribersMutex.Unlock()
+
+    channel := make(chan DownloadEvent, downloadEventBuffer)
+    channel <- info.event()
+
+    if IsDownloadTerminal(info.Status) {
+        close(channel)
+        return channel, func() {}
+    }
+
+    info.subscribers = append(info.subscribers, channel)
+
+    return channel, func() {
+        info.subscribersMutex.Lock()
+        defer info.subscribersMutex.Unlock()
+
+        for n := range info.subscribers {
+            if info.subscribers[n] == channel {
+                info.subscribers = append(info.subscribers[:n], info.subscribers[n+1:]...)
+                close(channel)
+                break
+            }
+        }
+    }
+}
+
+// StatusResponse returns the current status of the download
+func (info *DownloadInfo) StatusResponse() (response ApiResponseDownloadStatus) {
+    info.RLock()
+    defer info.RUnlock()
+
+    response = ApiResponseDownloadStatus{APIStatus: DownloadResponseSuccess, ID: info.ID, DownloadStatus: info.Status}
+    response.Queue.Position = -1
+    response.RateLimit = info.RateLimit()
+
+    if info.Api != nil {
+        response.Queue.Priority, response.Queue.Position = info.Api.downloadQueueStatus(info)
+    }
+
+    // A queued download only has metadata if it was paused before.
+    if info.Status >= DownloadWaitSwarm && (info.Status != DownloadQueued || info.File.Size > 0) {
+        response.File = info.File
+
+        response.Progress.TotalSize = info.File.Size
+        response.Progress.DownloadedSize = info.DiskFile.StoredSize
+
+        response.Progress.Percentage = math.Round(float64(info.DiskFile.StoredSize)/float64(info.File.Size)*100*100) / 100
+    }
+
+    if info.Status >= DownloadActive && info.Status != DownloadQueued {
+        response.Swarm.CountPeers = info.Swarm.CountPeers
+        response.Swarm.Peers = info.swarmStatus()
+    }
+
+    return response
+}
+
+// event returns the current state as event. The caller must hold the lock.
+func (info *DownloadInfo) event() (event DownloadEvent) {
+    event = DownloadEvent{ID: info.ID, Status: info.Status, DownloadedSize: info.DiskFile.StoredSize, CountPeers: info.Swarm.CountPeers}
+    if info.Status >= DownloadWaitSwarm {
+        event.TotalSize = info.File.Size
+    }
+
+    return event
+}
+
+// publish sends the current state to all subscribers. The caller must hold the lock.
+// If the download is finished or canceled, the subscriber channels are closed and the download is removed from the list after 1 hour.
+func (info *DownloadInfo) publish() {
+    info.subscribersMutex.Lock()
+    defer info.subscribersMutex.Unlock()
+
+    event := info.event()
+    terminal := IsDownloadTerminal(info.Status)
+
+    for _, channel := range info.subscribers {
+        select {
+        case channel <- event:
+        default:
+            if terminal {
+                // Make room for the final event by dropping the oldest one.
+                select {
+                case <-channel:
+                default:
+                }
+                channel <- event
+            }
+        }
+
+        if terminal {
+            close(channel)
+        }
+    }
+
+    if terminal {
+        info.subscribers = nil
+    }
+
+    if info.Api != nil {
+        if terminal || info.Status == DownloadPause {
+            info.Api.downloadRelease(info)
+        }
+        if terminal && !info.ended {
+            info.ended = true
+            info.Api.historyAdd(info.historyEntry())
+            info.historyDirty = true
+            info.DeleteDefer(time.Hour * 1) // cache the details for 1 hour before removing
+        }
+
+        // Progress is only recorded in the journal in the interval, status changes immediately.
+        if info.journalUpdated.IsZero() || info.Status != info.journalStatus || time.Since(info.journalUpdated) >= DownloadJournalInterval {
+            info.journalUpdate()
+        }
+    }
+}
+
+// Unlock releases the lock. The journal and history files changed in the meantime are written afterwards, so the disk I/O does not block the download.
+func (info *DownloadInfo) Unlock() {
+    journalDirty, historyDirty := info.journalDirty, info.historyDirty
+    info.journalDirty, info.historyDirty = false, false
+    info.RWMutex.Unlock()
+
+    if historyDirty {
+        info.Api.historyMutex.Lock()
+        info.Api.historySave()
+        info.Api.historyMutex.Unlock()
+    }
+    if journalDirty {
+        info.Api.downloadJournalSave()
+    }
+}
+
+// GetStatus returns the current status of the download. See DownloadX.
+func (info *DownloadInfo) GetStatus() (status int) {
+    info.RLock()
+    defer info.RUnlock()
+
+    return info.Status
+}
+
+// setStatus changes the status and informs the subscribers. A finished or canceled download is not changed anymore.
+func (info *DownloadInfo) setStatus(status int) {
+    info.Lock()
+    defer info.Unlock()
+
+    if IsDownloadTerminal(info.Status) {
+        return
+    }
+
+    info.Status = status
+    info.publish()
+}
+
 // DeleteDefer deletes the download from the downloads list after the given duration.
 // It does not wait for the download to be finished.
 func (info *DownloadInfo) DeleteDefer(Duration time.Duration) {
@@ -7,6 +7,7 @@ Author:     Peter Kleissner
 package webapi
 
 import (
+    "bytes"
     "errors"
     "io"
     "net/http"
@@ -69,7 +70,7 @@ func (api *WebapiInstance) apiFileRead(w http.ResponseWriter, r *http.Request) {
     }
 
     // Is the File available in the local warehouse? In that case requesting it from the remote is unnecessary.
-    if serveFileFromWarehouse(api.Backend, w, fileHash, uint64(offset), uint64(limit), ranges) {
+    if serveFileFromWarehouse(api.Backend, api.streamWriter(w, r), fileHash, uint64(offset), uint64(limit), ranges) {
         return
     }
 
@@ -87,7 +88,7 @@ func (api *WebapiInstance) apiFileRead(w http.ResponseWriter, r *http.Request) {
     }
 
     // Start the reader. If this HTTP request is canceled, r.Context().Done() acts as cancellation signal to the underlying UDT connection.
-    reader, fileSize, transferSize, err := FileStartReader(peer, fileHash, uint64(offset), uint64(limit), r.Context().Done())
+    reader, fileSize, transferSize, err := api.Backend.FileTransfer(peer, fileHash, uint64(offset), uint64(limit), r.Context().Done())
     if reader != nil {
         defer reader.Close()
     }
@@ -100,14 +101,14 @@ func (api *WebapiInstance) apiFileRead(w http.ResponseWriter, r *http.Request) {
     setContentLengthRangeHeader(w, uint64(offset), transferSize, fileSize, ranges)
 
     // Start sending the data!
-    io.Copy(w, io.LimitReader(reader, int64(transferSize)))
+    io.Copy(w, io.LimitReader(api.streamReader(reader, r.Context().Done()), int64(transferSize)))
 }
 
 // serveFileFromWarehouse serves the File from the warehouse. If it is not available, it returns false and does not use the writer.
 // Limit is optional, 0 means the entire File.
-func serveFileFromWarehouse(backend *core.Backend, w http.ResponseWriter, fileHash []byte, offset, limit uint64, ranges []HTTPRange) (valid bool) {
+func serveFileFromWarehouse(backend Backend, w http.ResponseWriter, fileHash []byte, offset, limit uint64, ranges []HTTPRange) (valid bool) {
     // Check if the File is available in the local warehouse.
-    _, fileSize, status, _ := backend.UserWarehouse.FileExists(fileHash)
+    _, fileSize, status, _ := backend.UserWarehouse().FileExists(fileHash)
     if status != warehouse.StatusOK {
         return false
     }
@@ -125,7 +126,7 @@ func serveFileFromWarehouse(backend *core.Backend, w http.ResponseWriter, fileHa
 
     setContentLengthRangeHeader(w, offset, limit, fileSize, ranges)
 
-    status, _, _ = backend.UserWarehouse.ReadFile(fileHash, int64(offset), int64(limit), w)
+    status, _, _ = backend.UserWarehouse().ReadFile(fileHash, int64(offset), int64(limit), w)
 
     // StatusErrorReadFile must be considered success, since parts of the File may have been transferred already and recovery is not possible.
     return status == warehouse.StatusErrorReadFile || status == warehouse.StatusOK
@@ -193,7 +194,7 @@ func (api *WebapiInstance) apiFileView(w http.ResponseWriter, r *http.Request) {
 
     // Is the File available in the local warehouse? In that case requesting it from the remote is unnecessary.
     if !localCacheDisable {
-        if serveFileFromWarehouse(api.Backend, w, fileHash, uint64(offset), uint64(limit), ranges) {
+        if serveFileFromWarehouse(api.Backend, api.streamWriter(w, r), fileHash, uint64(offset), uint64(limit), ranges) {
             return
         }
     }
@@ -212,7 +213,7 @@ func (api *WebapiInstance) apiFileView(w http.ResponseWriter, r *http.Request) {
     }
 
     // start the reader
-    reader, fileSize, transferSize, err := FileStartReader(peer, fileHash, uint64(offset), uint64(limit), r.Context().Done())
+    reader, fileSize, transferSize, err := api.Backend.FileTransfer(peer, fileHash, uint64(offset), uint64(limit), r.Context().Done())
     if reader != nil {
         defer reader.Close()
     }
@@ -225,11 +226,11 @@ func (api *WebapiInstance) apiFileView(w http.ResponseWriter, r *http.Request) {
     setContentLengthRangeHeader(w, uint64(offset), transferSize, fileSize, ranges)
 
     // Start sending the data!
-    io.Copy(w, io.LimitReader(reader, int64(transferSize)))
+    io.Copy(w, io.LimitReader(api.streamReader(reader, r.Context().Done()), int64(transferSize)))
 }
 
 // PeerConnectPublicKey attempts to connect to the Peer specified by its public key (= Peer ID).
-func PeerConnectPublicKey(backend *core.Backend, publicKey *btcec.PublicKey, timeout time.Duration) (peer *core.PeerInfo, err error) {
+func PeerConnectPublicKey(backend Backend, publicKey *btcec.PublicKey, timeout time.Duration) (peer *core.PeerInfo, err error) {
     if publicKey == nil {
         return nil, errors.New("invalid public key")
     }
@@ -250,7 +251,7 @@ func PeerConnectPublicKey(backend *core.Backend, publicKey *btcec.PublicKey, tim
 }
 
 // PeerConnectNode tries to connect via the node ID
-func PeerConnectNode(backend *core.Backend, nodeID []byte, timeout time.Duration) (peer *core.PeerInfo, err error) {
+func PeerConnectNode(backend Backend, nodeID []byte, timeout time.Duration) (peer *core.PeerInfo, err error) {
     if len(nodeID) != 256/8 {
         return nil, errors.New("invalid node ID")
     }
@@ -298,22 +299,34 @@ func FileStartReader(peer *core.PeerInfo, hash []byte, offset, limit uint64, can
     return udtConn, fileSize, transferSize, nil
 }
 
+// ErrHashMismatch is returned when the data received from a Peer does not match the requested Hash
+var ErrHashMismatch = errors.New("data does not match the hash")
+
 // FileReadAll downloads the File from the Peer.
 // This function should only be used for testing or as a basis to fork. The caller should develop a custom download function that handles timeouts and excessive File sizes.
 // It allocates whatever size is reported by the remote Peer. This could lead to an out of memory crash.
 // This function is blocking and may take a long time depending on the remote Peer and the network connection.
+// If the received data does not match the Hash, ErrHashMismatch is returned.
 func FileReadAll(peer *core.PeerInfo, hash []byte) (data []byte, err error) {
-    reader, _, transferSize, err := FileStartReader(peer, hash, 0, 0, nil)
+    reader, fileSize, transferSize, err := FileStartReader(peer, hash, 0, 0, nil)
     if err != nil {
         return nil, err
     }
     defer reader.Close()
 
+    if transferSize != fileSize {
+        return nil, errors.New("file size mismatch")
+    }
+
     // read all data
     data = make([]byte, transferSize) // Warning: This could lead to an out of memory crash.
-    _, err = reader.Read(data)
+    if _, err = io.ReadFull(reader, data); err != nil {
+        return nil, err
+    }
 
-    // Note: This function does not verify if the returned data matches the Hash and expected size.
+    if !bytes.Equal(protocol.HashData(data), hash) {
+        return nil, ErrHashMismatch
+    }
 
-    return data, err
+    return data, nil
 }
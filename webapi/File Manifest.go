@@ -0,0 +1,358 @@
+/*
+File Name:  File Manifest.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/csv"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "io"
+    "net/http"
+    "os"
+    "path"
+    "path/filepath"
+    "strconv"
+    "time"
+
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/PeernetOfficial/core/warehouse"
+    "github.com/google/uuid"
+)
+
+// Formats of a manifest listing the files of the blockchain
+const (
+    ManifestJSONLines = "jsonl" // JSON Lines, one ApiFile per line.
+    ManifestCSV       = "csv"   // CSV with a header row. See manifestColumns.
+)
+
+// manifestColumns are the columns of a CSV manifest. The tags column contains the metadata as JSON array of ApiFileMetadata.
+var manifestColumns = []string{"id", "hash", "size", "type", "format", "folder", "name", "description", "date", "tags"}
+
+// ErrManifestFormat is returned for an unknown manifest format
+var ErrManifestFormat = errors.New("unknown manifest format")
+
+// ExportFiles writes all files of the user's blockchain as manifest in the given format. See ManifestX.
+func (api *WebapiInstance) ExportFiles(writer io.Writer, format string) (err error) {
+    files, status := api.Backend.UserBlockchain().ListFiles()
+    if status != blockchain.StatusOK {
+        return errors.New("error listing files, blockchain status " + strconv.Itoa(status))
+    }
+
+    switch format {
+    case ManifestJSONLines, "":
+        encoder := json.NewEncoder(writer)
+        for n := range files {
+            if err = encoder.Encode(BlockRecordFileToAPI(files[n])); err != nil {
+                return err
+            }
+        }
+
+    case ManifestCSV:
+        csvWriter := csv.NewWriter(writer)
+        csvWriter.Write(manifestColumns)
+
+        for n := range files {
+            file := BlockRecordFileToAPI(files[n])
+            tags, _ := json.Marshal(file.Metadata)
+
+            csvWriter.Write([]string{file.ID.String(), hex.EncodeToString(file.Hash), strconv.FormatUint(file.Size, 10), strconv.Itoa(int(file.Type)), strconv.Itoa(int(file.Format)),
+                file.Folder, file.Name, file.Description, file.Date.Format(time.RFC3339), string(tags)})
+        }
+
+        csvWriter.Flush()
+        return csvWriter.Error()
+
+    default:
+        return ErrManifestFormat
+    }
+
+    return nil
+}
+
+// ImportFiles reads a manifest in the given format and republishes the listed files with their original IDs.
+// The data of each file is read from the root directory using the virtual folder and name, and must match the hash in the manifest.
+// Files that cannot be imported are reported and skipped. Files whose ID is already on the blockchain are replaced.
+// If the blockchain cannot be updated, the affected files are reported as failed and their imported data is deleted from the warehouse again.
+// An error is only returned if the manifest cannot be read.
+func (api *WebapiInstance) ImportFiles(reader io.Reader, format, root string) (result ShareDirectoryResult, err error) {
+    files, err := manifestRead(reader, format)
+    if err != nil {
+        return result, err
+    }
+
+    existing := make(map[uuid.UUID]struct{})
+    if list, status := api.Backend.UserBlockchain().ListFiles(); status == blockchain.StatusOK {
+        for n := range list {
+            existing[list[n].ID] = struct{}{}
+        }
+    }
+
+    var filesAdd, filesReplace []blockchain.BlockRecordFile
+    var indexAdd, indexReplace []int // index of the files in the result
+
+    for _, file := range files {
+        imported := ShareDirectoryFile{File: file, Status: warehouse.StatusOK}
+        imported.File.NodeID = api.Backend.SelfNodeID()
+        if imported.File.ID == uuid.Nil {
+            imported.File.ID = uuid.New()
+        }
+        if imported.File.Date.IsZero() {
+            imported.File.Date = time.Now()
+        }
+
+        if imported.File.IsVirtualFolder() {
+            imported.File.Hash = protocol.HashData(nil)
+            imported.File.Size = 0
+        } else {
+            imported.Path = filepath.Join(root, filepath.FromSlash(CleanFolder(path.Join(file.Folder, file.Name))))
+            imported.Status, err = api.manifestImportFile(imported.Path, &imported.File)
+            if err != nil {
+                imported.Error = err.Error()
+                result.Files = append(result.Files, imported)
+                continue
+            }
+        }
+
+        blockRecord := BlockRecordFileFromAPI(imported.File)
+
+        if !SetFileMerkleInfo(api.Backend, &blockRecord) {
+            imported.Status = warehouse.StatusFileNotFound
+            imported.Error = "merkle information not available"
+        } else if _, ok := existing[blockRecord.ID]; ok {
+            filesReplace = append(filesReplace, blockRecord)
+            indexReplace = append(indexReplace, len(result.Files))
+        } else {
+            filesAdd = append(filesAdd, blockRecord)
+            indexAdd = append(indexAdd, len(result.Files))
+        }
+
+        result.Files = append(result.Files, imported)
+    }
+
+    result.Status = blockchain.StatusOK
+    _, result.Height, result.Version = api.Backend.UserBlockchain().Header()
+
+    // If a blockchain operation fails, the files are reported as failed. If the add fails after the replace, the replaced files remain published.
+    var collect [][]byte
+    rollback := func(indexes []int) {
+        for _, n := range indexes {
+            result.Files[n].Status = warehouse.StatusFileNotFound
+            result.Files[n].Error = "blockchain error status " + strconv.Itoa(result.Status)
+            if !result.Files[n].File.IsVirtualFolder() {
+                collect = append(collect, result.Files[n].File.Hash)
+            }
+        }
+    }
+
+    if len(filesReplace) > 0 {
+        if result.Height, result.Version, result.Status = api.Backend.UserBlockchain().ReplaceFiles(filesReplace); result.Status != blockchain.StatusOK {
+            rollback(indexReplace)
+        }
+    }
+    if result.Status != blockchain.StatusOK {
+        rollback(indexAdd)
+    } else if len(filesAdd) > 0 {
+        if result.Height, result.Version, result.Status = api.Backend.UserBlockchain().AddFiles(filesAdd); result.Status != blockchain.StatusOK {
+            rollback(indexAdd)
+        }
+    }
+    if result.Status != blockchain.StatusOK {
+        _, result.Height, result.Version = api.Backend.UserBlockchain().Header()
+    }
+
+    // Delete the imported data of failed files from the warehouse in case there are no other references.
+    for n, hash := range collect {
+        if ContainsHash(collect[:n], hash) {
+            continue
+        }
+        if files, status := api.Backend.UserBlockchain().FileExists(hash); status == blockchain.StatusOK && len(files) == 0 {
+            api.Backend.UserWarehouse().DeleteFile(hash)
+        }
+    }
+
+    return result, nil
+}
+
+// manifestImportFile verifies that the local file matches the hash and imports it into the warehouse. The size of the file record is updated.
+func (api *WebapiInstance) manifestImportFile(filename string, file *ApiFile) (status int, err error) {
+    hash, err := syncHashFile(filename)
+    if err != nil {
+        return warehouse.StatusErrorOpenFile, err
+    } else if !bytes.Equal(hash, file.Hash) {
+        return warehouse.StatusInvalidHash, errors.New("hash mismatch")
+    }
+
+    if hash, status, err = api.Backend.UserWarehouse().CreateFileFromPath(filename); err != nil || status != warehouse.StatusOK {
+        return status, err
+    } else if !bytes.Equal(hash, file.Hash) { // the file was changed in the meantime
+        return warehouse.StatusInvalidHash, errors.New("hash mismatch")
+    }
+
+    _, file.Size, status, err = api.Backend.UserWarehouse().FileExists(hash)
+
+    return status, err
+}
+
+// manifestRead reads all files from the manifest
+func manifestRead(reader io.Reader, format string) (files []ApiFile, err error) {
+    switch format {
+    case ManifestJSONLines, "":
+        scanner := bufio.NewScanner(reader)
+        scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+        for scanner.Scan() {
+            if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+                continue
+            }
+
+            var file ApiFile
+            if err = json.Unmarshal(scanner.Bytes(), &file); err != nil {
+                return nil, err
+            }
+            files = append(files, file)
+        }
+
+        return files, scanner.Err()
+
+    case ManifestCSV:
+        records, err := csv.NewReader(reader).ReadAll()
+        if err != nil {
+            return nil, err
+        } else if len(records) == 0 {
+            return nil, nil
+        }
+
+        // map the columns by the header row
+        columns := make(map[string]int)
+        for n, name := range records[0] {
+            columns[name] = n
+        }
+        column := func(record []string, name string) string {
+            if n, ok := columns[name]; ok && n < len(record) {
+                return record[n]
+            }
+            return ""
+        }
+
+        // Empty values are allowed and use the defaults. Invalid ones fail the row.
+        for row, record := range records[1:] {
+            invalid := func(name string) error {
+                return errors.New("manifest row " + strconv.Itoa(row+2) + ": invalid " + name)
+            }
+            number := func(name string, bitSize int) (value uint64, err error) {
+                if text := column(record, name); text != "" {
+                    if value, err = strconv.ParseUint(text, 10, bitSize); err != nil {
+                        return 0, invalid(name)
+                    }
+                }
+                return value, nil
+            }
+
+            var file ApiFile
+            if id := column(record, "id"); id != "" {
+                if file.ID, err = uuid.Parse(id); err != nil {
+                    return nil, invalid("id")
+                }
+            }
+            if file.Hash, err = hex.DecodeString(column(record, "hash")); err != nil {
+                return nil, invalid("hash")
+            }
+            if file.Size, err = number("size", 64); err != nil {
+                return nil, err
+            }
+            fileType, err := number("type", 8)
+            if err != nil {
+                return nil, err
+            }
+            fileFormat, err := number("format", 16)
+            if err != nil {
+                return nil, err
+            }
+            file.Type, file.Format = uint8(fileType), uint16(fileFormat)
+            file.Folder = column(record, "folder")
+            file.Name = column(record, "name")
+            file.Description = column(record, "description")
+            if date := column(record, "date"); date != "" {
+                if file.Date, err = time.Parse(time.RFC3339, date); err != nil {
+                    return nil, invalid("date")
+                }
+            }
+
+            if tags := column(record, "tags"); tags != "" {
+                if err = json.Unmarshal([]byte(tags), &file.Metadata); err != nil {
+                    return nil, invalid("tags")
+                }
+            }
+
+            files = append(files, file)
+        }
+
+        return files, nil
+
+    default:
+        return nil, ErrManifestFormat
+    }
+}
+
+/*
+apiBlockchainFileExport exports all files of the user's blockchain as manifest.
+
+Request:    GET /blockchain/File/export?format=[jsonl|csv]
+Response:   200 with JSON Lines (one ApiFile per line) or CSV
+            400 if invalid format
+*/
+func (api *WebapiInstance) apiBlockchainFileExport(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    format := r.Form.Get("format")
+
+    switch format {
+    case ManifestJSONLines, "":
+        w.Header().Set("Content-Type", "application/x-ndjson")
+    case ManifestCSV:
+        w.Header().Set("Content-Type", "text/csv")
+    default:
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    if err := api.ExportFiles(w, format); err != nil {
+        api.Backend.LogError("apiBlockchainFileExport", "error: %v\n", err)
+    }
+}
+
+/*
+apiBlockchainFileImport imports a manifest created by /blockchain/File/export. The files are read from the local root directory
+(using the virtual folder and name), imported into the warehouse and republished with their original IDs. The hashes must match.
+Warning: Same as /warehouse/create/path, any local directory can be supplied. No input path verification or limitation is done.
+
+Request:    POST /blockchain/File/import?path=[root directory]&format=[jsonl|csv] with the manifest as body
+Response:   200 with JSON structure ShareDirectoryResult
+            400 if invalid format or manifest
+*/
+func (api *WebapiInstance) apiBlockchainFileImport(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    root := r.Form.Get("path")
+    if root == "" {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    } else if _, err := os.Stat(root); err != nil {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    result, err := api.ImportFiles(r.Body, r.Form.Get("format"), root)
+    if err != nil {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    EncodeJSON(api.Backend, w, r, result)
+}
@@ -0,0 +1,215 @@
+/*
+File Name:  File Manifest_test.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi_test
+
+import (
+    "bytes"
+    "encoding/hex"
+    "encoding/json"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/Abstraction/webapitest"
+    "github.com/PeernetOfficial/core"
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/PeernetOfficial/core/warehouse"
+    "github.com/google/uuid"
+)
+
+// manifestRoot creates the files in a new root directory. The key is the virtual path.
+func manifestRoot(t *testing.T, files map[string]string) (root string) {
+    t.Helper()
+
+    root = t.TempDir()
+    for name, data := range files {
+        filename := filepath.Join(root, filepath.FromSlash(name))
+        os.MkdirAll(filepath.Dir(filename), os.ModePerm)
+        if err := os.WriteFile(filename, []byte(data), 0666); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    return root
+}
+
+// manifestJSON returns the files as JSON Lines manifest
+func manifestJSON(files ...webapi.ApiFile) []byte {
+    var manifest bytes.Buffer
+    for _, file := range files {
+        json.NewEncoder(&manifest).Encode(file)
+    }
+
+    return manifest.Bytes()
+}
+
+// manifestJSONBody returns the files as JSON structure ApiBlockAddFiles
+func manifestJSONBody(files []webapi.ApiFile) []byte {
+    body, _ := json.Marshal(webapi.ApiBlockAddFiles{Files: files})
+    return body
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+    key := uuid.New()
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, key)
+    defer server.Close()
+
+    root := manifestRoot(t, map[string]string{"docs/a.txt": "alpha", "b.txt": "beta, with \"quotes\"\nand lines"})
+
+    files := []webapi.ApiFile{
+        {Hash: backend.Warehouse.Add([]byte("alpha")), Folder: "docs", Name: "a.txt", Description: "first, file", Type: core.TypeText, Format: core.FormatText},
+        {Hash: backend.Warehouse.Add([]byte("beta, with \"quotes\"\nand lines")), Name: "b.txt", Type: core.TypeText, Format: core.FormatText},
+        {Hash: protocol.HashData(nil), Name: "docs", Type: core.TypeFolder, Format: core.FormatFolder},
+    }
+    var added webapi.ApiBlockchainBlockStatus
+    if code := request(t, server, key, "POST", "/blockchain/File/add", manifestJSONBody(files), &added); code != http.StatusOK || added.Status != blockchain.StatusOK {
+        t.Fatalf("adding files: status code %d, status %d", code, added.Status)
+    }
+    exported := syncRecords(t, backend)
+
+    for _, format := range []string{webapi.ManifestJSONLines, webapi.ManifestCSV} {
+        var manifest bytes.Buffer
+        if err := api.ExportFiles(&manifest, format); err != nil {
+            t.Fatalf("format %s: %v", format, err)
+        }
+
+        target := webapitest.NewBackend()
+        targetAPI, targetServer := webapitest.NewServer(target, uuid.Nil)
+
+        result, err := targetAPI.ImportFiles(&manifest, format, root)
+        targetServer.Close()
+        if err != nil {
+            t.Fatalf("format %s: %v", format, err)
+        } else if result.Status != blockchain.StatusOK || len(result.Files) != len(files) {
+            t.Fatalf("format %s: status %d, %d files", format, result.Status, len(result.Files))
+        }
+        for _, file := range result.Files {
+            if file.Status != warehouse.StatusOK {
+                t.Fatalf("format %s: file '%s' status %d error '%s'", format, file.File.Name, file.Status, file.Error)
+            }
+        }
+
+        imported := syncRecords(t, target)
+        for path, file := range exported {
+            record, ok := imported[path]
+            if !ok {
+                t.Fatalf("format %s: file '%s' not imported", format, path)
+            }
+            if record.ID != file.ID || !bytes.Equal(record.Hash, file.Hash) || record.Size != file.Size || record.Type != file.Type || record.Format != file.Format || record.Description != file.Description {
+                t.Errorf("format %s: file '%s' imported as %+v, expected %+v", format, path, record, file)
+            }
+            if !file.IsVirtualFolder() {
+                if _, _, status, _ := target.Warehouse.FileExists(file.Hash); status != warehouse.StatusOK {
+                    t.Errorf("format %s: data of '%s' not in the warehouse", format, path)
+                }
+            }
+        }
+    }
+}
+
+func TestManifestImportInvalid(t *testing.T) {
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    root := manifestRoot(t, map[string]string{"a.txt": "alpha"})
+
+    // The local file does not match the hash.
+    result, err := api.ImportFiles(bytes.NewReader(manifestJSON(webapi.ApiFile{Hash: protocol.HashData([]byte("other")), Name: "a.txt"})), webapi.ManifestJSONLines, root)
+    if err != nil {
+        t.Fatal(err)
+    } else if len(result.Files) != 1 || result.Files[0].Status != warehouse.StatusInvalidHash {
+        t.Fatalf("hash mismatch imported as %+v", result.Files)
+    }
+    if files, _ := backend.Blockchain.ListFiles(); len(files) != 0 {
+        t.Fatalf("%d files published", len(files))
+    }
+    if _, _, status, _ := backend.Warehouse.FileExists(protocol.HashData([]byte("alpha"))); status == warehouse.StatusOK {
+        t.Fatal("data of mismatching file imported into the warehouse")
+    }
+
+    // Any invalid value in a CSV row rejects the manifest. Empty values are allowed.
+    header := "id,hash,size,type,format,folder,name,description,date,tags\n"
+    hash := hex.EncodeToString(protocol.HashData(nil))
+    if files, err := manifestReadCSV(api, root, header+","+hash+",,,,,a.txt,,,\n"); err != nil || len(files) != 1 {
+        t.Fatalf("row with empty values: %v", err)
+    }
+    for _, row := range []string{
+        "not-a-uuid," + hash + ",0,0,0,,a.txt,,,",
+        "," + hash + ",ten,0,0,,a.txt,,,",
+        "," + hash + ",-1,0,0,,a.txt,,,",
+        "," + hash + ",0,300,0,,a.txt,,,",
+        "," + hash + ",0,0,70000,,a.txt,,,",
+        "," + hash + ",0,0,0,,a.txt,,yesterday,",
+        "," + hash + ",0,0,0,,a.txt,,,not json",
+        ",zz,0,0,0,,a.txt,,,",
+    } {
+        if _, err := manifestReadCSV(api, root, header+","+hash+",0,0,0,,b.txt,,,\n"+row+"\n"); err == nil || !strings.Contains(err.Error(), "row 3") {
+            t.Errorf("row '%s' returned error %v", row, err)
+        }
+    }
+}
+
+// manifestReadCSV imports the CSV manifest and returns the result files
+func manifestReadCSV(api *webapi.WebapiInstance, root, manifest string) (files []webapi.ShareDirectoryFile, err error) {
+    result, err := api.ImportFiles(strings.NewReader(manifest), webapi.ManifestCSV, root)
+    return result.Files, err
+}
+
+func TestManifestImportRollback(t *testing.T) {
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    root := manifestRoot(t, map[string]string{"a.txt": "alpha", "b.txt": "beta"})
+
+    // b.txt is already published and is replaced by the import.
+    existing := webapi.ApiFile{ID: uuid.New(), Hash: backend.Warehouse.Add([]byte("beta")), Name: "b.txt", Size: 4}
+    if _, _, status := backend.Blockchain.AddFiles([]blockchain.BlockRecordFile{webapi.BlockRecordFileFromAPI(existing)}); status != blockchain.StatusOK {
+        t.Fatalf("adding file status %d", status)
+    }
+
+    manifest := manifestJSON(webapi.ApiFile{Hash: protocol.HashData([]byte("alpha")), Name: "a.txt"}, existing)
+
+    backend.Blockchain.FailStatus = blockchain.StatusCorruptBlockRecord
+    result, err := api.ImportFiles(bytes.NewReader(manifest), webapi.ManifestJSONLines, root)
+    if err != nil {
+        t.Fatal(err)
+    } else if result.Status != blockchain.StatusCorruptBlockRecord || len(result.Files) != 2 {
+        t.Fatalf("status %d, %d files", result.Status, len(result.Files))
+    }
+    for _, file := range result.Files {
+        if file.Status == warehouse.StatusOK || file.Error == "" {
+            t.Errorf("file '%s' reported as imported", file.File.Name)
+        }
+    }
+
+    // The new data is deleted again, the data of the existing file is kept.
+    if _, _, status, _ := backend.Warehouse.FileExists(protocol.HashData([]byte("alpha"))); status == warehouse.StatusOK {
+        t.Error("data of failed file still in the warehouse")
+    }
+    if _, _, status, _ := backend.Warehouse.FileExists(existing.Hash); status != warehouse.StatusOK {
+        t.Error("data of existing file deleted")
+    }
+    if files := syncRecords(t, backend); len(files) != 1 || files["b.txt"].ID != existing.ID {
+        t.Fatalf("blockchain changed: %+v", files)
+    }
+
+    // The same import succeeds once the blockchain works again.
+    backend.Blockchain.FailStatus = blockchain.StatusOK
+    if result, err = api.ImportFiles(bytes.NewReader(manifest), webapi.ManifestJSONLines, root); err != nil || result.Status != blockchain.StatusOK {
+        t.Fatalf("import error %v, status %d", err, result.Status)
+    }
+    if files := syncRecords(t, backend); len(files) != 2 || files["b.txt"].ID != existing.ID {
+        t.Fatalf("files after import: %+v", files)
+    }
+}
@@ -7,7 +7,10 @@ Author:     Peter Kleissner
 package webapi
 
 import (
+    "bytes"
     "net/http"
+    "path"
+    "strings"
     "time"
 
     "github.com/PeernetOfficial/core"
@@ -46,7 +49,7 @@ type ApiFile struct {
 
 // --- conversion from core to API data ---
 
-func blockRecordFileToAPI(input blockchain.BlockRecordFile) (output ApiFile) {
+func BlockRecordFileToAPI(input blockchain.BlockRecordFile) (output ApiFile) {
     output = ApiFile{ID: input.ID, Hash: input.Hash, NodeID: input.NodeID, Type: input.Type, Format: input.Format, Size: input.Size, Metadata: []ApiFileMetadata{}}
 
     for _, tag := range input.Tags {
@@ -129,7 +132,7 @@ If the block record encoding fails for any File, this function aborts with the S
 In case the function aborts, the blockchain remains unchanged.
 
 Request:    POST /blockchain/File/add with JSON structure ApiBlockAddFiles
-Response:   200 with JSON structure apiBlockchainBlockStatus
+Response:   200 with JSON structure ApiBlockchainBlockStatus
 			400 if invalid input
 */
 func (api *WebapiInstance) apiBlockchainFileAdd(w http.ResponseWriter, r *http.Request) {
@@ -154,8 +157,8 @@ func (api *WebapiInstance) apiBlockchainFileAdd(w http.ResponseWriter, r *http.R
             if _, err := warehouse.ValidateHash(file.Hash); err != nil {
                 http.Error(w, "", http.StatusBadRequest)
                 return
-            } else if _, fileSize, status, _ := api.Backend.UserWarehouse.FileExists(file.Hash); status != warehouse.StatusOK {
-                EncodeJSON(api.Backend, w, r, apiBlockchainBlockStatus{Status: blockchain.StatusNotInWarehouse})
+            } else if _, fileSize, status, _ := api.Backend.UserWarehouse().FileExists(file.Hash); status != warehouse.StatusOK {
+                EncodeJSON(api.Backend, w, r, ApiBlockchainBlockStatus{Status: blockchain.StatusNotInWarehouse})
                 return
             } else {
                 file.Size = fileSize
@@ -169,16 +172,16 @@ func (api *WebapiInstance) apiBlockchainFileAdd(w http.ResponseWriter, r *http.R
 
         // Set the merkle tree info as appropriate.
         if !SetFileMerkleInfo(api.Backend, &blockRecord) {
-            EncodeJSON(api.Backend, w, r, apiBlockchainBlockStatus{Status: blockchain.StatusNotInWarehouse})
+            EncodeJSON(api.Backend, w, r, ApiBlockchainBlockStatus{Status: blockchain.StatusNotInWarehouse})
             return
         }
 
         filesAdd = append(filesAdd, blockRecord)
     }
 
-    newHeight, newVersion, status := api.Backend.UserBlockchain.AddFiles(filesAdd)
+    newHeight, newVersion, status := api.Backend.UserBlockchain().AddFiles(filesAdd)
 
-    EncodeJSON(api.Backend, w, r, apiBlockchainBlockStatus{Status: status, Height: newHeight, Version: newVersion})
+    EncodeJSON(api.Backend, w, r, ApiBlockchainBlockStatus{Status: status, Height: newHeight, Version: newVersion})
 }
 
 /*
@@ -188,12 +191,12 @@ Request:    GET /blockchain/File/list
 Response:   200 with JSON structure ApiBlockAddFiles
 */
 func (api *WebapiInstance) apiBlockchainFileList(w http.ResponseWriter, r *http.Request) {
-    files, status := api.Backend.UserBlockchain.ListFiles()
+    files, status := api.Backend.UserBlockchain().ListFiles()
 
     var result ApiBlockAddFiles
 
     for _, file := range files {
-        result.Files = append(result.Files, blockRecordFileToAPI(file))
+        result.Files = append(result.Files, BlockRecordFileToAPI(file))
     }
 
     result.Status = status
@@ -206,7 +209,7 @@ apiBlockchainFileDelete deletes files with the provided IDs. Other fields are ig
 It will automatically delete the File in the Warehouse if there are no other references.
 
 Request:    POST /blockchain/File/delete with JSON structure ApiBlockAddFiles
-Response:   200 with JSON structure apiBlockchainBlockStatus
+Response:   200 with JSON structure ApiBlockchainBlockStatus
 */
 func (api *WebapiInstance) apiBlockchainFileDelete(w http.ResponseWriter, r *http.Request) {
     var input ApiBlockAddFiles
@@ -220,25 +223,25 @@ func (api *WebapiInstance) apiBlockchainFileDelete(w http.ResponseWriter, r *htt
         deleteIDs = append(deleteIDs, input.Files[n].ID)
     }
 
-    newHeight, newVersion, deletedFiles, status := api.Backend.UserBlockchain.DeleteFiles(deleteIDs)
+    newHeight, newVersion, deletedFiles, status := api.Backend.UserBlockchain().DeleteFiles(deleteIDs)
 
     // If successfully deleted from the blockchain, delete from the Warehouse in case there are no other references.
     if status == blockchain.StatusOK {
         for n := range deletedFiles {
-            if files, status := api.Backend.UserBlockchain.FileExists(deletedFiles[n].Hash); status == blockchain.StatusOK && len(files) == 0 {
-                api.Backend.UserWarehouse.DeleteFile(deletedFiles[n].Hash)
+            if files, status := api.Backend.UserBlockchain().FileExists(deletedFiles[n].Hash); status == blockchain.StatusOK && len(files) == 0 {
+                api.Backend.UserWarehouse().DeleteFile(deletedFiles[n].Hash)
             }
         }
     }
 
-    EncodeJSON(api.Backend, w, r, apiBlockchainBlockStatus{Status: status, Height: newHeight, Version: newVersion})
+    EncodeJSON(api.Backend, w, r, ApiBlockchainBlockStatus{Status: status, Height: newHeight, Version: newVersion})
 }
 
 /*
 apiBlockchainSelfUpdateFile updates files that are already published on the blockchain.
 
 Request:    POST /blockchain/File/update with JSON structure ApiBlockAddFiles
-Response:   200 with JSON structure apiBlockchainBlockStatus
+Response:   200 with JSON structure ApiBlockchainBlockStatus
 			400 if invalid input
 */
 func (api *WebapiInstance) apiBlockchainFileUpdate(w http.ResponseWriter, r *http.Request) {
@@ -263,8 +266,8 @@ func (api *WebapiInstance) apiBlockchainFileUpdate(w http.ResponseWriter, r *htt
             if _, err := warehouse.ValidateHash(file.Hash); err != nil {
                 http.Error(w, "", http.StatusBadRequest)
                 return
-            } else if _, fileSize, status, _ := api.Backend.UserWarehouse.FileExists(file.Hash); status != warehouse.StatusOK {
-                EncodeJSON(api.Backend, w, r, apiBlockchainBlockStatus{Status: blockchain.StatusNotInWarehouse})
+            } else if _, fileSize, status, _ := api.Backend.UserWarehouse().FileExists(file.Hash); status != warehouse.StatusOK {
+                EncodeJSON(api.Backend, w, r, ApiBlockchainBlockStatus{Status: blockchain.StatusNotInWarehouse})
                 return
             } else {
                 file.Size = fileSize
@@ -278,16 +281,16 @@ func (api *WebapiInstance) apiBlockchainFileUpdate(w http.ResponseWriter, r *htt
 
         // Set the merkle tree info as appropriate.
         if !SetFileMerkleInfo(api.Backend, &blockRecord) {
-            EncodeJSON(api.Backend, w, r, apiBlockchainBlockStatus{Status: blockchain.StatusNotInWarehouse})
+            EncodeJSON(api.Backend, w, r, ApiBlockchainBlockStatus{Status: blockchain.StatusNotInWarehouse})
             return
         }
 
         filesAdd = append(filesAdd, blockRecord)
     }
 
-    newHeight, newVersion, status := api.Backend.UserBlockchain.ReplaceFiles(filesAdd)
+    newHeight, newVersion, status := api.Backend.UserBlockchain().ReplaceFiles(filesAdd)
 
-    EncodeJSON(api.Backend, w, r, apiBlockchainBlockStatus{Status: status, Height: newHeight, Version: newVersion})
+    EncodeJSON(api.Backend, w, r, ApiBlockchainBlockStatus{Status: status, Height: newHeight, Version: newVersion})
 }
 
 // ---- metadata functions ----
@@ -317,15 +320,36 @@ func (file *ApiFile) IsVirtualFolder() bool {
     return file.Type == core.TypeFolder && file.Format == core.FormatFolder
 }
 
+// CleanFolder returns the virtual folder in a normalized form without leading and trailing slashes. Parent references cannot escape the root.
+func CleanFolder(folder string) string {
+    return path.Clean("/" + strings.ReplaceAll(folder, "\\", "/"))[1:]
+}
+
+// IsInFolder checks if the (cleaned) folder is the parent folder or a sub-folder of it
+func IsInFolder(folder, parent string) bool {
+    return folder == parent || strings.HasPrefix(folder, parent+"/")
+}
+
+// ContainsHash checks if the hash is in the list
+func ContainsHash(list [][]byte, hash []byte) bool {
+    for _, entry := range list {
+        if bytes.Equal(entry, hash) {
+            return true
+        }
+    }
+
+    return false
+}
+
 // SetFileMerkleInfo sets the merkle fields in the BlockRecordFile
-func SetFileMerkleInfo(backend *core.Backend, file *blockchain.BlockRecordFile) (valid bool) {
+func SetFileMerkleInfo(backend Backend, file *blockchain.BlockRecordFile) (valid bool) {
     if file.Size <= merkle.MinimumFragmentSize {
         // If smaller or equal than the minimum fragment size, the merkle tree is not used.
         file.MerkleRootHash = file.Hash
         file.FragmentSize = merkle.MinimumFragmentSize
     } else {
         // Get the information from the Warehouse .merkle companion File.
-        tree, status, _ := backend.UserWarehouse.ReadMerkleTree(file.Hash, true)
+        tree, status, _ := backend.UserWarehouse().ReadMerkleTree(file.Hash, true)
         if status != warehouse.StatusOK {
             return false
         }
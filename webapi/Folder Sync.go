@@ -0,0 +1,706 @@
+/*
+File Name:  Folder Sync.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi
+
+import (
+    "bytes"
+    "errors"
+    "io"
+    "io/fs"
+    "net/http"
+    "os"
+    "path"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/PeernetOfficial/core"
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/PeernetOfficial/core/warehouse"
+    "github.com/google/uuid"
+    "lukechampine.com/blake3"
+)
+
+// SyncStateFile is the name of the file in the data folder that stores the sync roots.
+const SyncStateFile = "Sync.json"
+
+// SyncIntervalDefault is the default polling interval of a sync root.
+const SyncIntervalDefault = time.Minute
+
+// SyncRoot is a local directory that is continuously mirrored into the virtual folder of the user's shared files.
+// The virtual folder is owned by the sync root: Records in it that do not exist in the local directory are removed.
+type SyncRoot struct {
+    ID        uuid.UUID                `json:"id"`        // ID of the sync root.
+    Path      string                   `json:"path"`      // Local directory.
+    Folder    string                   `json:"folder"`    // Virtual folder on the blockchain.
+    Interval  int                      `json:"interval"`  // Polling interval in seconds.
+    Paused    bool                     `json:"paused"`    // If paused, the directory is not polled. Manual sync is still possible.
+    LastSync  time.Time                `json:"lastsync"`  // Last time the directory was synced.
+    LastError string                   `json:"lasterror"` // Error of the last sync, if any.
+    Files     map[string]SyncFileState `json:"files"`     // Synced files by relative path.
+}
+
+// SyncFileState is the last known state of a synced file. It is used to detect changes without hashing the file again.
+type SyncFileState struct {
+    ID      uuid.UUID `json:"id"`      // ID of the file record.
+    Hash    []byte    `json:"hash"`    // Hash of the file data.
+    Size    uint64    `json:"size"`    // File size.
+    ModTime time.Time `json:"modtime"` // Modification time of the local file.
+}
+
+// SyncAction is a single change of a sync plan.
+type SyncAction struct {
+    Path  string  `json:"path"`            // Relative path in the local directory (slash separated).
+    File  ApiFile `json:"file"`            // Existing file record (replace and remove) or the new record (add).
+    Hash  []byte  `json:"hash"`            // New hash of the file data (replace only).
+    Error string  `json:"error,omitempty"` // Error message if the action failed.
+
+    record blockchain.BlockRecordFile // existing record
+    local  string                     // local path
+    info   fs.FileInfo                // local file info
+    isDir  bool                       // local entry is a directory
+}
+
+// SyncPlan lists the changes needed to mirror the local directory.
+type SyncPlan struct {
+    Add       []SyncAction `json:"add"`       // New files and folders.
+    Replace   []SyncAction `json:"replace"`   // Files whose content changed. The record keeps its ID and metadata.
+    Remove    []SyncAction `json:"remove"`    // Records whose local file was deleted.
+    Unchanged int          `json:"unchanged"` // Count of unchanged files and folders.
+
+    state map[string]SyncFileState // state of unchanged files
+}
+
+// SyncResult is the result of a sync run.
+type SyncResult struct {
+    Status  int          `json:"status"`  // Status of the blockchain operations. See blockchain.StatusX.
+    Height  uint64       `json:"height"`  // Height of the blockchain (number of blocks).
+    Version uint64       `json:"version"` // Version of the blockchain.
+    Plan    SyncPlan     `json:"plan"`    // Actions that were applied.
+    Failed  []SyncAction `json:"failed"`  // Actions that failed.
+}
+
+// syncWatcher runs the polling of a sync root
+type syncWatcher struct {
+    root SyncRoot      // Protected by the API sync mutex.
+    stop chan struct{} // Closed to stop polling.
+    run  sync.Mutex    // Prevents concurrent sync runs of the same root.
+}
+
+var errSyncRootNotFound = errors.New("sync root not found")
+
+// syncInit loads the sync roots from the state file and starts polling them.
+func (api *WebapiInstance) syncInit() {
+    api.syncRoots = make(map[uuid.UUID]*syncWatcher)
+
+    var roots []SyncRoot
+    api.stateLoad("syncInit", SyncStateFile, &roots)
+
+    for _, root := range roots {
+        api.syncStart(root)
+    }
+}
+
+// syncSave writes all sync roots to the state file. The caller must hold the sync mutex.
+func (api *WebapiInstance) syncSave() {
+    roots := []SyncRoot{}
+    for _, watcher := range api.syncRoots {
+        roots = append(roots, watcher.root)
+    }
+
+    api.stateSave("syncSave", SyncStateFile, roots)
+}
+
+// syncStart adds the sync root and starts polling it. The root is synced immediately and then in the interval until stopped.
+func (api *WebapiInstance) syncStart(root SyncRoot) {
+    if root.Files == nil {
+        root.Files = make(map[string]SyncFileState)
+    }
+
+    watcher := &syncWatcher{root: root, stop: make(chan struct{})}
+
+    api.syncMutex.Lock()
+    api.syncRoots[root.ID] = watcher
+    api.syncMutex.Unlock()
+
+    go poll(watcher.stop, func() time.Duration {
+        api.syncMutex.RLock()
+        id, paused, interval := watcher.root.ID, watcher.root.Paused, time.Duration(watcher.root.Interval)*time.Second
+        api.syncMutex.RUnlock()
+
+        if !paused {
+            api.SyncRun(id)
+        }
+
+        return interval
+    })
+}
+
+// SyncAdd starts mirroring the local directory into the virtual folder. If the virtual folder is empty, the name of the directory is used.
+// The interval is the polling interval; 0 uses SyncIntervalDefault. The first sync starts immediately in the background.
+func (api *WebapiInstance) SyncAdd(directory, virtualFolder string, interval time.Duration) (root SyncRoot, err error) {
+    if directory, err = filepath.Abs(directory); err != nil {
+        return root, err
+    } else if stat, err := os.Stat(directory); err != nil {
+        return root, err
+    } else if !stat.IsDir() {
+        return root, errors.New("path is not a directory")
+    }
+
+    if virtualFolder == "" {
+        virtualFolder = filepath.Base(directory)
+    }
+    if interval < time.Second {
+        interval = SyncIntervalDefault
+    }
+
+    root = SyncRoot{ID: uuid.New(), Path: directory, Folder: CleanFolder(virtualFolder), Interval: int(interval / time.Second)}
+    if root.Folder == "" {
+        return root, errors.New("virtual folder cannot be the root")
+    }
+
+    // Roots may not overlap, otherwise each sync would remove the files of the other.
+    api.syncMutex.RLock()
+    for _, watcher := range api.syncRoots {
+        if IsInFolder(watcher.root.Folder, root.Folder) || IsInFolder(root.Folder, watcher.root.Folder) {
+            api.syncMutex.RUnlock()
+            return root, errors.New("virtual folder overlaps an already synced folder")
+        }
+    }
+    api.syncMutex.RUnlock()
+
+    api.syncStart(root)
+
+    api.syncMutex.Lock()
+    api.syncSave()
+    api.syncMutex.Unlock()
+
+    return root, nil
+}
+
+// SyncRemove stops syncing the root. Already shared files remain shared.
+func (api *WebapiInstance) SyncRemove(id uuid.UUID) (err error) {
+    api.syncMutex.Lock()
+    defer api.syncMutex.Unlock()
+
+    watcher, ok := api.syncRoots[id]
+    if !ok {
+        return errSyncRootNotFound
+    }
+
+    close(watcher.stop)
+    delete(api.syncRoots, id)
+    api.syncSave()
+
+    return nil
+}
+
+// SyncPause pauses or resumes polling of the root.
+func (api *WebapiInstance) SyncPause(id uuid.UUID, paused bool) (root SyncRoot, err error) {
+    api.syncMutex.Lock()
+    defer api.syncMutex.Unlock()
+
+    watcher, ok := api.syncRoots[id]
+    if !ok {
+        return root, errSyncRootNotFound
+    }
+
+    watcher.root.Paused = paused
+    api.syncSave()
+
+    return watcher.root, nil
+}
+
+// SyncList returns all sync roots.
+func (api *WebapiInstance) SyncList() (roots []SyncRoot) {
+    api.syncMutex.RLock()
+    defer api.syncMutex.RUnlock()
+
+    for _, watcher := range api.syncRoots {
+        roots = append(roots, watcher.root)
+    }
+
+    return roots
+}
+
+// syncLookup returns the watcher and a copy of the root
+func (api *WebapiInstance) syncLookup(id uuid.UUID) (watcher *syncWatcher, root SyncRoot, err error) {
+    api.syncMutex.RLock()
+    defer api.syncMutex.RUnlock()
+
+    watcher, ok := api.syncRoots[id]
+    if !ok {
+        return nil, root, errSyncRootNotFound
+    }
+
+    return watcher, watcher.root, nil
+}
+
+// SyncPlan compares the local directory with the shared files and returns the changes needed, without applying them (dry run).
+func (api *WebapiInstance) SyncPlan(id uuid.UUID) (plan SyncPlan, err error) {
+    watcher, root, err := api.syncLookup(id)
+    if err != nil {
+        return plan, err
+    }
+
+    watcher.run.Lock()
+    defer watcher.run.Unlock()
+
+    return api.syncPlan(root)
+}
+
+// SyncRun syncs the root immediately: New files are added, changed files are replaced and deleted files are removed.
+// Files that cannot be imported are reported and retried in the next run.
+func (api *WebapiInstance) SyncRun(id uuid.UUID) (result SyncResult, err error) {
+    watcher, root, err := api.syncLookup(id)
+    if err != nil {
+        return result, err
+    }
+
+    watcher.run.Lock()
+    defer watcher.run.Unlock()
+
+    var state map[string]SyncFileState
+
+    result.Plan, err = api.syncPlan(root)
+    if err == nil {
+        result, state = api.syncApply(result.Plan)
+        if result.Status != blockchain.StatusOK {
+            err = errors.New("blockchain error status " + strconv.Itoa(result.Status))
+        }
+    }
+
+    api.syncMutex.Lock()
+    defer api.syncMutex.Unlock()
+
+    watcher.root.LastSync = time.Now()
+    watcher.root.LastError = ""
+
+    if err != nil {
+        watcher.root.LastError = err.Error()
+        api.Backend.LogError("SyncRun", "syncing '%s' error: %v", root.Path, err)
+    } else {
+        watcher.root.Files = state
+    }
+
+    if _, ok := api.syncRoots[id]; ok {
+        api.syncSave()
+    }
+
+    return result, err
+}
+
+// syncPlan compares the local directory with the records in the virtual folder
+func (api *WebapiInstance) syncPlan(root SyncRoot) (plan SyncPlan, err error) {
+    plan.state = make(map[string]SyncFileState)
+
+    // records by relative path
+    files, status := api.Backend.UserBlockchain().ListFiles()
+    if status != blockchain.StatusOK {
+        return plan, errors.New("blockchain error status " + strconv.Itoa(status))
+    }
+
+    records := make(map[string]blockchain.BlockRecordFile)
+    for _, file := range files {
+        apiFile := BlockRecordFileToAPI(file)
+        folder := CleanFolder(apiFile.Folder)
+        if folder != root.Folder && !strings.HasPrefix(folder, root.Folder+"/") {
+            continue
+        }
+
+        relative := strings.TrimPrefix(path.Join(folder, apiFile.Name), root.Folder+"/")
+        if _, exists := records[relative]; exists {
+            // duplicate records with the same path are removed
+            plan.Remove = append(plan.Remove, SyncAction{Path: relative, File: apiFile, record: file})
+            continue
+        }
+        records[relative] = file
+    }
+
+    err = filepath.WalkDir(root.Path, func(entryPath string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        } else if entryPath == root.Path || (!d.IsDir() && !d.Type().IsRegular()) {
+            return nil
+        }
+
+        info, err := d.Info()
+        if err != nil {
+            return err
+        }
+
+        relative, _ := filepath.Rel(root.Path, entryPath)
+        relative = filepath.ToSlash(relative)
+        action := SyncAction{Path: relative, local: entryPath, info: info, isDir: d.IsDir()}
+
+        record, exists := records[relative]
+        if exists {
+            delete(records, relative)
+            action.record = record
+            action.File = BlockRecordFileToAPI(record)
+
+            if action.File.IsVirtualFolder() != d.IsDir() {
+                // type changed between file and folder
+                plan.Remove = append(plan.Remove, action)
+                action.record = blockchain.BlockRecordFile{}
+                exists = false
+            }
+        }
+
+        if !exists {
+            folder, name := path.Split(path.Join(root.Folder, relative))
+            action.File = ApiFile{Folder: path.Clean("/" + folder)[1:], Name: name}
+            if d.IsDir() {
+                action.File.Type = core.TypeFolder
+                action.File.Format = core.FormatFolder
+            } else {
+                action.File.Size = uint64(info.Size())
+            }
+            plan.Add = append(plan.Add, action)
+            return nil
+        } else if d.IsDir() {
+            plan.Unchanged++
+            return nil
+        }
+
+        // Only hash the file if it changed since the last sync.
+        last, known := root.Files[relative]
+        if known && last.ID == record.ID && bytes.Equal(last.Hash, record.Hash) && last.Size == uint64(info.Size()) && last.ModTime.Equal(info.ModTime()) {
+            plan.state[relative] = last
+            plan.Unchanged++
+            return nil
+        }
+
+        hash, err := syncHashFile(entryPath)
+        if err != nil {
+            return err
+        }
+
+        if bytes.Equal(hash, record.Hash) {
+            plan.state[relative] = SyncFileState{ID: record.ID, Hash: hash, Size: uint64(info.Size()), ModTime: info.ModTime()}
+            plan.Unchanged++
+            return nil
+        }
+
+        action.Hash = hash
+        plan.Replace = append(plan.Replace, action)
+
+        return nil
+    })
+    if err != nil {
+        return plan, err
+    }
+
+    // remaining records do not exist locally
+    for relative, record := range records {
+        plan.Remove = append(plan.Remove, SyncAction{Path: relative, File: BlockRecordFileToAPI(record), record: record})
+    }
+
+    return plan, nil
+}
+
+// syncApply applies the plan and returns the new state of the synced files
+func (api *WebapiInstance) syncApply(plan SyncPlan) (result SyncResult, state map[string]SyncFileState) {
+    state = plan.state
+    result.Plan.Unchanged = plan.Unchanged
+
+    var filesAdd, filesReplace []blockchain.BlockRecordFile
+    var collect [][]byte // hashes of replaced or removed records, deleted from the warehouse if no longer referenced
+
+    // import adds and replaces into the warehouse
+    for _, action := range append(plan.Add, plan.Replace...) {
+        isReplace := action.record.ID != uuid.Nil
+        record := action.record
+
+        if !isReplace {
+            action.File.ID = uuid.New()
+            action.File.NodeID = api.Backend.SelfNodeID()
+            action.File.Date = time.Now()
+            record = BlockRecordFileFromAPI(action.File)
+        }
+
+        if action.isDir {
+            record.Hash = protocol.HashData(nil)
+        } else {
+            if err := api.syncImport(&action, &record); err != nil {
+                action.Error = err.Error()
+                result.Failed = append(result.Failed, action)
+                continue
+            }
+            state[action.Path] = SyncFileState{ID: record.ID, Hash: record.Hash, Size: record.Size, ModTime: action.info.ModTime()}
+        }
+
+        file := BlockRecordFileToAPI(record)
+        if !isReplace {
+            file.NodeID, file.Date = action.File.NodeID, action.File.Date
+        }
+        action.File = file
+
+        if isReplace {
+            collect = append(collect, action.record.Hash)
+            filesReplace = append(filesReplace, record)
+            result.Plan.Replace = append(result.Plan.Replace, action)
+        } else {
+            filesAdd = append(filesAdd, record)
+            result.Plan.Add = append(result.Plan.Add, action)
+        }
+    }
+
+    var removeIDs []uuid.UUID
+    for _, action := range plan.Remove {
+        removeIDs = append(removeIDs, action.record.ID)
+        if !action.File.IsVirtualFolder() {
+            collect = append(collect, action.record.Hash)
+        }
+        result.Plan.Remove = append(result.Plan.Remove, action)
+    }
+
+    result.Status = blockchain.StatusOK
+    _, result.Height, result.Version = api.Backend.UserBlockchain().Header()
+
+    // If a blockchain operation fails, the remaining ones are skipped. Skipped actions are reported as failed and retried in the next run.
+    // Their imported data is deleted from the warehouse again in case there are no other references.
+    skip := func(actions *[]SyncAction, imported bool) {
+        for _, action := range *actions {
+            action.Error = "blockchain error status " + strconv.Itoa(result.Status)
+            result.Failed = append(result.Failed, action)
+
+            if imported {
+                delete(state, action.Path)
+                if !action.isDir {
+                    collect = append(collect, action.File.Hash)
+                }
+            }
+        }
+        *actions = nil
+    }
+
+    if len(removeIDs) > 0 {
+        result.Height, result.Version, _, result.Status = api.Backend.UserBlockchain().DeleteFiles(removeIDs)
+        if result.Status != blockchain.StatusOK {
+            skip(&result.Plan.Remove, false)
+        }
+    }
+    if result.Status != blockchain.StatusOK {
+        skip(&result.Plan.Replace, true)
+    } else if len(filesReplace) > 0 {
+        if result.Height, result.Version, result.Status = api.Backend.UserBlockchain().ReplaceFiles(filesReplace); result.Status != blockchain.StatusOK {
+            skip(&result.Plan.Replace, true)
+        }
+    }
+    if result.Status != blockchain.StatusOK {
+        skip(&result.Plan.Add, true)
+    } else if len(filesAdd) > 0 {
+        if result.Height, result.Version, result.Status = api.Backend.UserBlockchain().AddFiles(filesAdd); result.Status != blockchain.StatusOK {
+            skip(&result.Plan.Add, true)
+        }
+    }
+    if result.Status != blockchain.StatusOK {
+        _, result.Height, result.Version = api.Backend.UserBlockchain().Header()
+    }
+
+    // Delete replaced, removed, and skipped data from the warehouse in case there are no other references.
+    for n, hash := range collect {
+        if ContainsHash(collect[:n], hash) {
+            continue
+        }
+        if files, status := api.Backend.UserBlockchain().FileExists(hash); status == blockchain.StatusOK && len(files) == 0 {
+            api.Backend.UserWarehouse().DeleteFile(hash)
+        }
+    }
+
+    return result, state
+}
+
+// syncImport imports the local file into the warehouse and updates the record
+func (api *WebapiInstance) syncImport(action *SyncAction, record *blockchain.BlockRecordFile) (err error) {
+    hash, status, err := api.Backend.UserWarehouse().CreateFileFromPath(action.local)
+    if err == nil && status == warehouse.StatusOK {
+        _, record.Size, status, err = api.Backend.UserWarehouse().FileExists(hash)
+    }
+    if err != nil {
+        return err
+    } else if status != warehouse.StatusOK {
+        return errors.New("warehouse error status " + strconv.Itoa(status))
+    }
+
+    record.Hash = hash
+    fileType, fileFormat, _ := FileDetectType(action.local)
+    record.Type = uint8(fileType)
+    record.Format = fileFormat
+
+    if !SetFileMerkleInfo(api.Backend, record) {
+        return errors.New("merkle information not available")
+    }
+
+    return nil
+}
+
+// syncHashFile returns the hash of the file data without reading the entire file into memory
+func syncHashFile(filename string) (hash []byte, err error) {
+    file, err := os.Open(filename)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    hasher := blake3.New(protocol.HashSize, nil)
+    if _, err = io.Copy(hasher, file); err != nil {
+        return nil, err
+    }
+
+    return hasher.Sum(nil), nil
+}
+
+/*
+apiSyncList returns all sync roots. A sync root mirrors a local directory into a virtual folder of the user's shared files.
+
+Request:    GET /sync/list
+Result:     200 with JSON array of SyncRoot
+*/
+func (api *WebapiInstance) apiSyncList(w http.ResponseWriter, r *http.Request) {
+    roots := api.SyncList()
+    if roots == nil {
+        roots = []SyncRoot{}
+    }
+
+    EncodeJSON(api.Backend, w, r, roots)
+}
+
+/*
+apiSyncAdd starts syncing a local directory into the virtual folder. If the folder is not set, the name of the directory is used.
+The interval is the polling interval in seconds (optional).
+Warning: Same as /warehouse/create/path, any local directory can be supplied. No input path verification or limitation is done.
+
+Request:    GET /sync/add?path=[directory on disk]&folder=[virtual folder]&interval=[seconds]
+Result:     200 with JSON structure SyncRoot
+            400 if the directory cannot be read or the virtual folder is already synced
+*/
+func (api *WebapiInstance) apiSyncAdd(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    directory := r.Form.Get("path")
+    interval, _ := strconv.Atoi(r.Form.Get("interval"))
+    if directory == "" {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    root, err := api.SyncAdd(directory, r.Form.Get("folder"), time.Duration(interval)*time.Second)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    EncodeJSON(api.Backend, w, r, root)
+}
+
+/*
+apiSyncRemove stops syncing. Already shared files remain shared.
+
+Request:    GET /sync/remove?ID=[sync root ID]
+Result:     204 on success
+            404 if the sync root was not found
+*/
+func (api *WebapiInstance) apiSyncRemove(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    id, err := uuid.Parse(r.Form.Get("ID"))
+    if err != nil {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    if err := api.SyncRemove(id); err != nil {
+        http.Error(w, "", http.StatusNotFound)
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+apiSyncAction pauses or resumes polling. Action: 0 = Pause, 1 = Resume.
+
+Request:    GET /sync/action?ID=[sync root ID]&action=[action]
+Result:     200 with JSON structure SyncRoot
+            404 if the sync root was not found
+*/
+func (api *WebapiInstance) apiSyncAction(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    id, err := uuid.Parse(r.Form.Get("ID"))
+    action, err2 := strconv.Atoi(r.Form.Get("action"))
+    if err != nil || err2 != nil || action < 0 || action > 1 {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    root, err := api.SyncPause(id, action == 0)
+    if err != nil {
+        http.Error(w, "", http.StatusNotFound)
+        return
+    }
+
+    EncodeJSON(api.Backend, w, r, root)
+}
+
+/*
+apiSyncPlan returns the changes that a sync would apply, without applying them (dry run).
+
+Request:    GET /sync/plan?ID=[sync root ID]
+Result:     200 with JSON structure SyncPlan
+            404 if the sync root was not found
+            500 if the directory cannot be read
+*/
+func (api *WebapiInstance) apiSyncPlan(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    id, err := uuid.Parse(r.Form.Get("ID"))
+    if err != nil {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    plan, err := api.SyncPlan(id)
+    if err == errSyncRootNotFound {
+        http.Error(w, "", http.StatusNotFound)
+        return
+    } else if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    EncodeJSON(api.Backend, w, r, plan)
+}
+
+/*
+apiSyncRun syncs immediately, regardless if the sync root is paused.
+
+Request:    GET /sync/run?ID=[sync root ID]
+Result:     200 with JSON structure SyncResult
+            404 if the sync root was not found
+            500 if the directory cannot be read
+*/
+func (api *WebapiInstance) apiSyncRun(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    id, err := uuid.Parse(r.Form.Get("ID"))
+    if err != nil {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    result, err := api.SyncRun(id)
+    if err == errSyncRootNotFound {
+        http.Error(w, "", http.StatusNotFound)
+        return
+    } else if err != nil && result.Status == blockchain.StatusOK {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    EncodeJSON(api.Backend, w, r, result)
+}
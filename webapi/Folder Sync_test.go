@@ -0,0 +1,133 @@
+/*
+File Name:  Folder Sync_test.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi_test
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/Abstraction/webapitest"
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/google/uuid"
+)
+
+// syncRecords returns the files on the user's blockchain by their path
+func syncRecords(t *testing.T, backend *webapitest.Backend) (files map[string]webapi.ApiFile) {
+    t.Helper()
+
+    records, status := backend.Blockchain.ListFiles()
+    if status != blockchain.StatusOK {
+        t.Fatalf("list files status %d", status)
+    }
+
+    files = make(map[string]webapi.ApiFile)
+    for _, record := range records {
+        file := webapi.BlockRecordFileToAPI(record)
+        if _, ok := files[webapi.CleanFolder(file.Folder+"/"+file.Name)]; ok {
+            t.Fatalf("duplicate record for '%s/%s'", file.Folder, file.Name)
+        }
+        files[webapi.CleanFolder(file.Folder+"/"+file.Name)] = file
+    }
+
+    return files
+}
+
+func TestSyncAddRoots(t *testing.T) {
+    backend := webapitest.NewBackend()
+    backend.Data = t.TempDir()
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    directory := t.TempDir()
+
+    root, err := api.SyncAdd(directory, "docs/work", 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer api.SyncRemove(root.ID)
+
+    for _, folder := range []string{"/", ".", "docs", "docs/work", "/docs/work/", "docs/work/sub"} {
+        if root, err := api.SyncAdd(directory, folder, 0); err == nil {
+            api.SyncRemove(root.ID)
+            t.Errorf("virtual folder '%s' accepted", folder)
+        }
+    }
+
+    // A sibling folder does not overlap.
+    other, err := api.SyncAdd(directory, "docs/working", 0)
+    if err != nil {
+        t.Fatalf("sibling folder rejected: %v", err)
+    }
+    api.SyncRemove(other.ID)
+}
+
+func TestSyncTypeChange(t *testing.T) {
+    backend := webapitest.NewBackend()
+    backend.Data = t.TempDir()
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    directory := t.TempDir()
+    data := []byte("synced file data")
+    if err := os.WriteFile(filepath.Join(directory, "x"), data, 0666); err != nil {
+        t.Fatal(err)
+    }
+
+    root, err := api.SyncAdd(directory, "docs", 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer api.SyncRemove(root.ID)
+
+    if _, err := api.SyncRun(root.ID); err != nil {
+        t.Fatal(err)
+    }
+    if file, ok := syncRecords(t, backend)["docs/x"]; !ok || file.IsVirtualFolder() {
+        t.Fatalf("file not synced: %+v", file)
+    }
+
+    // The file becomes a directory.
+    os.Remove(filepath.Join(directory, "x"))
+    os.Mkdir(filepath.Join(directory, "x"), os.ModePerm)
+    if err := os.WriteFile(filepath.Join(directory, "x", "inner.txt"), data, 0666); err != nil {
+        t.Fatal(err)
+    }
+
+    if result, err := api.SyncRun(root.ID); err != nil || len(result.Failed) > 0 {
+        t.Fatalf("sync error %v, failed %+v", err, result.Failed)
+    }
+
+    records := syncRecords(t, backend)
+    if folder, ok := records["docs/x"]; !ok || !folder.IsVirtualFolder() {
+        t.Fatalf("file not replaced by a folder: %+v", folder)
+    }
+    if file, ok := records["docs/x/inner.txt"]; !ok || !bytes.Equal(file.Hash, protocol.HashData(data)) {
+        t.Fatalf("file in the new folder not synced: %+v", file)
+    }
+
+    // The directory becomes a file again.
+    os.RemoveAll(filepath.Join(directory, "x"))
+    if err := os.WriteFile(filepath.Join(directory, "x"), data, 0666); err != nil {
+        t.Fatal(err)
+    }
+
+    if result, err := api.SyncRun(root.ID); err != nil || len(result.Failed) > 0 {
+        t.Fatalf("sync error %v, failed %+v", err, result.Failed)
+    }
+
+    records = syncRecords(t, backend)
+    if file, ok := records["docs/x"]; !ok || file.IsVirtualFolder() || !bytes.Equal(file.Hash, protocol.HashData(data)) {
+        t.Fatalf("folder not replaced by a file: %+v", file)
+    }
+    if _, ok := records["docs/x/inner.txt"]; ok {
+        t.Fatal("file of the removed folder still shared")
+    }
+}
@@ -0,0 +1,206 @@
+/*
+File Name:  Link.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi
+
+import (
+    "encoding/hex"
+    "errors"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/btcec"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/google/uuid"
+)
+
+/*
+ShareLink is a link to a file shared by a peer. It can be pasted into chat or tickets and contains everything needed to download the file:
+
+    peernet://file/[hash]?node=[node ID]&name=[file name]&size=[size]&folder=[folder]
+
+The hash and node ID are hex encoded. Instead of the node ID, the peer ID (the compressed public key of the peer, hex encoded) may be provided as "peer" parameter.
+The name, size and folder are informational and optional. The name may not contain a path.
+*/
+type ShareLink struct {
+    Hash      []byte           // Blake3 hash of the file
+    NodeID    []byte           // Node ID of the peer sharing the file
+    PublicKey *btcec.PublicKey // Public key of the peer sharing the file. Optional, if set the link contains the peer ID instead of the node ID.
+    Name      string           // Name of the file
+    Folder    string           // Folder of the file
+    Size      uint64           // Size of the file
+}
+
+// ShareLinkScheme is the URI scheme of share links
+const ShareLinkScheme = "peernet"
+
+// ErrInvalidLink is returned when parsing an invalid share link
+var ErrInvalidLink = errors.New("invalid share link")
+
+// NewShareLink returns the share link for the file shared by the node
+func NewShareLink(file ApiFile, nodeID []byte) ShareLink {
+    return ShareLink{Hash: file.Hash, NodeID: nodeID, Name: file.Name, Folder: file.Folder, Size: file.Size}
+}
+
+// String returns the link as URI
+func (link ShareLink) String() string {
+    query := url.Values{}
+
+    if link.PublicKey != nil {
+        query.Set("peer", hex.EncodeToString(link.PublicKey.SerializeCompressed()))
+    } else {
+        query.Set("node", hex.EncodeToString(link.NodeID))
+    }
+    if link.Name != "" {
+        query.Set("name", link.Name)
+    }
+    if link.Folder != "" {
+        query.Set("folder", link.Folder)
+    }
+    if link.Size > 0 {
+        query.Set("size", strconv.FormatUint(link.Size, 10))
+    }
+
+    uri := url.URL{Scheme: ShareLinkScheme, Host: "file", Path: "/" + hex.EncodeToString(link.Hash), RawQuery: query.Encode()}
+
+    return uri.String()
+}
+
+// ParseShareLink parses a share link. If the link contains the peer ID, the node ID is derived from it.
+func ParseShareLink(uri string) (link ShareLink, err error) {
+    parsed, err := url.Parse(strings.TrimSpace(uri))
+    if err != nil || !strings.EqualFold(parsed.Scheme, ShareLinkScheme) || !strings.EqualFold(parsed.Host, "file") {
+        return link, ErrInvalidLink
+    }
+
+    var valid bool
+    if link.Hash, valid = DecodeBlake3Hash(strings.Trim(parsed.Path, "/")); !valid {
+        return link, ErrInvalidLink
+    }
+
+    query := parsed.Query()
+
+    if peerID := query.Get("peer"); peerID != "" {
+        publicKeyB, err := hex.DecodeString(peerID)
+        if err != nil {
+            return link, ErrInvalidLink
+        }
+        if link.PublicKey, err = btcec.ParsePubKey(publicKeyB, btcec.S256()); err != nil {
+            return link, ErrInvalidLink
+        }
+        link.NodeID = protocol.PublicKey2NodeID(link.PublicKey)
+    } else if link.NodeID, valid = DecodeBlake3Hash(query.Get("node")); !valid {
+        return link, ErrInvalidLink
+    }
+
+    if size := query.Get("size"); size != "" {
+        if link.Size, err = strconv.ParseUint(size, 10, 64); err != nil {
+            return link, ErrInvalidLink
+        }
+    }
+
+    // The name is a file name only, it may not contain a path.
+    link.Name = query.Get("name")
+    link.Folder = query.Get("folder")
+    if strings.ContainsAny(link.Name, "/\\") || link.Name == "." || link.Name == ".." {
+        return link, ErrInvalidLink
+    }
+
+    return link, nil
+}
+
+// LinkCreate returns the share link for a file on the user's blockchain
+func (api *WebapiInstance) LinkCreate(ID uuid.UUID) (link ShareLink, file ApiFile, err error) {
+    files, status := api.Backend.UserBlockchain().ListFiles()
+    if status != blockchain.StatusOK {
+        return link, file, errors.New("error listing files, blockchain status " + strconv.Itoa(status))
+    }
+
+    for n := range files {
+        if files[n].ID == ID {
+            file = BlockRecordFileToAPI(files[n])
+            return NewShareLink(file, api.Backend.SelfNodeID()), file, nil
+        }
+    }
+
+    return link, file, os.ErrNotExist
+}
+
+// LinkDownload starts the download of the linked file. If the path is an existing directory, the file is stored in it using the name from the link.
+func (api *WebapiInstance) LinkDownload(link ShareLink, filePath string) (info *DownloadInfo, err error) {
+    if stat, err := os.Stat(filePath); err == nil && stat.IsDir() {
+        name := filepath.Base(filepath.Clean("/" + strings.ReplaceAll(link.Name, "\\", "/")))
+        if name == "" || name == "." || name == string(filepath.Separator) {
+            name = hex.EncodeToString(link.Hash)
+        }
+
+        filePath = filepath.Join(filePath, name)
+    }
+
+    return api.DownloadStart(link.Hash, link.NodeID, filePath)
+}
+
+// ApiResponseLink is the share link of a file
+type ApiResponseLink struct {
+    Link string  `json:"link"` // Share link.
+    File ApiFile `json:"file"` // The shared file.
+}
+
+/*
+apiLinkCreate returns the share link for a file on the user's blockchain.
+
+Request:    GET /link/create?id=[file ID]
+Result:     200 with JSON structure ApiResponseLink
+            400 if invalid ID
+            404 if file not found
+*/
+func (api *WebapiInstance) apiLinkCreate(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    ID, err := uuid.Parse(r.Form.Get("id"))
+    if err != nil {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    link, file, err := api.LinkCreate(ID)
+    if err != nil {
+        http.Error(w, "", http.StatusNotFound)
+        return
+    }
+
+    EncodeJSON(api.Backend, w, r, ApiResponseLink{Link: link.String(), File: file})
+}
+
+/*
+apiLinkDownload validates the share link and starts the download of the file. The path is the full path on disk to store the file.
+If the path is an existing directory, the file is stored in it using the name from the link.
+
+Request:    GET /link/download?uri=[share link]&path=[target path on disk]
+Result:     200 with JSON structure ApiResponseDownloadStatus
+            400 if invalid link or path
+*/
+func (api *WebapiInstance) apiLinkDownload(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    link, err := ParseShareLink(r.Form.Get("uri"))
+    filePath := r.Form.Get("path")
+    if err != nil || filePath == "" {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    info, err := api.LinkDownload(link, filePath)
+    if err != nil {
+        EncodeJSON(api.Backend, w, r, ApiResponseDownloadStatus{APIStatus: DownloadResponseFileInvalid})
+        return
+    }
+
+    EncodeJSON(api.Backend, w, r, ApiResponseDownloadStatus{APIStatus: DownloadResponseSuccess, ID: info.ID, DownloadStatus: DownloadWaitMetadata})
+}
@@ -0,0 +1,117 @@
+/*
+File Name:  Link_test.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi_test
+
+import (
+    "bytes"
+    "encoding/hex"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/Abstraction/webapitest"
+    "github.com/PeernetOfficial/core/btcec"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/google/uuid"
+)
+
+func TestShareLinkRoundTrip(t *testing.T) {
+    privateKey, err := btcec.NewPrivateKey(btcec.S256())
+    if err != nil {
+        t.Fatal(err)
+    }
+    publicKey := privateKey.PubKey()
+
+    file := webapi.ApiFile{Hash: protocol.HashData([]byte("link")), Name: "my file & notes.txt", Folder: "docs/2021", Size: 4}
+
+    withNode := webapi.NewShareLink(file, protocol.PublicKey2NodeID(publicKey))
+    withPeer := withNode
+    withPeer.PublicKey = publicKey
+    minimal := webapi.ShareLink{Hash: file.Hash, NodeID: withNode.NodeID}
+
+    for _, link := range []webapi.ShareLink{withNode, withPeer, minimal} {
+        uri := link.String()
+
+        parsed, err := webapi.ParseShareLink(uri)
+        if err != nil {
+            t.Fatalf("parsing '%s': %v", uri, err)
+        }
+
+        if !bytes.Equal(parsed.Hash, link.Hash) || !bytes.Equal(parsed.NodeID, link.NodeID) || parsed.Name != link.Name || parsed.Folder != link.Folder || parsed.Size != link.Size {
+            t.Errorf("link '%s' parsed as %+v", uri, parsed)
+        }
+        if (link.PublicKey == nil) != (parsed.PublicKey == nil) || (link.PublicKey != nil && !link.PublicKey.IsEqual(parsed.PublicKey)) {
+            t.Errorf("link '%s' parsed with public key %v", uri, parsed.PublicKey)
+        }
+        if link.PublicKey != nil && strings.Contains(uri, "node=") {
+            t.Errorf("link '%s' contains the node ID instead of the peer ID", uri)
+        }
+    }
+
+    // The scheme and host are case-insensitive and surrounding whitespace is ignored.
+    if _, err := webapi.ParseShareLink("  PEERNET://FILE/" + hex.EncodeToString(file.Hash) + "?node=" + hex.EncodeToString(withNode.NodeID) + "\n"); err != nil {
+        t.Fatalf("parsing upper case link: %v", err)
+    }
+}
+
+func TestShareLinkInvalid(t *testing.T) {
+    hash := hex.EncodeToString(protocol.HashData([]byte("link")))
+    node := hex.EncodeToString(protocol.HashData([]byte("node")))
+
+    for _, uri := range []string{
+        "",
+        "https://file/" + hash + "?node=" + node,              // wrong scheme
+        "peernet://folder/" + hash + "?node=" + node,          // wrong host
+        "peernet://file/" + hash[:62] + "?node=" + node,       // hash too short
+        "peernet://file/" + hash + "00?node=" + node,          // hash too long
+        "peernet://file/" + "zz" + hash[2:] + "?node=" + node, // hash not hex
+        "peernet://file/" + hash,                              // no node
+        "peernet://file/" + hash + "?node=" + node[:62],       // node ID too short
+        "peernet://file/" + hash + "?peer=zz",                 // peer ID not hex
+        "peernet://file/" + hash + "?peer=" + node,            // peer ID not a public key
+        "peernet://file/" + hash + "?node=" + node + "&size=-1",
+        "peernet://file/" + hash + "?node=" + node + "&size=ten",
+        "peernet://file/" + hash + "?node=" + node + "&name=../evil.txt",
+        "peernet://file/" + hash + "?node=" + node + "&name=..%5Cevil.txt",
+        "peernet://file/" + hash + "?node=" + node + "&name=docs/a.txt",
+        "peernet://file/" + hash + "?node=" + node + "&name=..",
+    } {
+        if link, err := webapi.ParseShareLink(uri); err != webapi.ErrInvalidLink {
+            t.Errorf("link '%s' parsed as %+v, error %v", uri, link, err)
+        }
+    }
+}
+
+func TestLinkDownloadName(t *testing.T) {
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    hash := protocol.HashData([]byte("link"))
+    directory := t.TempDir()
+
+    // Links created in code are not validated by parsing. The name is reduced to the file name and stays inside the directory.
+    for name, expected := range map[string]string{
+        "a.txt":             "a.txt",
+        "../../evil.txt":    "evil.txt",
+        "..\\..\\evil2.txt": "evil2.txt",
+        "/etc/passwd":       "passwd",
+        "..":                hex.EncodeToString(hash),
+        "":                  hex.EncodeToString(hash),
+    } {
+        info, err := api.LinkDownload(webapi.ShareLink{Hash: hash, NodeID: protocol.HashData([]byte("node")), Name: name}, directory)
+        if err != nil {
+            t.Fatalf("name '%s': %v", name, err)
+        }
+        waitDownload(t, info)
+
+        if info.DiskFile.Name != filepath.Join(directory, expected) {
+            t.Errorf("name '%s' stored as '%s', expected '%s'", name, info.DiskFile.Name, filepath.Join(directory, expected))
+        }
+    }
+}
@@ -0,0 +1,461 @@
+/*
+File Name:  Mirror.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi
+
+import (
+    "bytes"
+    "encoding/hex"
+    "errors"
+    "net/http"
+    "os"
+    "path"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/google/uuid"
+)
+
+// MirrorStateFile is the name of the file in the data folder that stores the mirrors.
+const MirrorStateFile = "Mirror.json"
+
+// MirrorIntervalDefault is the default interval to check the blockchain of the mirrored peer.
+const MirrorIntervalDefault = 10 * time.Minute
+
+// Mirror replicates the files shared by a remote peer into a local directory, keeping the virtual folder structure.
+// New and changed files are downloaded. Files deleted by the peer are kept locally.
+type Mirror struct {
+    ID        uuid.UUID                  `json:"id"`        // ID of the mirror.
+    NodeID    []byte                     `json:"nodeid"`    // Node ID of the mirrored peer.
+    Path      string                     `json:"path"`      // Local target directory.
+    Interval  int                        `json:"interval"`  // Interval in seconds to check the peer's blockchain.
+    Filter    MirrorFilter               `json:"filter"`    // Filter which files are mirrored.
+    LastCheck time.Time                  `json:"lastcheck"` // Last time the peer's blockchain was checked.
+    LastError string                     `json:"lasterror"` // Error of the last check, if any.
+    Files     map[uuid.UUID]MirroredFile `json:"files"`     // Mirrored files by file ID.
+}
+
+// MirrorFilter filters which files are mirrored. Empty lists accept any.
+type MirrorFilter struct {
+    Types   []int    `json:"types"`   // File types. See core.TypeX.
+    Formats []uint16 `json:"formats"` // File formats. See core.FormatX.
+    Folders []string `json:"folders"` // Virtual folders. Sub-folders are included.
+}
+
+// MirroredFile is the state of a file of the mirrored peer.
+type MirroredFile struct {
+    Hash       []byte    `json:"hash"`       // Hash of the file data.
+    Path       string    `json:"path"`       // Path relative to the target directory (slash separated).
+    Status     int       `json:"status"`     // Status of the last download. See DownloadX.
+    DownloadID uuid.UUID `json:"downloadid"` // ID of the last download.
+    Updated    time.Time `json:"updated"`    // Last time the file was downloaded.
+}
+
+// mirrorWatcher runs the polling of a mirror
+type mirrorWatcher struct {
+    mirror Mirror        // Protected by the API mirror mutex.
+    stop   chan struct{} // Closed to stop polling and active downloads.
+}
+
+// mirrorTimeout is the timeout to find the mirrored peer
+const mirrorTimeout = 10 * time.Second
+
+var errMirrorNotFound = errors.New("mirror not found")
+
+// Match checks if the file matches the filter.
+func (filter *MirrorFilter) Match(file *ApiFile) bool {
+    if len(filter.Types) > 0 {
+        match := false
+        for _, fileType := range filter.Types {
+            match = match || fileType == int(file.Type)
+        }
+        if !match {
+            return false
+        }
+    }
+
+    if len(filter.Formats) > 0 {
+        match := false
+        for _, fileFormat := range filter.Formats {
+            match = match || fileFormat == file.Format
+        }
+        if !match {
+            return false
+        }
+    }
+
+    if len(filter.Folders) > 0 {
+        folder := CleanFolder(file.Folder)
+        match := false
+        for _, parent := range filter.Folders {
+            parent = CleanFolder(parent)
+            match = match || parent == "" || IsInFolder(folder, parent)
+        }
+        if !match {
+            return false
+        }
+    }
+
+    return true
+}
+
+// mirrorInit loads the mirrors from the state file and starts polling them.
+func (api *WebapiInstance) mirrorInit() {
+    api.mirrors = make(map[uuid.UUID]*mirrorWatcher)
+
+    var mirrors []Mirror
+    api.stateLoad("mirrorInit", MirrorStateFile, &mirrors)
+
+    for _, mirror := range mirrors {
+        api.mirrorStart(mirror)
+    }
+}
+
+// mirrorSave writes all mirrors to the state file. The caller must hold the mirror mutex.
+func (api *WebapiInstance) mirrorSave() {
+    mirrors := []Mirror{}
+    for _, watcher := range api.mirrors {
+        mirrors = append(mirrors, watcher.mirror)
+    }
+
+    api.stateSave("mirrorSave", MirrorStateFile, mirrors)
+}
+
+// mirrorStart adds the mirror and starts polling it. The mirror is checked immediately and then in the interval until stopped.
+func (api *WebapiInstance) mirrorStart(mirror Mirror) {
+    if mirror.Files == nil {
+        mirror.Files = make(map[uuid.UUID]MirroredFile)
+    }
+
+    watcher := &mirrorWatcher{mirror: mirror, stop: make(chan struct{})}
+
+    api.mirrorsMutex.Lock()
+    api.mirrors[mirror.ID] = watcher
+    api.mirrorsMutex.Unlock()
+
+    go poll(watcher.stop, func() time.Duration {
+        api.mirrorCheck(watcher)
+
+        api.mirrorsMutex.RLock()
+        defer api.mirrorsMutex.RUnlock()
+
+        return time.Duration(watcher.mirror.Interval) * time.Second
+    })
+}
+
+// MirrorAdd starts mirroring the files of the peer into the target directory. The interval is the interval to check the peer's blockchain;
+// 0 uses MirrorIntervalDefault. The first check starts immediately in the background.
+func (api *WebapiInstance) MirrorAdd(nodeID []byte, directory string, filter MirrorFilter, interval time.Duration) (mirror Mirror, err error) {
+    if directory, err = filepath.Abs(directory); err != nil {
+        return mirror, err
+    } else if err = os.MkdirAll(directory, os.ModePerm); err != nil {
+        return mirror, err
+    }
+
+    if interval < time.Second {
+        interval = MirrorIntervalDefault
+    }
+
+    mirror = Mirror{ID: uuid.New(), NodeID: nodeID, Path: directory, Interval: int(interval / time.Second), Filter: filter}
+
+    api.mirrorStart(mirror)
+
+    api.mirrorsMutex.Lock()
+    api.mirrorSave()
+    api.mirrorsMutex.Unlock()
+
+    return mirror, nil
+}
+
+// MirrorRemove stops mirroring and cancels active downloads. Already downloaded files are kept.
+func (api *WebapiInstance) MirrorRemove(id uuid.UUID) (err error) {
+    api.mirrorsMutex.Lock()
+    defer api.mirrorsMutex.Unlock()
+
+    watcher, ok := api.mirrors[id]
+    if !ok {
+        return errMirrorNotFound
+    }
+
+    close(watcher.stop)
+    delete(api.mirrors, id)
+    api.mirrorSave()
+
+    return nil
+}
+
+// MirrorList returns all mirrors.
+func (api *WebapiInstance) MirrorList() (mirrors []Mirror) {
+    api.mirrorsMutex.RLock()
+    defer api.mirrorsMutex.RUnlock()
+
+    for _, watcher := range api.mirrors {
+        // The files are copied since they are changed while downloading.
+        mirror := watcher.mirror
+        mirror.Files = make(map[uuid.UUID]MirroredFile, len(watcher.mirror.Files))
+        for id, file := range watcher.mirror.Files {
+            mirror.Files[id] = file
+        }
+
+        mirrors = append(mirrors, mirror)
+    }
+
+    return mirrors
+}
+
+// mirrorCheck reads the blockchain of the peer and downloads new or changed files one by one
+func (api *WebapiInstance) mirrorCheck(watcher *mirrorWatcher) {
+    api.mirrorsMutex.RLock()
+    mirror := watcher.mirror
+    api.mirrorsMutex.RUnlock()
+
+    files, err := api.mirrorReadFiles(mirror.NodeID)
+
+    api.mirrorUpdate(watcher, func(mirror *Mirror) {
+        mirror.LastCheck = time.Now()
+        mirror.LastError = ""
+        if err != nil {
+            mirror.LastError = err.Error()
+        }
+    })
+    if err != nil {
+        return
+    }
+
+    for _, file := range files {
+        if !mirror.Filter.Match(&file) {
+            continue
+        }
+
+        relative := mirrorFilePath(&file)
+        target := filepath.Join(mirror.Path, filepath.FromSlash(relative))
+
+        if file.IsVirtualFolder() {
+            os.MkdirAll(target, os.ModePerm)
+            continue
+        }
+
+        // Skip files that were already mirrored. Changed files have a different hash.
+        api.mirrorsMutex.RLock()
+        state, ok := watcher.mirror.Files[file.ID]
+        api.mirrorsMutex.RUnlock()
+
+        if ok && bytes.Equal(state.Hash, file.Hash) && state.Status == DownloadFinished {
+            continue
+        }
+
+        state = api.mirrorDownload(watcher, mirror.NodeID, &file, target)
+        state.Path = relative
+
+        api.mirrorUpdate(watcher, func(mirror *Mirror) {
+            mirror.Files[file.ID] = state
+        })
+
+        select {
+        case <-watcher.stop:
+            return
+        default:
+        }
+    }
+}
+
+// mirrorUpdate changes the mirror and saves the state, unless the mirror was removed
+func (api *WebapiInstance) mirrorUpdate(watcher *mirrorWatcher, update func(mirror *Mirror)) {
+    api.mirrorsMutex.Lock()
+    defer api.mirrorsMutex.Unlock()
+
+    if api.mirrors[watcher.mirror.ID] != watcher {
+        return
+    }
+
+    update(&watcher.mirror)
+    api.mirrorSave()
+}
+
+// mirrorReadFiles returns all files from the blockchain of the peer
+func (api *WebapiInstance) mirrorReadFiles(nodeID []byte) (files []ApiFile, err error) {
+    peer := api.Backend.NodelistLookup(nodeID)
+    if peer == nil {
+        if _, peer, _ = api.Backend.FindNode(nodeID, mirrorTimeout); peer == nil {
+            return nil, errors.New("peer not found")
+        }
+    }
+
+    for blockN := uint64(0); blockN < peer.BlockchainHeight; blockN++ {
+        blockDecoded, _, found, err := api.Backend.ReadBlock(peer.PublicKey, peer.BlockchainVersion, blockN)
+        if err != nil {
+            return nil, err
+        } else if !found {
+            continue
+        }
+
+        for _, record := range blockDecoded.RecordsDecoded {
+            if file, ok := record.(blockchain.BlockRecordFile); ok {
+                files = append(files, BlockRecordFileToAPI(file))
+            }
+        }
+    }
+
+    return files, nil
+}
+
+// mirrorDownload downloads the file into a temporary file and replaces the target once finished.
+// It waits until the download is finished, canceled, or the mirror is stopped.
+func (api *WebapiInstance) mirrorDownload(watcher *mirrorWatcher, nodeID []byte, file *ApiFile, target string) (state MirroredFile) {
+    state = MirroredFile{Hash: file.Hash, Status: DownloadCanceled}
+
+    if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+        api.Backend.LogError("mirrorDownload", "creating directory for '%s': %v", target, err)
+        return state
+    }
+
+    temp := target + ".download"
+
+    // A download into the temporary file may already be running, for example restored from the journal after a restart.
+    info := api.downloadFind(file.Hash, temp)
+    if info == nil {
+        os.Remove(temp)
+
+        var err error
+        if info, err = api.DownloadStart(file.Hash, nodeID, temp); err != nil {
+            api.Backend.LogError("mirrorDownload", "creating file '%s': %v", temp, err)
+            return state
+        }
+    }
+    state.DownloadID = info.ID
+
+    events, unsubscribe := info.Subscribe()
+    defer unsubscribe()
+
+    for {
+        select {
+        case event, ok := <-events:
+            if !ok {
+                info.RLock()
+                state.Status = info.Status
+                info.RUnlock()
+
+                if state.Status == DownloadFinished {
+                    if err := os.Rename(temp, target); err != nil {
+                        api.Backend.LogError("mirrorDownload", "replacing file '%s': %v", target, err)
+                        state.Status = DownloadCanceled
+                    }
+                    state.Updated = time.Now()
+                }
+                if state.Status != DownloadFinished {
+                    os.Remove(temp)
+                }
+                return state
+            }
+            state.Status = event.Status
+
+        case <-watcher.stop:
+            info.Cancel()
+            os.Remove(temp)
+            state.Status = DownloadCanceled
+            return state
+        }
+    }
+}
+
+// mirrorFilePath returns the relative path of the file in the target directory. Names received from the peer cannot escape the target directory.
+func mirrorFilePath(file *ApiFile) string {
+    name := strings.NewReplacer("/", "_", "\\", "_").Replace(file.Name)
+    if name == "" || name == "." || name == ".." {
+        name = hex.EncodeToString(file.Hash)
+    }
+
+    return strings.TrimPrefix(path.Join(CleanFolder(file.Folder), name), "/")
+}
+
+/*
+apiMirrorList returns all mirrors. A mirror replicates the files shared by a remote peer into a local directory.
+
+Request:    GET /mirror/list
+Result:     200 with JSON array of Mirror
+*/
+func (api *WebapiInstance) apiMirrorList(w http.ResponseWriter, r *http.Request) {
+    mirrors := api.MirrorList()
+    if mirrors == nil {
+        mirrors = []Mirror{}
+    }
+
+    EncodeJSON(api.Backend, w, r, mirrors)
+}
+
+/*
+apiMirrorAdd starts mirroring the files of the peer into the target directory, keeping the virtual folder structure.
+The filter parameters type, format and folder are optional and may be repeated. The interval is in seconds (optional).
+Warning: Any local directory can be supplied. No input path verification or limitation is done.
+
+Request:    GET /mirror/add?node=[node ID]&path=[target directory]&interval=[seconds]
+            Optional filter &type=[file type]&format=[file format]&folder=[virtual folder]
+Result:     200 with JSON structure Mirror
+            400 on invalid input or if the target directory cannot be created
+*/
+func (api *WebapiInstance) apiMirrorAdd(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    nodeID, valid := DecodeBlake3Hash(r.Form.Get("node"))
+    directory := r.Form.Get("path")
+    interval, _ := strconv.Atoi(r.Form.Get("interval"))
+    if !valid || directory == "" {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    var filter MirrorFilter
+    for _, text := range r.Form["type"] {
+        fileType, err := strconv.Atoi(text)
+        if err != nil || fileType < 0 || fileType > 255 {
+            http.Error(w, "", http.StatusBadRequest)
+            return
+        }
+        filter.Types = append(filter.Types, fileType)
+    }
+    for _, text := range r.Form["format"] {
+        fileFormat, err := strconv.Atoi(text)
+        if err != nil || fileFormat < 0 || fileFormat > 65535 {
+            http.Error(w, "", http.StatusBadRequest)
+            return
+        }
+        filter.Formats = append(filter.Formats, uint16(fileFormat))
+    }
+    filter.Folders = r.Form["folder"]
+
+    mirror, err := api.MirrorAdd(nodeID, directory, filter, time.Duration(interval)*time.Second)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    EncodeJSON(api.Backend, w, r, mirror)
+}
+
+/*
+apiMirrorRemove stops mirroring and cancels active downloads. Already downloaded files are kept.
+
+Request:    GET /mirror/remove?ID=[mirror ID]
+Result:     204 on success
+            404 if the mirror was not found
+*/
+func (api *WebapiInstance) apiMirrorRemove(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    id, err := uuid.Parse(r.Form.Get("ID"))
+    if err != nil {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    if err := api.MirrorRemove(id); err != nil {
+        http.Error(w, "", http.StatusNotFound)
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,98 @@
+/*
+File Name:  Mirror_test.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi_test
+
+import (
+    "bytes"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/Abstraction/webapitest"
+    "github.com/google/uuid"
+)
+
+// TestMirrorJournalRestore checks that the mirror continues the download restored from the journal instead of starting a second one into the same file.
+func TestMirrorJournalRestore(t *testing.T) {
+    backend := webapitest.NewBackend()
+    backend.Data = t.TempDir()
+    directory := t.TempDir()
+
+    data := []byte("mirrored file data")
+    file := backend.AddPeer().AddFile(webapi.ApiFile{Name: "a.txt", Folder: "docs"}, data)
+    target := filepath.Join(directory, "docs", "a.txt")
+    os.MkdirAll(filepath.Dir(target), os.ModePerm)
+
+    // The download into the temporary file of the mirror was paused before the restart.
+    entry := webapi.DownloadJournalEntry{ID: uuid.New(), Hash: file.Hash, NodeID: file.NodeID, Path: target + ".download", Status: webapi.DownloadPause, Created: time.Now(), File: file}
+    journal, _ := json.Marshal([]webapi.DownloadJournalEntry{entry})
+    if err := os.WriteFile(filepath.Join(backend.Data, webapi.DownloadJournalFile), journal, 0666); err != nil {
+        t.Fatal(err)
+    }
+
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+
+    restored := api.DownloadLookup(entry.ID)
+    if restored == nil {
+        t.Fatal("download not restored from the journal")
+    }
+
+    mirror, err := api.MirrorAdd(file.NodeID, directory, webapi.MirrorFilter{}, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer api.MirrorRemove(mirror.ID)
+
+    // wait until the mirror checked the peer and picked up the download
+    for start := time.Now(); api.MirrorList()[0].LastCheck.IsZero(); time.Sleep(10 * time.Millisecond) {
+        if time.Since(start) > 10*time.Second {
+            t.Fatal("mirror not checked")
+        }
+    }
+    time.Sleep(50 * time.Millisecond)
+
+    if list := api.DownloadList(nil, 0, 0); list.Total != 1 {
+        t.Fatalf("%d downloads, expected the restored one only", list.Total)
+    }
+
+    restored.Resume()
+
+    for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+        if state, ok := api.MirrorList()[0].Files[file.ID]; ok {
+            if state.Status != webapi.DownloadFinished || state.DownloadID != entry.ID {
+                t.Fatalf("mirrored file %+v, expected finished download %s", state, entry.ID)
+            }
+            break
+        } else if time.Since(start) > 10*time.Second {
+            t.Fatal("file not mirrored")
+        }
+    }
+
+    if stored, err := os.ReadFile(target); err != nil || !bytes.Equal(stored, data) {
+        t.Fatalf("stored data %q does not match: %v", stored, err)
+    }
+
+    waitJournal(t, backend.Data, 0)
+}
+
+// waitJournal waits until the journal file in the data folder contains the count of downloads. It is written after the status change is published.
+func waitJournal(t *testing.T, data string, count int) (entries []webapi.DownloadJournalEntry) {
+    t.Helper()
+
+    for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+        entries = nil
+        if raw, err := os.ReadFile(filepath.Join(data, webapi.DownloadJournalFile)); err == nil && json.Unmarshal(raw, &entries) == nil && len(entries) == count {
+            return entries
+        } else if time.Since(start) > 10*time.Second {
+            t.Fatalf("journal contains %d downloads, expected %d", len(entries), count)
+        }
+    }
+}
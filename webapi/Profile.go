@@ -13,15 +13,15 @@ import (
     "github.com/PeernetOfficial/core/blockchain"
 )
 
-// apiProfileData contains profile metadata stored on the blockchain. Any data is treated as untrusted and unverified by default.
-type apiProfileData struct {
-    Fields []apiBlockRecordProfile `json:"fields"` // All fields
+// ApiProfileData contains profile metadata stored on the blockchain. Any data is treated as untrusted and unverified by default.
+type ApiProfileData struct {
+    Fields []ApiBlockRecordProfile `json:"fields"` // All fields
     Status int                     `json:"Status"` // Status of the operation, only used when this structure is returned from the API. See blockchain.StatusX.
 }
 
-// apiBlockRecordProfile provides information about the end user. Note that all profile data is arbitrary and shall be considered untrusted and unverified.
+// ApiBlockRecordProfile provides information about the end user. Note that all profile data is arbitrary and shall be considered untrusted and unverified.
 // To establish trust, the user must load Certificates into the blockchain that validate certain data.
-type apiBlockRecordProfile struct {
+type ApiBlockRecordProfile struct {
     Type uint16 `json:"type"` // See ProfileX constants.
     // Depending on the exact type, one of the below fields is used for proper encoding:
     Text string `json:"text"` // Text value. UTF-8 encoding.
@@ -32,14 +32,14 @@ type apiBlockRecordProfile struct {
 apiProfileList lists all users profile fields.
 
 Request:    GET /profile/list
-Response:   200 with JSON structure apiProfileData
+Response:   200 with JSON structure ApiProfileData
 */
 func (api *WebapiInstance) apiProfileList(w http.ResponseWriter, r *http.Request) {
-    fields, status := api.Backend.UserBlockchain.ProfileList()
+    fields, status := api.Backend.UserBlockchain().ProfileList()
 
-    result := apiProfileData{Status: status}
+    result := ApiProfileData{Status: status}
     for n := range fields {
-        result.Fields = append(result.Fields, blockRecordProfileToAPI(fields[n]))
+        result.Fields = append(result.Fields, BlockRecordProfileToAPI(fields[n]))
     }
 
     EncodeJSON(api.Backend, w, r, result)
@@ -49,7 +49,7 @@ func (api *WebapiInstance) apiProfileList(w http.ResponseWriter, r *http.Request
 apiProfileRead reads a specific users profile field. See core.ProfileX for recognized fields.
 
 Request:    GET /profile/read?field=[index]
-Response:   200 with JSON structure apiProfileData
+Response:   200 with JSON structure ApiProfileData
 */
 func (api *WebapiInstance) apiProfileRead(w http.ResponseWriter, r *http.Request) {
     r.ParseForm()
@@ -60,11 +60,11 @@ func (api *WebapiInstance) apiProfileRead(w http.ResponseWriter, r *http.Request
         return
     }
 
-    var result apiProfileData
+    var result ApiProfileData
 
     var data []byte
-    if data, result.Status = api.Backend.UserBlockchain.ProfileReadField(uint16(fieldN)); result.Status == blockchain.StatusOK {
-        result.Fields = append(result.Fields, blockRecordProfileToAPI(blockchain.BlockRecordProfile{Type: uint16(fieldN), Data: data}))
+    if data, result.Status = api.Backend.UserBlockchain().ProfileReadField(uint16(fieldN)); result.Status == blockchain.StatusOK {
+        result.Fields = append(result.Fields, BlockRecordProfileToAPI(blockchain.BlockRecordProfile{Type: uint16(fieldN), Data: data}))
     }
 
     EncodeJSON(api.Backend, w, r, result)
@@ -73,11 +73,11 @@ func (api *WebapiInstance) apiProfileRead(w http.ResponseWriter, r *http.Request
 /*
 apiProfileWrite writes profile fields. See core.ProfileX for recognized fields.
 
-Request:    POST /profile/write with JSON structure apiProfileData
-Response:   200 with JSON structure apiBlockchainBlockStatus
+Request:    POST /profile/write with JSON structure ApiProfileData
+Response:   200 with JSON structure ApiBlockchainBlockStatus
 */
 func (api *WebapiInstance) apiProfileWrite(w http.ResponseWriter, r *http.Request) {
-    var input apiProfileData
+    var input ApiProfileData
     if err := DecodeJSON(w, r, &input); err != nil {
         return
     }
@@ -85,22 +85,22 @@ func (api *WebapiInstance) apiProfileWrite(w http.ResponseWriter, r *http.Reques
     var fields []blockchain.BlockRecordProfile
 
     for n := range input.Fields {
-        fields = append(fields, blockRecordProfileFromAPI(input.Fields[n]))
+        fields = append(fields, BlockRecordProfileFromAPI(input.Fields[n]))
     }
 
-    newHeight, newVersion, status := api.Backend.UserBlockchain.ProfileWrite(fields)
+    newHeight, newVersion, status := api.Backend.UserBlockchain().ProfileWrite(fields)
 
-    EncodeJSON(api.Backend, w, r, apiBlockchainBlockStatus{Status: status, Height: newHeight, Version: newVersion})
+    EncodeJSON(api.Backend, w, r, ApiBlockchainBlockStatus{Status: status, Height: newHeight, Version: newVersion})
 }
 
 /*
 apiProfileDelete deletes profile fields identified by the types. See core.ProfileX for recognized fields.
 
-Request:    POST /profile/delete with JSON structure apiProfileData
-Response:   200 with JSON structure apiBlockchainBlockStatus
+Request:    POST /profile/delete with JSON structure ApiProfileData
+Response:   200 with JSON structure ApiBlockchainBlockStatus
 */
 func (api *WebapiInstance) apiProfileDelete(w http.ResponseWriter, r *http.Request) {
-    var input apiProfileData
+    var input ApiProfileData
     if err := DecodeJSON(w, r, &input); err != nil {
         return
     }
@@ -111,14 +111,14 @@ func (api *WebapiInstance) apiProfileDelete(w http.ResponseWriter, r *http.Reque
         fields = append(fields, input.Fields[n].Type)
     }
 
-    newHeight, newVersion, status := api.Backend.UserBlockchain.ProfileDelete(fields)
+    newHeight, newVersion, status := api.Backend.UserBlockchain().ProfileDelete(fields)
 
-    EncodeJSON(api.Backend, w, r, apiBlockchainBlockStatus{Status: status, Height: newHeight, Version: newVersion})
+    EncodeJSON(api.Backend, w, r, ApiBlockchainBlockStatus{Status: status, Height: newHeight, Version: newVersion})
 }
 
 // --- conversion from core to API data ---
 
-func blockRecordProfileToAPI(input blockchain.BlockRecordProfile) (output apiBlockRecordProfile) {
+func BlockRecordProfileToAPI(input blockchain.BlockRecordProfile) (output ApiBlockRecordProfile) {
     output.Type = input.Type
 
     switch input.Type {
@@ -135,7 +135,7 @@ func blockRecordProfileToAPI(input blockchain.BlockRecordProfile) (output apiBlo
     return output
 }
 
-func blockRecordProfileFromAPI(input apiBlockRecordProfile) (output blockchain.BlockRecordProfile) {
+func BlockRecordProfileFromAPI(input ApiBlockRecordProfile) (output blockchain.BlockRecordProfile) {
     output.Type = input.Type
 
     switch input.Type {
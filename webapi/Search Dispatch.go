@@ -32,12 +32,13 @@ func (api *WebapiInstance) DispatchSearch(input SearchRequest) (job *SearchJob)
 }
 
 func (job *SearchJob) localSearch(api *WebapiInstance, term string) {
-    if api.Backend.SearchIndex == nil {
+    searchIndex := api.Backend.SearchIndex()
+    if searchIndex == nil {
         job.Status = SearchStatusNoIndex
         return
     }
 
-    results := api.Backend.SearchIndex.Search(term)
+    results := searchIndex.Search(term)
 
     job.ResultSync.Lock()
 
@@ -68,7 +69,7 @@ resultLoop:
         }
 
         // new result
-        newFile := blockRecordFileToAPI(file)
+        newFile := BlockRecordFileToAPI(file)
 
         job.Files = append(job.Files, &newFile)
         job.AllFiles = append(job.AllFiles, &newFile)
@@ -371,7 +371,7 @@ func (api *WebapiInstance) apiExplore(w http.ResponseWriter, r *http.Request) {
 
     // loop over results
     for n := range resultFiles {
-        result.Files = append(result.Files, blockRecordFileToAPI(resultFiles[n]))
+        result.Files = append(result.Files, BlockRecordFileToAPI(resultFiles[n]))
     }
 
     if len(result.Files) == 0 {
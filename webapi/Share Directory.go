@@ -0,0 +1,163 @@
+/*
+File Name:  Share Directory.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapi
+
+import (
+    "io/fs"
+    "net/http"
+    "path"
+    "path/filepath"
+    "time"
+
+    "github.com/PeernetOfficial/core"
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/PeernetOfficial/core/warehouse"
+    "github.com/google/uuid"
+)
+
+// ShareDirectoryFile is the result of sharing a single file or folder of a directory.
+type ShareDirectoryFile struct {
+    Path   string  `json:"path"`   // Local path of the file or folder.
+    File   ApiFile `json:"file"`   // File record as published. Only valid if Status is warehouse.StatusOK.
+    Status int     `json:"Status"` // Status of importing the file into the warehouse. See warehouse.StatusX.
+    Error  string  `json:"error"`  // Error message, if any.
+}
+
+// ShareDirectoryResult is the result of sharing a directory.
+type ShareDirectoryResult struct {
+    Status  int                  `json:"Status"`  // Status of adding the files to the blockchain. See blockchain.StatusX.
+    Height  uint64               `json:"height"`  // Height of the blockchain (number of blocks).
+    Version uint64               `json:"version"` // Version of the blockchain.
+    Files   []ShareDirectoryFile `json:"files"`   // Result for each file and folder.
+}
+
+// ShareDirectory imports all files of the directory (including sub-directories) into the warehouse and publishes them on the blockchain
+// together with matching virtual folder records in a single AddFiles call. Files that cannot be imported are reported and skipped.
+// The virtual folder is the base folder of the records. If empty, the name of the local directory is used. The local path itself is never published.
+// The optional progress callback is called after each file or folder is processed.
+// An error is only returned if the directory itself cannot be read.
+func (api *WebapiInstance) ShareDirectory(directory, virtualFolder string, progress func(done, total int, path string)) (result ShareDirectoryResult, err error) {
+    // collect all entries first to know the total count for progress reporting
+    type dirEntry struct {
+        path   string // local path
+        folder string // virtual folder
+        name   string // name
+        isDir  bool
+    }
+    var entries []dirEntry
+
+    if virtualFolder == "" {
+        virtualFolder = filepath.Base(filepath.Clean(directory))
+    }
+    virtualFolder = path.Clean("/" + filepath.ToSlash(virtualFolder))[1:]
+
+    err = filepath.WalkDir(directory, func(entryPath string, d fs.DirEntry, err error) error {
+        if err != nil {
+            if entryPath == directory {
+                return err
+            }
+            result.Files = append(result.Files, ShareDirectoryFile{Path: entryPath, Status: warehouse.StatusErrorOpenFile, Error: err.Error()})
+            return nil
+        }
+
+        relative, _ := filepath.Rel(directory, entryPath)
+        folder, name := path.Split(path.Join(virtualFolder, filepath.ToSlash(relative)))
+        folder = path.Clean("/" + folder)[1:]
+
+        if d.IsDir() && name == "." {
+            // The directory itself is shared without base folder.
+        } else if d.IsDir() {
+            entries = append(entries, dirEntry{path: entryPath, folder: folder, name: name, isDir: true})
+        } else if d.Type().IsRegular() {
+            entries = append(entries, dirEntry{path: entryPath, folder: folder, name: name})
+        }
+
+        return nil
+    })
+    if err != nil {
+        return result, err
+    }
+
+    var filesAdd []blockchain.BlockRecordFile
+
+    for n, entry := range entries {
+        shared := ShareDirectoryFile{Path: entry.path}
+        shared.File = ApiFile{ID: uuid.New(), Folder: entry.folder, Name: entry.name, Date: time.Now(), NodeID: api.Backend.SelfNodeID()}
+
+        if entry.isDir {
+            shared.File.Type = core.TypeFolder
+            shared.File.Format = core.FormatFolder
+            shared.File.Hash = protocol.HashData(nil)
+        } else {
+            shared.File.Hash, shared.Status, err = api.Backend.UserWarehouse().CreateFileFromPath(entry.path)
+            if err == nil && shared.Status == warehouse.StatusOK {
+                _, shared.File.Size, shared.Status, err = api.Backend.UserWarehouse().FileExists(shared.File.Hash)
+            }
+            if err != nil || shared.Status != warehouse.StatusOK {
+                if err != nil {
+                    shared.Error = err.Error()
+                }
+                api.Backend.LogError("ShareDirectory", "Status %d importing '%s' error: %v", shared.Status, entry.path, err)
+            } else {
+                fileType, fileFormat, _ := FileDetectType(entry.path)
+                shared.File.Type = uint8(fileType)
+                shared.File.Format = fileFormat
+            }
+        }
+
+        if shared.Status == warehouse.StatusOK {
+            blockRecord := BlockRecordFileFromAPI(shared.File)
+
+            // Set the merkle tree info as appropriate.
+            if SetFileMerkleInfo(api.Backend, &blockRecord) {
+                filesAdd = append(filesAdd, blockRecord)
+            } else {
+                shared.Status = warehouse.StatusFileNotFound
+                shared.Error = "merkle information not available"
+            }
+        }
+
+        result.Files = append(result.Files, shared)
+
+        if progress != nil {
+            progress(n+1, len(entries), entry.path)
+        }
+    }
+
+    result.Height, result.Version, result.Status = api.Backend.UserBlockchain().AddFiles(filesAdd)
+
+    return result, nil
+}
+
+/*
+apiWarehouseCreateDirectory shares an entire directory. It imports all files (including sub-directories) into the warehouse
+and publishes them together with matching virtual folders on the blockchain in one go.
+The folder parameter sets the virtual base folder on the blockchain. If not set, the name of the local directory is used.
+Files that cannot be imported are reported in the result and skipped.
+Warning: Same as /warehouse/create/path, any local directory can be supplied. No input path verification or limitation is done.
+
+Request:    GET /warehouse/create/dir?path=[directory on disk]&folder=[virtual folder]
+Response:   200 with JSON structure ShareDirectoryResult
+            400 if the directory cannot be read
+*/
+func (api *WebapiInstance) apiWarehouseCreateDirectory(w http.ResponseWriter, r *http.Request) {
+    r.ParseForm()
+    directory := r.Form.Get("path")
+    if directory == "" {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    result, err := api.ShareDirectory(directory, r.Form.Get("folder"), nil)
+    if err != nil {
+        http.Error(w, "", http.StatusBadRequest)
+        return
+    }
+
+    EncodeJSON(api.Backend, w, r, result)
+}
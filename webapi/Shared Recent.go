@@ -13,7 +13,7 @@ import (
 )
 
 // queryRecentShared returns recently shared files on the network from random peers until the limit is reached.
-func (api *WebapiInstance) queryRecentShared(backend *core.Backend, fileType int, limitPeer, offsetTotal, limitTotal uint64) (files []blockchain.BlockRecordFile) {
+func (api *WebapiInstance) queryRecentShared(backend Backend, fileType int, limitPeer, offsetTotal, limitTotal uint64) (files []blockchain.BlockRecordFile) {
     if limitPeer == 0 {
         limitPeer = 1
     }
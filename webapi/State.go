@@ -0,0 +1,103 @@
+/*
+File Name:  State.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+
+State files in the data folder and polling used by the subsystems that persist their state (downloads, sync, mirrors, bandwidth limits).
+If the backend has no data folder, state is not persisted.
+*/
+
+package webapi
+
+import (
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+// stateFilename returns the full path of the state file. Empty if state is not persisted.
+func (api *WebapiInstance) stateFilename(name string) string {
+    if folder := api.Backend.DataFolder(); folder != "" {
+        return filepath.Join(folder, name)
+    }
+
+    return ""
+}
+
+// stateLoad decodes the state file into data. It returns false if the file does not exist or cannot be decoded. Errors are logged for the function.
+func (api *WebapiInstance) stateLoad(function, name string, data interface{}) (loaded bool) {
+    filename := api.stateFilename(name)
+    if filename == "" {
+        return false
+    }
+
+    raw, err := os.ReadFile(filename)
+    if err != nil {
+        if !os.IsNotExist(err) {
+            api.Backend.LogError(function, "reading state file '%s': %v", filename, err)
+        }
+        return false
+    }
+
+    if err := json.Unmarshal(raw, data); err != nil {
+        api.Backend.LogError(function, "decoding state file '%s': %v", filename, err)
+        return false
+    }
+
+    return true
+}
+
+// stateSave writes the data to the state file. Errors are logged for the function.
+// The data is written to a temporary file first which then replaces the state file, so a crash cannot leave a partially written state file.
+func (api *WebapiInstance) stateSave(function, name string, data interface{}) {
+    filename := api.stateFilename(name)
+    if filename == "" {
+        return
+    }
+
+    raw, err := json.MarshalIndent(data, "", "    ")
+    if err == nil {
+        err = writeFileReplace(filename, raw)
+    }
+    if err != nil {
+        api.Backend.LogError(function, "writing state file '%s': %v", filename, err)
+    }
+}
+
+// writeFileReplace writes the data to a temporary file in the same folder and renames it to the filename, replacing any existing file.
+func writeFileReplace(filename string, data []byte) (err error) {
+    file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+    if err != nil {
+        return err
+    }
+
+    _, err = file.Write(data)
+    if err == nil {
+        err = file.Sync()
+    }
+    if errClose := file.Close(); err == nil {
+        err = errClose
+    }
+    if err == nil {
+        err = os.Rename(file.Name(), filename)
+    }
+    if err != nil {
+        os.Remove(file.Name())
+    }
+
+    return err
+}
+
+// poll calls the function immediately and then repeatedly until stopped. The function returns the interval to wait before the next call.
+func poll(stop <-chan struct{}, run func() (interval time.Duration)) {
+    for {
+        interval := run()
+
+        select {
+        case <-stop:
+            return
+        case <-time.After(interval):
+        }
+    }
+}
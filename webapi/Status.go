@@ -18,7 +18,7 @@ func apiTest(w http.ResponseWriter, r *http.Request) {
     w.Write([]byte("ok"))
 }
 
-type apiResponseStatus struct {
+type ApiResponseStatus struct {
     Status        int  `json:"Status"`        // Status code: 0 = Ok.
     IsConnected   bool `json:"isconnected"`   // Whether connected to Peernet.
     CountPeerList int  `json:"countpeerlist"` // Count of peers in the Peer list. Note that this contains peers that are considered inactive, but have not yet been removed from the list.
@@ -33,7 +33,7 @@ Request:    GET /Status
 Result:     200 with JSON structure Status
 */
 func (api *WebapiInstance) apiStatus(w http.ResponseWriter, r *http.Request) {
-    status := apiResponseStatus{Status: 0, CountPeerList: api.Backend.PeerlistCount()}
+    status := ApiResponseStatus{Status: 0, CountPeerList: api.Backend.PeerlistCount()}
     status.CountNetwork = status.CountPeerList // For now always same as CountPeerList, until native Statistics message to root peers is available.
 
     // Connected: If at leat 2 peers.
@@ -44,7 +44,7 @@ func (api *WebapiInstance) apiStatus(w http.ResponseWriter, r *http.Request) {
     EncodeJSON(api.Backend, w, r, status)
 }
 
-type apiResponsePeerSelf struct {
+type ApiResponsePeerSelf struct {
     PeerID string `json:"peerid"` // Peer ID. This is derived from the public in compressed form.
     NodeID string `json:"nodeid"` // Node ID. This is the blake3 Hash of the Peer ID and used in the DHT.
 }
@@ -52,10 +52,10 @@ type apiResponsePeerSelf struct {
 /*
 apiAccountInfo provides information about the current account.
 Request:    GET /account/info
-Result:     200 with JSON structure apiResponsePeerSelf
+Result:     200 with JSON structure ApiResponsePeerSelf
 */
 func (api *WebapiInstance) apiAccountInfo(w http.ResponseWriter, r *http.Request) {
-    response := apiResponsePeerSelf{}
+    response := ApiResponsePeerSelf{}
     response.NodeID = hex.EncodeToString(api.Backend.SelfNodeID())
 
     _, publicKey := api.Backend.ExportPrivateKey()
@@ -89,14 +89,14 @@ The GeoIP information may not alawys be available, for example if the GeoIP File
 Peers that are connected only via local network will not have a geo location.
 
 Request:    GET /Status/peers
-Result:     200 with JSON array apiResponsePeerInfo
+Result:     200 with JSON array ApiResponsePeerInfo
 */
 func (api *WebapiInstance) apiStatusPeers(w http.ResponseWriter, r *http.Request) {
-    var peers []apiResponsePeerInfo
+    var peers []ApiResponsePeerInfo
 
     // query all nodes
     for _, peer := range api.Backend.PeerlistGet() {
-        peerInfo := apiResponsePeerInfo{
+        peerInfo := ApiResponsePeerInfo{
             PeerID:            peer.PublicKey.SerializeCompressed(),
             NodeID:            peer.NodeID,
             UserAgent:         peer.UserAgent,
@@ -115,7 +115,7 @@ func (api *WebapiInstance) apiStatusPeers(w http.ResponseWriter, r *http.Request
     EncodeJSON(api.Backend, w, r, peers)
 }
 
-type apiResponsePeerInfo struct {
+type ApiResponsePeerInfo struct {
     PeerID            []byte `json:"peerid"`            // Peer ID. This is derived from the public in compressed form.
     NodeID            []byte `json:"nodeid"`            // Node ID. This is the blake3 Hash of the Peer ID and used in the DHT.
     GeoIP             string `json:"geoip"`             // GeoIP location as "Latitude,Longitude" CSV format. Empty if location not available.
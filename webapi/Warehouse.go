@@ -26,7 +26,7 @@ Request:    POST /warehouse/create with raw data to create as new File
 Response:   200 with JSON structure WarehouseResult
 */
 func (api *WebapiInstance) apiWarehouseCreateFile(w http.ResponseWriter, r *http.Request) {
-    hash, status, err := api.Backend.UserWarehouse.CreateFile(r.Body, 0)
+    hash, status, err := api.Backend.UserWarehouse().CreateFile(r.Body, 0)
 
     if err != nil {
         api.Backend.LogError("warehouse.CreateFile", "Status %d error: %v", status, err)
@@ -51,7 +51,7 @@ func (api *WebapiInstance) apiWarehouseCreateFilePath(w http.ResponseWriter, r *
         return
     }
 
-    hash, status, err := api.Backend.UserWarehouse.CreateFileFromPath(filePath)
+    hash, status, err := api.Backend.UserWarehouse().CreateFileFromPath(filePath)
 
     if err != nil {
         api.Backend.LogError("warehouse.CreateFile", "Status %d error: %v", status, err)
@@ -80,7 +80,7 @@ func (api *WebapiInstance) apiWarehouseReadFile(w http.ResponseWriter, r *http.R
     offset, _ := strconv.Atoi(r.Form.Get("offset"))
     limit, _ := strconv.Atoi(r.Form.Get("limit"))
 
-    status, bytesRead, err := api.Backend.UserWarehouse.ReadFile(hash, int64(offset), int64(limit), w)
+    status, bytesRead, err := api.Backend.UserWarehouse().ReadFile(hash, int64(offset), int64(limit), api.streamWriter(w, r))
 
     switch status {
     case warehouse.StatusFileNotFound:
@@ -112,7 +112,7 @@ func (api *WebapiInstance) apiWarehouseDeleteFile(w http.ResponseWriter, r *http
         return
     }
 
-    status, err := api.Backend.UserWarehouse.DeleteFile(hash)
+    status, err := api.Backend.UserWarehouse().DeleteFile(hash)
 
     if err != nil {
         api.Backend.LogError("warehouse.DeleteFile", "Status %d error: %v", status, err)
@@ -141,7 +141,7 @@ func (api *WebapiInstance) apiWarehouseReadFilePath(w http.ResponseWriter, r *ht
     offset, _ := strconv.Atoi(r.Form.Get("offset"))
     limit, _ := strconv.Atoi(r.Form.Get("limit"))
 
-    status, bytesRead, err := api.Backend.UserWarehouse.ReadFileToDisk(hash, int64(offset), int64(limit), targetFile)
+    status, bytesRead, err := api.Backend.UserWarehouse().ReadFileToDisk(hash, int64(offset), int64(limit), targetFile)
 
     if err != nil {
         api.Backend.LogError("warehouse.ReadFileToDisk", "Status %d read %d error: %v", status, bytesRead, err)
@@ -0,0 +1,318 @@
+/*
+File Name:  Backend.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+/*
+Package webapitest provides an in-memory implementation of webapi.Backend to exercise the API handlers without network.
+The user's warehouse and blockchain are kept in memory. Remote peers are scripted and serve file data from memory.
+
+    backend := webapitest.NewBackend()
+    peer := backend.AddPeer()
+    file := peer.AddFile(webapi.ApiFile{Name: "test.txt"}, []byte("test"))
+
+    api, server := webapitest.NewServer(backend, uuid.Nil)
+    defer server.Close()
+*/
+package webapitest
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/core"
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/btcec"
+    "github.com/PeernetOfficial/core/dht"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/PeernetOfficial/core/search"
+    "github.com/google/uuid"
+)
+
+// Backend is an in-memory implementation of webapi.Backend.
+type Backend struct {
+    Warehouse  *Warehouse  // Warehouse of the user.
+    Blockchain *Blockchain // Blockchain of the user.
+    NoIndex    bool        // If set, no search index is available.
+    Data       string      // Data folder returned by DataFolder. If empty, state files are not persisted.
+
+    privateKey *btcec.PrivateKey
+    peers      []*Peer
+    logs       []string
+    sync.RWMutex
+}
+
+var _ webapi.Backend = (*Backend)(nil)
+
+// NewBackend creates a new in-memory backend with a random user key and no peers.
+func NewBackend() *Backend {
+    privateKey, err := btcec.NewPrivateKey(btcec.S256())
+    if err != nil {
+        panic(err)
+    }
+
+    return &Backend{
+        Warehouse:  NewWarehouse(),
+        Blockchain: NewBlockchain(privateKey.PubKey()),
+        privateKey: privateKey,
+    }
+}
+
+// NewServer creates the API for the backend and serves it via a local HTTP test server. The caller must close the server.
+func NewServer(backend webapi.Backend, APIKey uuid.UUID) (api *webapi.WebapiInstance, server *httptest.Server) {
+    api = webapi.New(backend, APIKey)
+
+    return api, httptest.NewServer(api.Router)
+}
+
+// AddPeer adds a new scripted peer to the peer list.
+func (backend *Backend) AddPeer() *Peer {
+    peer := newPeer()
+
+    backend.Lock()
+    backend.peers = append(backend.peers, peer)
+    backend.Unlock()
+
+    return peer
+}
+
+// Logs returns all messages logged via LogError.
+func (backend *Backend) Logs() []string {
+    backend.RLock()
+    defer backend.RUnlock()
+
+    return append([]string{}, backend.logs...)
+}
+
+// UserWarehouse returns the warehouse of the user.
+func (backend *Backend) UserWarehouse() webapi.Warehouse {
+    return backend.Warehouse
+}
+
+// UserBlockchain returns the blockchain of the user.
+func (backend *Backend) UserBlockchain() webapi.Blockchain {
+    return backend.Blockchain
+}
+
+// SearchIndex returns an index of the files of all peers. The term is matched case-insensitive against the file name.
+func (backend *Backend) SearchIndex() webapi.SearchIndex {
+    if backend.NoIndex {
+        return nil
+    }
+
+    return &searchIndex{backend: backend}
+}
+
+// DataFolder returns the data folder. See the field Data.
+func (backend *Backend) DataFolder() string {
+    return backend.Data
+}
+
+// LogError stores the message. See Logs.
+func (backend *Backend) LogError(function, format string, v ...interface{}) {
+    backend.Lock()
+    defer backend.Unlock()
+
+    backend.logs = append(backend.logs, function+": "+fmt.Sprintf(format, v...))
+}
+
+// SelfNodeID returns the node ID of the user.
+func (backend *Backend) SelfNodeID() []byte {
+    return protocol.PublicKey2NodeID(backend.privateKey.PubKey())
+}
+
+// ExportPrivateKey returns the key of the user.
+func (backend *Backend) ExportPrivateKey() (privateKey *btcec.PrivateKey, publicKey *btcec.PublicKey) {
+    return backend.privateKey, backend.privateKey.PubKey()
+}
+
+// DeleteAccount deletes the warehouse and blockchain of the user.
+func (backend *Backend) DeleteAccount() {
+    backend.Warehouse = NewWarehouse()
+    backend.Blockchain = NewBlockchain(backend.privateKey.PubKey())
+}
+
+// FindNode returns the peer with the node ID, unless it is unreachable.
+func (backend *Backend) FindNode(nodeID []byte, Timeout time.Duration) (node *dht.Node, peer *core.PeerInfo, err error) {
+    if fake := backend.lookupNode(nodeID); fake != nil && !fake.Unreachable {
+        return nil, fake.Info, nil
+    }
+
+    return nil, nil, errors.New("node not found")
+}
+
+// PeerlistGet returns all peers.
+func (backend *Backend) PeerlistGet() (peers []*core.PeerInfo) {
+    backend.RLock()
+    defer backend.RUnlock()
+
+    for _, peer := range backend.peers {
+        peers = append(peers, peer.Info)
+    }
+
+    return peers
+}
+
+// PeerlistLookup returns the peer with the public key.
+func (backend *Backend) PeerlistLookup(publicKey *btcec.PublicKey) (peer *core.PeerInfo) {
+    if fake := backend.lookupPublicKey(publicKey); fake != nil {
+        return fake.Info
+    }
+
+    return nil
+}
+
+// NodelistLookup returns the peer with the node ID.
+func (backend *Backend) NodelistLookup(nodeID []byte) (peer *core.PeerInfo) {
+    if fake := backend.lookupNode(nodeID); fake != nil {
+        return fake.Info
+    }
+
+    return nil
+}
+
+// PeerlistCount returns the count of peers.
+func (backend *Backend) PeerlistCount() (count int) {
+    backend.RLock()
+    defer backend.RUnlock()
+
+    return len(backend.peers)
+}
+
+// ReadBlock reads the block of a peer.
+func (backend *Backend) ReadBlock(PublicKey *btcec.PublicKey, Version, BlockNumber uint64) (decoded *blockchain.BlockDecoded, raw []byte, found bool, err error) {
+    peer := backend.lookupPublicKey(PublicKey)
+    if peer == nil {
+        return nil, nil, false, nil
+    }
+
+    file, found := peer.block(Version, BlockNumber)
+    if !found {
+        return nil, nil, false, nil
+    }
+
+    decoded = &blockchain.BlockDecoded{Block: blockchain.Block{OwnerPublicKey: PublicKey, NodeID: peer.Info.NodeID, BlockchainVersion: Version, Number: BlockNumber}}
+    if file != nil {
+        decoded.RecordsDecoded = append(decoded.RecordsDecoded, *file)
+    }
+
+    return decoded, nil, true, nil
+}
+
+// ReadFile reads a file from the block of a peer.
+func (backend *Backend) ReadFile(PublicKey *btcec.PublicKey, Version, BlockNumber uint64, FileID uuid.UUID) (file blockchain.BlockRecordFile, raw []byte, found bool, err error) {
+    peer := backend.lookupPublicKey(PublicKey)
+    if peer == nil {
+        return file, nil, false, nil
+    }
+
+    record, found := peer.block(Version, BlockNumber)
+    if !found || record == nil || record.ID != FileID {
+        return file, nil, false, nil
+    }
+
+    return *record, nil, true, nil
+}
+
+// FileTransfer serves the file data of the peer from memory. Limit is optional (0 means the entire file).
+func (backend *Backend) FileTransfer(peer *core.PeerInfo, hash []byte, offset, limit uint64, cancelChan <-chan struct{}) (reader io.ReadCloser, fileSize, transferSize uint64, err error) {
+    if peer == nil {
+        return nil, 0, 0, errors.New("Peer not provided")
+    }
+
+    fake := backend.lookupNode(peer.NodeID)
+    if fake == nil || fake.Unreachable {
+        return nil, 0, 0, errors.New("no valid connection to Peer")
+    }
+
+    data, found := fake.fileData(hash)
+    if !found {
+        return nil, 0, 0, errors.New("file not found")
+    }
+
+    fileSize = uint64(len(data))
+    if offset > fileSize {
+        return nil, 0, 0, errors.New("invalid offset")
+    }
+
+    transferSize = fileSize - offset
+    if limit > 0 && limit < transferSize {
+        transferSize = limit
+    }
+
+    if fake.Delay > 0 {
+        select {
+        case <-time.After(fake.Delay):
+        case <-cancelChan:
+            return nil, 0, 0, errors.New("transfer canceled")
+        }
+    }
+
+    data = data[offset : offset+transferSize]
+    if fake.Corrupt {
+        corrupted := make([]byte, len(data))
+        for n := range data {
+            corrupted[n] = ^data[n]
+        }
+        data = corrupted
+    }
+
+    return io.NopCloser(bytes.NewReader(data)), fileSize, transferSize, nil
+}
+
+// lookupNode returns the peer with the node ID
+func (backend *Backend) lookupNode(nodeID []byte) *Peer {
+    backend.RLock()
+    defer backend.RUnlock()
+
+    for _, peer := range backend.peers {
+        if bytes.Equal(peer.Info.NodeID, nodeID) {
+            return peer
+        }
+    }
+
+    return nil
+}
+
+// lookupPublicKey returns the peer with the public key
+func (backend *Backend) lookupPublicKey(publicKey *btcec.PublicKey) *Peer {
+    if publicKey == nil {
+        return nil
+    }
+
+    return backend.lookupNode(protocol.PublicKey2NodeID(publicKey))
+}
+
+// searchIndex searches the files of all peers
+type searchIndex struct {
+    backend *Backend
+}
+
+// Search returns all files of peers that contain the term in the name.
+func (index *searchIndex) Search(term string) (results []search.SearchIndexRecord) {
+    term = strings.ToLower(term)
+
+    index.backend.RLock()
+    peers := append([]*Peer{}, index.backend.peers...)
+    index.backend.RUnlock()
+
+    for _, peer := range peers {
+        peer.RLock()
+        for n, file := range peer.files {
+            if name := file.GetTag(blockchain.TagName); name != nil && strings.Contains(strings.ToLower(name.Text()), term) {
+                results = append(results, search.SearchIndexRecord{FileID: file.ID, PublicKey: peer.Info.PublicKey, BlockchainVersion: peer.Info.BlockchainVersion, BlockNumber: uint64(n + 1)})
+            }
+        }
+        peer.RUnlock()
+    }
+
+    return results
+}
@@ -0,0 +1,327 @@
+/*
+File Name:  Blockchain.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapitest
+
+import (
+    "bytes"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/btcec"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/google/uuid"
+)
+
+// Blockchain is an in-memory implementation of webapi.Blockchain. Records are kept decoded.
+// Raw records added via Append are returned by Read, but they are not decoded.
+type Blockchain struct {
+    FailStatus int // If not StatusOK, AddFiles and ReplaceFiles fail with this status without changing the blockchain.
+
+    publicKey *btcec.PublicKey
+    nodeID    []byte
+    version   uint64
+    blocks    []*memoryBlock
+    sync.Mutex
+}
+
+// memoryBlock is a single block of the in-memory blockchain
+type memoryBlock struct {
+    date    time.Time                       // date the records were created
+    files   []blockchain.BlockRecordFile    // file records
+    profile []blockchain.BlockRecordProfile // profile records
+    raw     []blockchain.BlockRecordRaw     // raw records added via Append
+}
+
+// isEmpty checks if the block has no records left
+func (block *memoryBlock) isEmpty() bool {
+    return len(block.files) == 0 && len(block.profile) == 0 && len(block.raw) == 0
+}
+
+// NewBlockchain creates an empty in-memory blockchain owned by the public key.
+func NewBlockchain(publicKey *btcec.PublicKey) *Blockchain {
+    return &Blockchain{publicKey: publicKey, nodeID: protocol.PublicKey2NodeID(publicKey)}
+}
+
+// Header returns the owner, height and version.
+func (chain *Blockchain) Header() (publicKey *btcec.PublicKey, height uint64, version uint64) {
+    chain.Lock()
+    defer chain.Unlock()
+
+    return chain.publicKey, uint64(len(chain.blocks)), chain.version
+}
+
+// appendBlock adds a new block. The caller must hold the lock.
+func (chain *Blockchain) appendBlock(block *memoryBlock) (newHeight, newVersion uint64, status int) {
+    block.date = time.Now()
+    chain.blocks = append(chain.blocks, block)
+
+    return uint64(len(chain.blocks)), chain.version, blockchain.StatusOK
+}
+
+// refactor removes empty blocks after records were deleted and increases the version. The caller must hold the lock.
+func (chain *Blockchain) refactor() {
+    var blocks []*memoryBlock
+    for _, block := range chain.blocks {
+        if !block.isEmpty() {
+            blocks = append(blocks, block)
+        }
+    }
+
+    chain.blocks = blocks
+    chain.version++
+}
+
+// Append adds a block with the raw records.
+func (chain *Blockchain) Append(RecordsRaw []blockchain.BlockRecordRaw) (newHeight, newVersion uint64, status int) {
+    chain.Lock()
+    defer chain.Unlock()
+
+    return chain.appendBlock(&memoryBlock{raw: RecordsRaw})
+}
+
+// Read returns the block. Decoded records contain the files and profile fields.
+func (chain *Blockchain) Read(number uint64) (decoded *blockchain.BlockDecoded, status int, err error) {
+    chain.Lock()
+    defer chain.Unlock()
+
+    if number >= uint64(len(chain.blocks)) {
+        return nil, blockchain.StatusBlockNotFound, nil
+    }
+
+    block := chain.blocks[number]
+
+    decoded = &blockchain.BlockDecoded{Block: blockchain.Block{OwnerPublicKey: chain.publicKey, NodeID: chain.nodeID, BlockchainVersion: chain.version, Number: number, RecordsRaw: block.raw}}
+    for _, file := range chain.blockFiles(block) {
+        decoded.RecordsDecoded = append(decoded.RecordsDecoded, file)
+    }
+    for _, field := range block.profile {
+        decoded.RecordsDecoded = append(decoded.RecordsDecoded, field)
+    }
+
+    return decoded, blockchain.StatusOK, nil
+}
+
+// blockFiles returns the files of the block as they would be decoded. The caller must hold the lock.
+func (chain *Blockchain) blockFiles(block *memoryBlock) (files []blockchain.BlockRecordFile) {
+    for _, file := range block.files {
+        files = append(files, chain.decodedFile(block, file))
+    }
+
+    return files
+}
+
+// decodedFile returns the file with the owner and the virtual date shared tag set like the blockchain decoder does
+func (chain *Blockchain) decodedFile(block *memoryBlock, file blockchain.BlockRecordFile) blockchain.BlockRecordFile {
+    file.NodeID = chain.nodeID
+    file.Tags = append(append([]blockchain.BlockRecordFileTag{}, file.Tags...), blockchain.TagFromDate(blockchain.TagDateShared, block.date))
+
+    return file
+}
+
+// AddFiles adds the files in a new block. Virtual tags are not stored.
+func (chain *Blockchain) AddFiles(files []blockchain.BlockRecordFile) (newHeight, newVersion uint64, status int) {
+    chain.Lock()
+    defer chain.Unlock()
+
+    if chain.FailStatus != blockchain.StatusOK {
+        return uint64(len(chain.blocks)), chain.version, chain.FailStatus
+    }
+
+    return chain.addFiles(files)
+}
+
+// addFiles adds the files in a new block. The caller must hold the lock.
+func (chain *Blockchain) addFiles(files []blockchain.BlockRecordFile) (newHeight, newVersion uint64, status int) {
+    block := &memoryBlock{}
+
+    for _, file := range files {
+        var tags []blockchain.BlockRecordFileTag
+        for _, tag := range file.Tags {
+            if !blockchain.IsTagVirtual(tag.Type) {
+                tags = append(tags, tag)
+            }
+        }
+        file.Tags = tags
+
+        block.files = append(block.files, file)
+    }
+
+    return chain.appendBlock(block)
+}
+
+// ListFiles returns all files.
+func (chain *Blockchain) ListFiles() (files []blockchain.BlockRecordFile, status int) {
+    chain.Lock()
+    defer chain.Unlock()
+
+    for _, block := range chain.blocks {
+        files = append(files, chain.blockFiles(block)...)
+    }
+
+    return files, blockchain.StatusOK
+}
+
+// FileExists returns all files with the hash.
+func (chain *Blockchain) FileExists(hash []byte) (files []blockchain.BlockRecordFile, status int) {
+    all, status := chain.ListFiles()
+
+    for _, file := range all {
+        if bytes.Equal(file.Hash, hash) {
+            files = append(files, file)
+        }
+    }
+
+    return files, status
+}
+
+// DeleteFiles deletes the files with the IDs.
+func (chain *Blockchain) DeleteFiles(IDs []uuid.UUID) (newHeight, newVersion uint64, deletedFiles []*blockchain.BlockRecordFile, status int) {
+    chain.Lock()
+    defer chain.Unlock()
+
+    deletedFiles = chain.deleteFiles(IDs)
+
+    return uint64(len(chain.blocks)), chain.version, deletedFiles, blockchain.StatusOK
+}
+
+// deleteFiles deletes the files with the IDs. The caller must hold the lock.
+func (chain *Blockchain) deleteFiles(IDs []uuid.UUID) (deletedFiles []*blockchain.BlockRecordFile) {
+    for _, block := range chain.blocks {
+        var keep []blockchain.BlockRecordFile
+
+        for _, file := range block.files {
+            if containsID(IDs, file.ID) {
+                deleted := chain.decodedFile(block, file)
+                deletedFiles = append(deletedFiles, &deleted)
+            } else {
+                keep = append(keep, file)
+            }
+        }
+
+        block.files = keep
+    }
+
+    if len(deletedFiles) > 0 {
+        chain.refactor()
+    }
+
+    return deletedFiles
+}
+
+// containsID checks if the ID is in the list
+func containsID(IDs []uuid.UUID, ID uuid.UUID) bool {
+    for _, id := range IDs {
+        if id == ID {
+            return true
+        }
+    }
+
+    return false
+}
+
+// ReplaceFiles deletes the existing files with the same IDs and adds the new ones.
+func (chain *Blockchain) ReplaceFiles(files []blockchain.BlockRecordFile) (newHeight, newVersion uint64, status int) {
+    chain.Lock()
+    defer chain.Unlock()
+
+    if chain.FailStatus != blockchain.StatusOK {
+        return uint64(len(chain.blocks)), chain.version, chain.FailStatus
+    }
+
+    var IDs []uuid.UUID
+    for _, file := range files {
+        IDs = append(IDs, file.ID)
+    }
+
+    chain.deleteFiles(IDs)
+
+    return chain.addFiles(files)
+}
+
+// ProfileList returns all profile fields ordered by type. If a field is set multiple times, only the latest one is returned.
+func (chain *Blockchain) ProfileList() (fields []blockchain.BlockRecordProfile, status int) {
+    chain.Lock()
+    defer chain.Unlock()
+
+    unique := make(map[uint16][]byte)
+    for _, block := range chain.blocks {
+        for _, field := range block.profile {
+            unique[field.Type] = field.Data
+        }
+    }
+
+    for Type, data := range unique {
+        fields = append(fields, blockchain.BlockRecordProfile{Type: Type, Data: data})
+    }
+
+    sort.Slice(fields, func(i, j int) bool { return fields[i].Type < fields[j].Type })
+
+    return fields, blockchain.StatusOK
+}
+
+// ProfileReadField returns the latest value of the profile field.
+func (chain *Blockchain) ProfileReadField(index uint16) (data []byte, status int) {
+    chain.Lock()
+    defer chain.Unlock()
+
+    found := false
+    for _, block := range chain.blocks {
+        for _, field := range block.profile {
+            if field.Type == index {
+                data = field.Data
+                found = true
+            }
+        }
+    }
+
+    if !found {
+        return nil, blockchain.StatusDataNotFound
+    }
+
+    return data, blockchain.StatusOK
+}
+
+// ProfileWrite writes the profile fields in a new block.
+func (chain *Blockchain) ProfileWrite(fields []blockchain.BlockRecordProfile) (newHeight, newVersion uint64, status int) {
+    chain.Lock()
+    defer chain.Unlock()
+
+    return chain.appendBlock(&memoryBlock{profile: fields})
+}
+
+// ProfileDelete deletes the profile fields.
+func (chain *Blockchain) ProfileDelete(fields []uint16) (newHeight, newVersion uint64, status int) {
+    chain.Lock()
+    defer chain.Unlock()
+
+    deleted := false
+
+    for _, block := range chain.blocks {
+        var keep []blockchain.BlockRecordProfile
+        for _, field := range block.profile {
+            isDelete := false
+            for _, Type := range fields {
+                isDelete = isDelete || field.Type == Type
+            }
+
+            if isDelete {
+                deleted = true
+            } else {
+                keep = append(keep, field)
+            }
+        }
+        block.profile = keep
+    }
+
+    if deleted {
+        chain.refactor()
+    }
+
+    return uint64(len(chain.blocks)), chain.version, blockchain.StatusOK
+}
@@ -0,0 +1,109 @@
+/*
+File Name:  Peer.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapitest
+
+import (
+    "bytes"
+    "encoding/hex"
+    "sync"
+    "time"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/core"
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/btcec"
+    "github.com/PeernetOfficial/core/merkle"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/google/uuid"
+)
+
+// Peer is a scripted remote peer. It shares files on its blockchain and serves their data.
+// Each file is stored in its own block, starting at block 1.
+type Peer struct {
+    Info        *core.PeerInfo // Peer information as returned by the backend.
+    Unreachable bool           // If set, the peer is in the peer list but cannot be found via FindNode and does not serve files.
+    Corrupt     bool           // If set, the peer serves corrupted data: All bits are flipped.
+    Delay       time.Duration  // Delay before each transfer starts. Used to simulate slow peers.
+
+    files []blockchain.BlockRecordFile // shared files
+    data  map[string][]byte            // file data by hex hash
+    sync.RWMutex
+}
+
+// newPeer creates a new peer with a random key
+func newPeer() *Peer {
+    privateKey, err := btcec.NewPrivateKey(btcec.S256())
+    if err != nil {
+        panic(err)
+    }
+    publicKey := privateKey.PubKey()
+
+    return &Peer{
+        Info: &core.PeerInfo{PublicKey: publicKey, NodeID: protocol.PublicKey2NodeID(publicKey), UserAgent: "webapitest", BlockchainHeight: 1},
+        data: make(map[string][]byte),
+    }
+}
+
+// AddFile shares the file with the data. The ID, hash, size, date and node ID are set automatically if not provided. It returns the file as published.
+func (peer *Peer) AddFile(file webapi.ApiFile, data []byte) webapi.ApiFile {
+    peer.Lock()
+    defer peer.Unlock()
+
+    if file.ID == uuid.Nil {
+        file.ID = uuid.New()
+    }
+    file.Hash = protocol.HashData(data)
+    file.Size = uint64(len(data))
+    file.NodeID = peer.Info.NodeID
+
+    if file.Date.IsZero() {
+        file.Date = time.Now()
+    }
+
+    // The record is stored decoded, including the virtual date shared tag.
+    record := webapi.BlockRecordFileFromAPI(file)
+    record.NodeID = file.NodeID
+    record.Tags = append(record.Tags, blockchain.TagFromDate(blockchain.TagDateShared, file.Date))
+
+    if record.Size <= merkle.MinimumFragmentSize {
+        record.MerkleRootHash = record.Hash
+        record.FragmentSize = merkle.MinimumFragmentSize
+    } else if tree, err := merkle.NewMerkleTree(record.Size, merkle.CalculateFragmentSize(record.Size), bytes.NewReader(data)); err == nil {
+        record.MerkleRootHash = tree.RootHash
+        record.FragmentSize = tree.FragmentSize
+    }
+
+    peer.files = append(peer.files, record)
+    peer.data[hex.EncodeToString(file.Hash)] = data
+    peer.Info.BlockchainHeight = uint64(len(peer.files)) + 1
+
+    return file
+}
+
+// block returns the file stored in the block. Block 0 is empty.
+func (peer *Peer) block(version, number uint64) (file *blockchain.BlockRecordFile, found bool) {
+    peer.RLock()
+    defer peer.RUnlock()
+
+    if version != peer.Info.BlockchainVersion || number >= peer.Info.BlockchainHeight {
+        return nil, false
+    } else if number == 0 {
+        return nil, true
+    }
+
+    record := peer.files[number-1]
+    return &record, true
+}
+
+// fileData returns the data of the file
+func (peer *Peer) fileData(hash []byte) (data []byte, found bool) {
+    peer.RLock()
+    defer peer.RUnlock()
+
+    data, found = peer.data[hex.EncodeToString(hash)]
+    return data, found
+}
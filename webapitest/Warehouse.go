@@ -0,0 +1,157 @@
+/*
+File Name:  Warehouse.go
+Copyright:  2021 Peernet Foundation s.r.o.
+Author:     Peter Kleissner
+*/
+
+package webapitest
+
+import (
+    "bytes"
+    "encoding/hex"
+    "errors"
+    "io"
+    "os"
+    "sync"
+
+    "github.com/PeernetOfficial/core/merkle"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/PeernetOfficial/core/warehouse"
+)
+
+// Warehouse is an in-memory implementation of webapi.Warehouse. Status codes are the same as warehouse.StatusX.
+type Warehouse struct {
+    files map[string][]byte // file data by hex hash
+    sync.RWMutex
+}
+
+// NewWarehouse creates an empty in-memory warehouse.
+func NewWarehouse() *Warehouse {
+    return &Warehouse{files: make(map[string][]byte)}
+}
+
+// Add stores the data and returns the hash. This is a shortcut for CreateFile.
+func (wh *Warehouse) Add(data []byte) (hash []byte) {
+    hash = protocol.HashData(data)
+
+    wh.Lock()
+    wh.files[hex.EncodeToString(hash)] = data
+    wh.Unlock()
+
+    return hash
+}
+
+// get returns the data of the file
+func (wh *Warehouse) get(hash []byte) (data []byte, status int, err error) {
+    if _, err := warehouse.ValidateHash(hash); err != nil {
+        return nil, warehouse.StatusInvalidHash, err
+    }
+
+    wh.RLock()
+    data, ok := wh.files[hex.EncodeToString(hash)]
+    wh.RUnlock()
+
+    if !ok {
+        return nil, warehouse.StatusFileNotFound, os.ErrNotExist
+    }
+
+    return data, warehouse.StatusOK, nil
+}
+
+// CreateFile stores the data read from the reader. File size is optional (0 means read until EOF).
+func (wh *Warehouse) CreateFile(data io.Reader, fileSize uint64) (hash []byte, status int, err error) {
+    if fileSize > 0 {
+        data = io.LimitReader(data, int64(fileSize))
+    }
+
+    buffer, err := io.ReadAll(data)
+    if err != nil {
+        return nil, warehouse.StatusErrorWriteTempFile, err
+    }
+
+    return wh.Add(buffer), warehouse.StatusOK, nil
+}
+
+// CreateFileFromPath stores the data of the file on disk.
+func (wh *Warehouse) CreateFileFromPath(file string) (hash []byte, status int, err error) {
+    data, err := os.ReadFile(file)
+    if err != nil {
+        return nil, warehouse.StatusErrorOpenFile, err
+    }
+
+    return wh.Add(data), warehouse.StatusOK, nil
+}
+
+// ReadFile writes the file data to the writer. Limit is optional (0 = not used).
+func (wh *Warehouse) ReadFile(hash []byte, offset, limit int64, writer io.Writer) (status int, bytesRead int64, err error) {
+    data, status, err := wh.get(hash)
+    if status != warehouse.StatusOK {
+        return status, 0, err
+    } else if offset < 0 || offset > int64(len(data)) {
+        return warehouse.StatusErrorSeekFile, 0, errors.New("invalid offset")
+    }
+
+    reader := io.Reader(bytes.NewReader(data[offset:]))
+    if limit > 0 {
+        reader = io.LimitReader(reader, limit)
+    }
+
+    if bytesRead, err = io.Copy(writer, reader); err != nil {
+        return warehouse.StatusErrorReadFile, bytesRead, err
+    }
+
+    return warehouse.StatusOK, bytesRead, nil
+}
+
+// ReadFileToDisk writes the file data to the target file. It fails with StatusErrorTargetExists if the target file already exists.
+func (wh *Warehouse) ReadFileToDisk(hash []byte, offset, limit int64, fileTarget string) (status int, bytesRead int64, err error) {
+    if _, err := os.Stat(fileTarget); err == nil {
+        return warehouse.StatusErrorTargetExists, 0, nil
+    }
+
+    file, err := os.OpenFile(fileTarget, os.O_WRONLY|os.O_CREATE, 0666)
+    if err != nil {
+        return warehouse.StatusErrorCreateTarget, 0, err
+    }
+    defer file.Close()
+
+    return wh.ReadFile(hash, offset, limit, file)
+}
+
+// DeleteFile deletes the file.
+func (wh *Warehouse) DeleteFile(hash []byte) (status int, err error) {
+    if _, status, err = wh.get(hash); status != warehouse.StatusOK {
+        return status, err
+    }
+
+    wh.Lock()
+    delete(wh.files, hex.EncodeToString(hash))
+    wh.Unlock()
+
+    return warehouse.StatusOK, nil
+}
+
+// FileExists checks if the file exists. The path is always empty as files are only stored in memory.
+func (wh *Warehouse) FileExists(hash []byte) (path string, fileSize uint64, status int, err error) {
+    data, status, err := wh.get(hash)
+    if status != warehouse.StatusOK {
+        return "", 0, status, err
+    }
+
+    return "", uint64(len(data)), warehouse.StatusOK, nil
+}
+
+// ReadMerkleTree calculates the merkle tree of the file.
+func (wh *Warehouse) ReadMerkleTree(hash []byte, headerOnly bool) (tree *merkle.MerkleTree, status int, err error) {
+    data, status, err := wh.get(hash)
+    if status != warehouse.StatusOK {
+        return nil, status, err
+    }
+
+    fileSize := uint64(len(data))
+    if tree, err = merkle.NewMerkleTree(fileSize, merkle.CalculateFragmentSize(fileSize), bytes.NewReader(data)); err != nil {
+        return nil, warehouse.StatusErrorCreateMerkle, err
+    }
+
+    return tree, warehouse.StatusOK, nil
+}
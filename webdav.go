@@ -0,0 +1,542 @@
+/*
+File Name:  webdav.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+package Abstrations
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+    "os"
+    "path"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/core"
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/warehouse"
+    "github.com/google/uuid"
+    "golang.org/x/net/webdav"
+)
+
+/*
+WebDAV exposes the files shared on the user's blockchain as a directory tree, so they can be mounted in file managers.
+The tree is built from the Folder and Name tags of the files and the virtual folders:
+
+    GET, PROPFIND   Read files and list directories. The data is read from the warehouse.
+    PUT             Imports the file into the warehouse and adds it to the blockchain. An existing file is replaced.
+    MKCOL           Adds a virtual folder.
+    DELETE          Removes the files (and everything under a folder) like Rm.
+    MOVE            Updates the Folder and Name tags of the files.
+    COPY            Adds new records referencing the same data.
+
+If multiple files share the same path, only the first one is accessible via the path, the others get the beginning of the file ID appended to the name.
+*/
+
+// webdavReadSize is the amount of data read at once from the warehouse
+const webdavReadSize = 1024 * 1024
+
+// WebDAV returns the WebDAV handler for the user's shared files. The prefix is stripped from the request path, for example "/webdav".
+func WebDAV(api *webapi.WebapiInstance, prefix string) http.Handler {
+    return &webdav.Handler{
+        Prefix:     prefix,
+        FileSystem: &webdavFS{api: api},
+        LockSystem: webdav.NewMemLS(),
+        Logger: func(r *http.Request, err error) {
+            if err != nil {
+                api.Backend.LogError("WebDAV", "%s '%s' error: %v\n", r.Method, r.URL.Path, err)
+            }
+        },
+    }
+}
+
+// MountWebDAV registers the WebDAV handler on the API router under the prefix, for example "/webdav".
+// The API key (if any) is required; file managers can provide it as password via HTTP basic authentication.
+func MountWebDAV(api *webapi.WebapiInstance, prefix string) {
+    prefix = "/" + webapi.CleanFolder(prefix)
+
+    api.AllowBasicAuth = append(api.AllowBasicAuth, prefix)
+    api.Router.PathPrefix(prefix).Handler(WebDAV(api, prefix))
+}
+
+// webdavFS implements webdav.FileSystem on top of the user's blockchain and warehouse
+type webdavFS struct {
+    api *webapi.WebapiInstance
+    sync.Mutex // Changes are serialized since they read and modify the list of files.
+}
+
+// webdavNode is a file or directory in the tree
+type webdavNode struct {
+    info     webdavInfo
+    record   *blockchain.BlockRecordFile // Record of the file or virtual folder. Nil for directories only derived from folder tags.
+    children []string                     // Paths of the direct children. Only directories.
+}
+
+// tree returns all nodes by path. The root directory has the empty path.
+func (fs *webdavFS) tree() (nodes map[string]*webdavNode, err error) {
+    files, status := fs.api.Backend.UserBlockchain().ListFiles()
+    if status != blockchain.StatusOK {
+        return nil, blockchainError(status)
+    }
+
+    nodes = map[string]*webdavNode{"": {info: webdavInfo{isDir: true}}}
+
+    // addDir returns the directory node of the path and creates it including all parents if necessary
+    var addDir func(dirPath string) *webdavNode
+    addDir = func(dirPath string) *webdavNode {
+        if node, ok := nodes[dirPath]; ok {
+            return node
+        }
+
+        parent, name := path.Split(dirPath)
+        parentNode := addDir(strings.TrimSuffix(parent, "/"))
+
+        if parentNode.info.isDir {
+            node := &webdavNode{info: webdavInfo{name: name, isDir: true}}
+            nodes[dirPath] = node
+            parentNode.children = append(parentNode.children, dirPath)
+            return node
+        }
+
+        // A file occupies the parent path. The directory is not reachable.
+        return &webdavNode{info: webdavInfo{name: name, isDir: true}}
+    }
+
+    for n := range files {
+        file := webapi.BlockRecordFileToAPI(files[n])
+        filePath := webapi.CleanFolder(path.Join(file.Folder, file.Name))
+        if filePath == "" {
+            continue
+        }
+
+        if file.IsVirtualFolder() {
+            node := addDir(filePath)
+            if node.record == nil {
+                node.record = &files[n]
+                node.info.modTime = file.Date
+            }
+            continue
+        }
+
+        folder, name := path.Split(filePath)
+        parent := addDir(strings.TrimSuffix(folder, "/"))
+        if !parent.info.isDir {
+            continue
+        }
+
+        if _, exists := nodes[filePath]; exists {
+            extension := path.Ext(name)
+            name = strings.TrimSuffix(name, extension) + " (" + file.ID.String()[:8] + ")" + extension
+            filePath = folder + name
+        }
+
+        nodes[filePath] = &webdavNode{info: webdavInfo{name: name, size: int64(file.Size), modTime: file.Date, hash: file.Hash}, record: &files[n]}
+        parent.children = append(parent.children, filePath)
+    }
+
+    return nodes, nil
+}
+
+// lookup returns the node of the path. It returns os.ErrNotExist if not found.
+func (fs *webdavFS) lookup(name string) (node *webdavNode, nodes map[string]*webdavNode, err error) {
+    if nodes, err = fs.tree(); err != nil {
+        return nil, nil, err
+    }
+
+    if node = nodes[webapi.CleanFolder(name)]; node == nil {
+        return nil, nodes, os.ErrNotExist
+    }
+
+    return node, nodes, nil
+}
+
+// recordsUnder returns the records of the directory and of all files and folders under it
+func recordsUnder(nodes map[string]*webdavNode, dirPath string) (records []*blockchain.BlockRecordFile) {
+    for nodePath, node := range nodes {
+        if node.record != nil && (dirPath == "" || webapi.IsInFolder(nodePath, dirPath)) {
+            records = append(records, node.record)
+        }
+    }
+
+    return records
+}
+
+func (fs *webdavFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+    node, _, err := fs.lookup(name)
+    if err != nil {
+        return nil, err
+    }
+
+    return node.info, nil
+}
+
+func (fs *webdavFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+    node, nodes, err := fs.lookup(name)
+    if err != nil && !errors.Is(err, os.ErrNotExist) {
+        return nil, err
+    }
+
+    // Read access
+    if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) == 0 {
+        if node == nil {
+            return nil, os.ErrNotExist
+        }
+
+        file := &webdavFile{fs: fs, node: *node}
+        for _, child := range node.children {
+            file.children = append(file.children, nodes[child].info)
+        }
+
+        return file, nil
+    }
+
+    // Write access. The data is buffered in a temporary file and imported when the file is closed.
+    filePath := webapi.CleanFolder(name)
+    if node != nil && node.info.isDir {
+        return nil, os.ErrExist
+    } else if node == nil && flag&os.O_CREATE == 0 {
+        return nil, os.ErrNotExist
+    } else if parent := nodes[webapi.CleanFolder(path.Dir(filePath))]; parent == nil || !parent.info.isDir {
+        return nil, os.ErrNotExist
+    }
+
+    // Keep the extension so the file type can be detected.
+    temp, err := os.CreateTemp("", "webdav-*"+path.Ext(filePath))
+    if err != nil {
+        return nil, err
+    }
+
+    file := &webdavFile{fs: fs, path: filePath, temp: temp, node: webdavNode{info: webdavInfo{name: path.Base(filePath), modTime: time.Now()}}}
+    if node != nil {
+        file.node.record = node.record
+    }
+
+    return file, nil
+}
+
+func (fs *webdavFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+    fs.Lock()
+    defer fs.Unlock()
+
+    dirPath := webapi.CleanFolder(name)
+
+    _, nodes, err := fs.lookup(dirPath)
+    if err == nil {
+        return os.ErrExist
+    } else if !errors.Is(err, os.ErrNotExist) {
+        return err
+    } else if parent := nodes[webapi.CleanFolder(path.Dir(dirPath))]; parent == nil || !parent.info.isDir {
+        return os.ErrNotExist
+    }
+
+    folder, folderName := path.Split(dirPath)
+    _, err = publishFiles(fs.api, []webapi.ApiFile{{Type: core.TypeFolder, Format: core.FormatFolder, Folder: strings.TrimSuffix(folder, "/"), Name: folderName, Date: time.Now()}})
+
+    return err
+}
+
+func (fs *webdavFS) RemoveAll(ctx context.Context, name string) error {
+    fs.Lock()
+    defer fs.Unlock()
+
+    filePath := webapi.CleanFolder(name)
+    if filePath == "" {
+        return os.ErrPermission
+    }
+
+    node, nodes, err := fs.lookup(filePath)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil
+    } else if err != nil {
+        return err
+    }
+
+    var UUIDs []uuid.UUID
+    if node.info.isDir {
+        for _, record := range recordsUnder(nodes, filePath) {
+            UUIDs = append(UUIDs, record.ID)
+        }
+    } else {
+        UUIDs = append(UUIDs, node.record.ID)
+    }
+
+    if _, err = rmFiles(fs.api, UUIDs); err != nil && !errors.Is(err, ErrFileNotFound) {
+        return err
+    }
+
+    return nil
+}
+
+func (fs *webdavFS) Rename(ctx context.Context, oldName, newName string) error {
+    fs.Lock()
+    defer fs.Unlock()
+
+    oldPath, newPath := webapi.CleanFolder(oldName), webapi.CleanFolder(newName)
+    if oldPath == "" || newPath == "" || webapi.IsInFolder(newPath, oldPath) {
+        return os.ErrInvalid
+    }
+
+    node, nodes, err := fs.lookup(oldPath)
+    if err != nil {
+        return err
+    } else if _, exists := nodes[newPath]; exists {
+        return os.ErrExist
+    } else if parent := nodes[webapi.CleanFolder(path.Dir(newPath))]; parent == nil || !parent.info.isDir {
+        return os.ErrNotExist
+    }
+
+    newFolder, newFileName := path.Split(newPath)
+    newFolder = strings.TrimSuffix(newFolder, "/")
+
+    var records []blockchain.BlockRecordFile
+
+    if !node.info.isDir {
+        record := *node.record
+        setTextTag(&record, blockchain.TagFolder, newFolder)
+        setTextTag(&record, blockchain.TagName, newFileName)
+        records = append(records, record)
+    } else {
+        for _, recordOld := range recordsUnder(nodes, oldPath) {
+            record := *recordOld
+            file := webapi.BlockRecordFileToAPI(record)
+
+            if folder := webapi.CleanFolder(file.Folder); webapi.IsInFolder(folder, oldPath) {
+                setTextTag(&record, blockchain.TagFolder, newPath+strings.TrimPrefix(folder, oldPath))
+            } else {
+                // the virtual folder record of the directory itself
+                setTextTag(&record, blockchain.TagFolder, newFolder)
+                setTextTag(&record, blockchain.TagName, newFileName)
+            }
+
+            records = append(records, record)
+        }
+    }
+
+    if len(records) == 0 {
+        return nil
+    }
+
+    if _, _, status := fs.api.Backend.UserBlockchain().ReplaceFiles(records); status != blockchain.StatusOK {
+        return blockchainError(status)
+    }
+
+    return nil
+}
+
+// put imports the data into the warehouse and publishes the file. If the record is provided, it is replaced.
+func (fs *webdavFS) put(filePath, dataPath string, record *blockchain.BlockRecordFile) (err error) {
+    fs.Lock()
+    defer fs.Unlock()
+
+    hash, status, err := fs.api.Backend.UserWarehouse().CreateFileFromPath(dataPath)
+    if err != nil {
+        return err
+    } else if status != warehouse.StatusOK {
+        return ErrNotInWarehouse
+    }
+
+    folder, name := path.Split(filePath)
+
+    if record == nil {
+        _, err = publishFiles(fs.api, []webapi.ApiFile{newTouchFile(dataPath, hash, &TouchOptions{Name: name, Folder: strings.TrimSuffix(folder, "/")})})
+        return err
+    }
+
+    // Replace the data of the existing record. All tags are kept.
+    replace := *record
+    replace.Hash = hash
+    if _, replace.Size, status, err = fs.api.Backend.UserWarehouse().FileExists(hash); status != warehouse.StatusOK {
+        return ErrNotInWarehouse
+    }
+
+    fileType, fileFormat, _ := webapi.FileDetectType(dataPath)
+    replace.Type = uint8(fileType)
+    replace.Format = fileFormat
+
+    if !webapi.SetFileMerkleInfo(fs.api.Backend, &replace) {
+        return ErrMerkleInfo
+    }
+
+    if _, _, status := fs.api.Backend.UserBlockchain().ReplaceFiles([]blockchain.BlockRecordFile{replace}); status != blockchain.StatusOK {
+        return blockchainError(status)
+    }
+
+    // Delete the old data from the warehouse in case there are no other references.
+    if files, status := fs.api.Backend.UserBlockchain().FileExists(record.Hash); status == blockchain.StatusOK && len(files) == 0 {
+        fs.api.Backend.UserWarehouse().DeleteFile(record.Hash)
+    }
+
+    return nil
+}
+
+// webdavFile is an opened file or directory. Files opened for writing are buffered in a temporary file.
+type webdavFile struct {
+    fs       *webdavFS
+    node     webdavNode
+    children []os.FileInfo // Directory entries not yet returned by Readdir.
+    offset   int64         // Read offset.
+
+    buffer       []byte // Data read ahead from the warehouse.
+    bufferOffset int64  // Offset of the buffer in the file.
+
+    path string   // Path of the file opened for writing.
+    temp *os.File // Temporary file opened for writing.
+}
+
+func (file *webdavFile) Read(p []byte) (n int, err error) {
+    if file.node.info.isDir {
+        return 0, os.ErrInvalid
+    } else if file.temp != nil {
+        return file.temp.Read(p)
+    } else if file.offset >= file.node.info.size {
+        return 0, io.EOF
+    }
+
+    if file.offset < file.bufferOffset || file.offset >= file.bufferOffset+int64(len(file.buffer)) {
+        var buffer bufferWriter
+        if status, _, err := file.fs.api.Backend.UserWarehouse().ReadFile(file.node.info.hash, file.offset, webdavReadSize, &buffer); status != warehouse.StatusOK {
+            if err == nil {
+                err = fmt.Errorf("warehouse error status %d", status)
+            }
+            return 0, err
+        } else if len(buffer) == 0 {
+            return 0, io.EOF
+        }
+
+        file.buffer, file.bufferOffset = buffer, file.offset
+    }
+
+    n = copy(p, file.buffer[file.offset-file.bufferOffset:])
+    file.offset += int64(n)
+
+    return n, nil
+}
+
+func (file *webdavFile) Seek(offset int64, whence int) (int64, error) {
+    if file.temp != nil {
+        return file.temp.Seek(offset, whence)
+    }
+
+    switch whence {
+    case io.SeekCurrent:
+        offset += file.offset
+    case io.SeekEnd:
+        offset += file.node.info.size
+    }
+
+    if offset < 0 {
+        return file.offset, os.ErrInvalid
+    }
+
+    file.offset = offset
+
+    return offset, nil
+}
+
+func (file *webdavFile) Readdir(count int) (infos []os.FileInfo, err error) {
+    if !file.node.info.isDir {
+        return nil, os.ErrInvalid
+    }
+
+    if count <= 0 || count > len(file.children) {
+        if count > 0 && len(file.children) == 0 {
+            return nil, io.EOF
+        }
+        count = len(file.children)
+    }
+
+    infos, file.children = file.children[:count], file.children[count:]
+
+    return infos, nil
+}
+
+func (file *webdavFile) Stat() (os.FileInfo, error) {
+    if file.temp != nil {
+        info, err := file.temp.Stat()
+        if err != nil {
+            return nil, err
+        }
+        file.node.info.size = info.Size()
+    }
+
+    return file.node.info, nil
+}
+
+func (file *webdavFile) Write(p []byte) (n int, err error) {
+    if file.temp == nil {
+        return 0, os.ErrPermission
+    }
+
+    return file.temp.Write(p)
+}
+
+// Close imports the data of files opened for writing into the warehouse and publishes them.
+func (file *webdavFile) Close() (err error) {
+    if file.temp == nil {
+        return nil
+    }
+
+    defer os.Remove(file.temp.Name())
+
+    if err = file.temp.Close(); err != nil {
+        return err
+    }
+
+    return file.fs.put(file.path, file.temp.Name(), file.node.record)
+}
+
+// webdavInfo implements os.FileInfo
+type webdavInfo struct {
+    name    string
+    size    int64
+    modTime time.Time
+    isDir   bool
+    hash    []byte
+}
+
+func (info webdavInfo) Name() string       { return info.name }
+func (info webdavInfo) Size() int64        { return info.size }
+func (info webdavInfo) ModTime() time.Time { return info.modTime }
+func (info webdavInfo) IsDir() bool        { return info.isDir }
+func (info webdavInfo) Sys() interface{}   { return nil }
+
+func (info webdavInfo) Mode() os.FileMode {
+    if info.isDir {
+        return os.ModeDir | 0755
+    }
+    return 0644
+}
+
+// ContentType returns the content type based on the file extension. This prevents reading the data when listing directories.
+func (info webdavInfo) ContentType(ctx context.Context) (string, error) {
+    if contentType := mime.TypeByExtension(path.Ext(info.name)); contentType != "" {
+        return contentType, nil
+    }
+
+    return "application/octet-stream", nil
+}
+
+// ETag returns the hash of the file data.
+func (info webdavInfo) ETag(ctx context.Context) (string, error) {
+    if len(info.hash) == 0 {
+        return "", webdav.ErrNotImplemented
+    }
+
+    return fmt.Sprintf(`"%x"`, info.hash), nil
+}
+
+// bufferWriter collects the written data
+type bufferWriter []byte
+
+func (buffer *bufferWriter) Write(p []byte) (n int, err error) {
+    *buffer = append(*buffer, p...)
+    return len(p), nil
+}
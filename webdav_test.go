@@ -0,0 +1,174 @@
+/*
+File Name:  webdav_test.go
+Copyright:  2021 Peernet s.r.o.
+Authors: Peter Kleissner, Akilan Selvacoumar
+*/
+
+package Abstrations
+
+import (
+    "bytes"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/PeernetOfficial/Abstraction/webapi"
+    "github.com/PeernetOfficial/Abstraction/webapitest"
+    "github.com/PeernetOfficial/core"
+    "github.com/PeernetOfficial/core/blockchain"
+    "github.com/PeernetOfficial/core/protocol"
+    "github.com/PeernetOfficial/core/warehouse"
+    "github.com/google/uuid"
+)
+
+// webdavRequest sends the request with the API key as basic authentication password. It returns the status code and the response body.
+func webdavRequest(t *testing.T, server *httptest.Server, key uuid.UUID, method, path string, body []byte, header map[string]string) (statusCode int, response []byte) {
+    t.Helper()
+
+    req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(body))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if key != uuid.Nil {
+        req.SetBasicAuth("user", key.String())
+    }
+    for name, value := range header {
+        req.Header.Set(name, value)
+    }
+
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+
+    response, _ = io.ReadAll(resp.Body)
+
+    return resp.StatusCode, response
+}
+
+// webdavRecords returns the files on the user's blockchain by their path
+func webdavRecords(t *testing.T, backend *webapitest.Backend) (files map[string]webapi.ApiFile) {
+    t.Helper()
+
+    records, status := backend.Blockchain.ListFiles()
+    if status != blockchain.StatusOK {
+        t.Fatalf("list files status %d", status)
+    }
+
+    files = make(map[string]webapi.ApiFile)
+    for _, record := range records {
+        file := webapi.BlockRecordFileToAPI(record)
+        files[webapi.CleanFolder(file.Folder+"/"+file.Name)] = file
+    }
+
+    return files
+}
+
+func TestWebDAVAuthentication(t *testing.T) {
+    key := uuid.New()
+    api, server := webapitest.NewServer(webapitest.NewBackend(), key)
+    defer server.Close()
+    MountWebDAV(api, "/webdav")
+
+    // Basic authentication is only accepted, and asked for, under the WebDAV mount.
+    for _, test := range []struct {
+        method    string
+        path      string
+        key       uuid.UUID
+        code      int
+        challenge bool
+    }{
+        {"PROPFIND", "/webdav/", uuid.Nil, http.StatusUnauthorized, true},
+        {"PROPFIND", "/webdav/", uuid.New(), http.StatusUnauthorized, true},
+        {"PROPFIND", "/webdav/", key, http.StatusMultiStatus, false},
+        {"GET", "/Status", uuid.Nil, http.StatusUnauthorized, false},
+        {"GET", "/Status", key, http.StatusUnauthorized, false},
+    } {
+        req, _ := http.NewRequest(test.method, server.URL+test.path, nil)
+        if test.key != uuid.Nil {
+            req.SetBasicAuth("user", test.key.String())
+        }
+
+        resp, err := http.DefaultClient.Do(req)
+        if err != nil {
+            t.Fatal(err)
+        }
+        resp.Body.Close()
+
+        if resp.StatusCode != test.code || (resp.Header.Get("WWW-Authenticate") != "") != test.challenge {
+            t.Errorf("%s %s: status code %d, WWW-Authenticate '%s'", test.method, test.path, resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+        }
+    }
+}
+
+func TestWebDAV(t *testing.T) {
+    key := uuid.New()
+    backend := webapitest.NewBackend()
+    api, server := webapitest.NewServer(backend, key)
+    defer server.Close()
+    MountWebDAV(api, "/webdav")
+
+    data := []byte("webdav file data")
+
+    // MKCOL adds a virtual folder
+    if code, _ := webdavRequest(t, server, key, "MKCOL", "/webdav/docs", nil, nil); code != http.StatusCreated {
+        t.Fatalf("MKCOL status code %d", code)
+    }
+    if folder, ok := webdavRecords(t, backend)["docs"]; !ok || folder.Type != core.TypeFolder {
+        t.Fatalf("virtual folder not added: %+v", folder)
+    }
+
+    // PUT imports the file into the warehouse and adds it to the blockchain
+    if code, _ := webdavRequest(t, server, key, "PUT", "/webdav/docs/a.txt", data, nil); code != http.StatusCreated {
+        t.Fatalf("PUT status code %d", code)
+    }
+    file, ok := webdavRecords(t, backend)["docs/a.txt"]
+    if !ok || !bytes.Equal(file.Hash, protocol.HashData(data)) || file.Size != uint64(len(data)) {
+        t.Fatalf("file not added: %+v", file)
+    }
+    if _, _, status, _ := backend.Warehouse.FileExists(file.Hash); status != warehouse.StatusOK {
+        t.Fatalf("file not in warehouse, status %d", status)
+    }
+
+    // PROPFIND lists the directory
+    if code, response := webdavRequest(t, server, key, "PROPFIND", "/webdav/docs/", nil, map[string]string{"Depth": "1"}); code != http.StatusMultiStatus || !bytes.Contains(response, []byte("/webdav/docs/a.txt")) {
+        t.Fatalf("PROPFIND status code %d response %s", code, response)
+    }
+
+    // GET reads the data from the warehouse
+    if code, response := webdavRequest(t, server, key, "GET", "/webdav/docs/a.txt", nil, nil); code != http.StatusOK || !bytes.Equal(response, data) {
+        t.Fatalf("GET status code %d data %q", code, response)
+    }
+
+    // MOVE updates the folder and name tags
+    if code, _ := webdavRequest(t, server, key, "MOVE", "/webdav/docs/a.txt", nil, map[string]string{"Destination": server.URL + "/webdav/b.txt"}); code != http.StatusCreated {
+        t.Fatalf("MOVE status code %d", code)
+    }
+    records := webdavRecords(t, backend)
+    if moved, ok := records["b.txt"]; !ok || moved.ID != file.ID || !bytes.Equal(moved.Hash, file.Hash) {
+        t.Fatalf("file not moved: %+v", moved)
+    } else if _, ok := records["docs/a.txt"]; ok {
+        t.Fatal("file still in the old folder")
+    }
+
+    // DELETE removes the file and the data from the warehouse
+    if code, _ := webdavRequest(t, server, key, "DELETE", "/webdav/b.txt", nil, nil); code != http.StatusNoContent {
+        t.Fatalf("DELETE status code %d", code)
+    }
+    if _, ok := webdavRecords(t, backend)["b.txt"]; ok {
+        t.Fatal("file not deleted")
+    }
+    if _, _, status, _ := backend.Warehouse.FileExists(file.Hash); status == warehouse.StatusOK {
+        t.Fatal("data not deleted from the warehouse")
+    }
+
+    // DELETE of the directory removes the virtual folder
+    if code, _ := webdavRequest(t, server, key, "DELETE", "/webdav/docs", nil, nil); code != http.StatusNoContent {
+        t.Fatalf("DELETE status code %d", code)
+    }
+    if records := webdavRecords(t, backend); len(records) != 0 {
+        t.Fatalf("%d files left on the blockchain", len(records))
+    }
+}